@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"reflect"
+	"test-project/middleware"
+)
+
+const (
+	EntityUser      = "user"
+	EntityTask      = "task"
+	EntityTimesheet = "timesheet"
+
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionDelete     = "delete"
+	ActionHardDelete = "hard_delete"
+	ActionRestore    = "restore"
+	ActionStart      = "start"
+	ActionStop       = "stop"
+	ActionRepair     = "repair"
+	ActionAutoStop   = "auto_stop"
+	ActionSubmit     = "submit"
+	ActionApprove    = "approve"
+	ActionReject     = "reject"
+)
+
+// Entry describes one mutation. Before is nil for inserts and After is nil for deletes.
+type Entry struct {
+	Entity   string
+	EntityID int
+	UserID   int
+	Action   string
+	Before   interface{}
+	After    interface{}
+}
+
+// FieldChange is the value of a single field before and after a mutation.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Record writes entry to audit_log within tx, so the audit row commits or
+// rolls back together with the change it describes. The actor, request ID and
+// organization are taken from ctx.
+func Record(ctx context.Context, tx *sql.Tx, entry Entry) error {
+	before, after, diff, err := encode(entry)
+	if err != nil {
+		return err
+	}
+
+	// Background jobs carry no organization, so fall back to the user's.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO audit_log (organization_id, entity, entity_id, user_id, action, actor, request_id, before, after, diff)
+		VALUES (COALESCE(NULLIF($1, 0), (SELECT organization_id FROM users WHERE id = $4)), $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		middleware.OrganizationFromContext(ctx), entry.Entity, entry.EntityID, entry.UserID, entry.Action, middleware.ActorFromContext(ctx), requestID(ctx), before, after, diff)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
+
+// RecordAll writes entries like Record, but with COPY, for bulk changes. The
+// organization must be set in ctx.
+func RecordAll(ctx context.Context, tx *sql.Tx, entries []Entry) error {
+	orgID := middleware.OrganizationFromContext(ctx)
+	if orgID == 0 {
+		return fmt.Errorf("error writing audit log: no organization")
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("audit_log", "organization_id", "entity", "entity_id", "user_id", "action", "actor", "request_id", "before", "after", "diff"))
+	if err != nil {
+		return fmt.Errorf("error starting audit log copy: %w", err)
+	}
+	defer stmt.Close()
+
+	actor, reqID := middleware.ActorFromContext(ctx), requestID(ctx)
+	for _, entry := range entries {
+		before, after, diff, err := encode(entry)
+		if err != nil {
+			return err
+		}
+		if _, err = stmt.ExecContext(ctx, orgID, entry.Entity, entry.EntityID, entry.UserID, entry.Action, actor, reqID, before, after, diff); err != nil {
+			return fmt.Errorf("error writing audit log: %w", err)
+		}
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
+
+// encode returns the before and after states of entry as JSON, and their diff.
+func encode(entry Entry) (sql.NullString, sql.NullString, string, error) {
+	before, beforeMap, err := toJSON(entry.Before)
+	if err != nil {
+		return before, sql.NullString{}, "", fmt.Errorf("error encoding audit before state: %w", err)
+	}
+	after, afterMap, err := toJSON(entry.After)
+	if err != nil {
+		return before, after, "", fmt.Errorf("error encoding audit after state: %w", err)
+	}
+	diff, err := json.Marshal(Diff(beforeMap, afterMap))
+	if err != nil {
+		return before, after, "", fmt.Errorf("error encoding audit diff: %w", err)
+	}
+	return before, after, string(diff), nil
+}
+
+func requestID(ctx context.Context) sql.NullString {
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		return sql.NullString{String: id, Valid: true}
+	}
+	return sql.NullString{}
+}
+
+// Diff returns the fields whose values differ between before and after.
+func Diff(before, after map[string]interface{}) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	for key, from := range before {
+		to, ok := after[key]
+		if !ok || !reflect.DeepEqual(from, to) {
+			changes[key] = FieldChange{From: from, To: to}
+		}
+	}
+	for key, to := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = FieldChange{From: nil, To: to}
+		}
+	}
+	return changes
+}
+
+// toJSON encodes v as a string rather than []byte, which lib/pq would send as bytea.
+func toJSON(v interface{}) (sql.NullString, map[string]interface{}, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return sql.NullString{}, nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return sql.NullString{}, nil, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, m, nil
+}
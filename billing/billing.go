@@ -0,0 +1,54 @@
+package billing
+
+import (
+	"fmt"
+	"strconv"
+	"test-project/config"
+)
+
+// RoundMinutes rounds a tracked duration to the configured increment. With
+// rounding enabled, any non-zero duration bills at least one increment unless
+// the mode is "down".
+func RoundMinutes(minutes int, cfg config.BillingConfig) int {
+	step := cfg.RoundingMinutes
+	if step <= 0 || minutes <= 0 {
+		return minutes
+	}
+
+	switch cfg.RoundingMode {
+	case "down":
+		return minutes / step * step
+	case "nearest":
+		rounded := (minutes + step/2) / step * step
+		if rounded == 0 {
+			rounded = step
+		}
+		return rounded
+	default:
+		return (minutes + step - 1) / step * step
+	}
+}
+
+// Cost returns the price of minutes at an hourly rate, both in minor units,
+// rounding half a minor unit up.
+func Cost(minutes int, hourlyRate int64) int64 {
+	return (int64(minutes)*hourlyRate + 30) / 60
+}
+
+// zeroDecimal lists currencies whose minor unit is the major unit.
+var zeroDecimal = map[string]bool{
+	"CLP": true, "ISK": true, "JPY": true, "KRW": true, "PYG": true, "UGX": true, "VND": true, "XAF": true, "XOF": true,
+}
+
+// FormatAmount renders minor units as a decimal string, e.g. 123456 USD as "1234.56".
+func FormatAmount(amount int64, currency string) string {
+	if zeroDecimal[currency] {
+		return strconv.FormatInt(amount, 10)
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
@@ -0,0 +1,82 @@
+package billing
+
+import (
+	"test-project/config"
+	"testing"
+)
+
+func TestRoundMinutes(t *testing.T) {
+	tests := []struct {
+		mode    string
+		step    int
+		minutes int
+		want    int
+	}{
+		{"up", 0, 7, 7},
+		{"up", 15, 0, 0},
+		{"up", 15, 1, 15},
+		{"up", 15, 15, 15},
+		{"up", 15, 16, 30},
+		{"", 15, 16, 30},
+		{"down", 15, 14, 0},
+		{"down", 15, 29, 15},
+		{"down", 15, 30, 30},
+		{"nearest", 15, 1, 15},
+		{"nearest", 15, 7, 15},
+		{"nearest", 15, 22, 15},
+		{"nearest", 15, 23, 30},
+		{"nearest", 6, 3, 6},
+		{"nearest", 6, 8, 6},
+		{"nearest", 6, 9, 12},
+		{"up", 6, -5, -5},
+	}
+	for _, tt := range tests {
+		got := RoundMinutes(tt.minutes, config.BillingConfig{RoundingMode: tt.mode, RoundingMinutes: tt.step})
+		if got != tt.want {
+			t.Errorf("RoundMinutes(%d) with %q every %d = %d, want %d", tt.minutes, tt.mode, tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		minutes int
+		rate    int64
+		want    int64
+	}{
+		{60, 6000, 6000},
+		{90, 6000, 9000},
+		{0, 6000, 0},
+		{1, 100, 2}, // 1.67 rounds up
+		{1, 89, 1},  // 1.48 rounds down
+		{1, 90, 2},  // exactly half rounds up
+		{7, 12345, 1440},
+		{45, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := Cost(tt.minutes, tt.rate); got != tt.want {
+			t.Errorf("Cost(%d, %d) = %d, want %d", tt.minutes, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{123456, "USD", "1234.56"},
+		{5, "EUR", "0.05"},
+		{0, "EUR", "0.00"},
+		{-250, "EUR", "-2.50"},
+		{-5, "EUR", "-0.05"},
+		{1500, "JPY", "1500"},
+		{-1500, "JPY", "-1500"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"strconv"
+	"sync"
+	"test-project/config"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/outbox"
+	"time"
+)
+
+const (
+	// subscriptionBuffer is how many events a subscriber may fall behind
+	// before it is dropped.
+	subscriptionBuffer = 64
+	// catchUpBatch bounds how many events are loaded per query after a
+	// reconnect or a bulk publish.
+	catchUpBatch = 1000
+	// pingInterval is how often an idle listener checks its connection.
+	pingInterval = 90 * time.Second
+)
+
+// Event is an outbox event delivered to subscribers as it commits.
+type Event struct {
+	ID             int64
+	Type           string
+	OrganizationID int
+	UserID         int
+	Actor          string
+	OccurredAt     time.Time
+	Data           json.RawMessage
+}
+
+// Subscription receives the events of one organization. C is closed when the
+// subscriber falls too far behind or the broker stops; the subscriber then
+// catches up from outbox_events.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	orgID  int
+	userID int
+	types  []string
+}
+
+var (
+	mu            sync.Mutex
+	subscriptions = make(map[*Subscription]struct{})
+	stopped       bool
+)
+
+// Subscribe returns a subscription to the organization's events of the given
+// types. A non-zero userID limits it to that user's events.
+func Subscribe(orgID, userID int, types ...string) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, orgID: orgID, userID: userID, types: types}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if stopped {
+		close(c)
+		return sub
+	}
+	subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := subscriptions[s]; ok {
+		delete(subscriptions, s)
+		close(s.c)
+	}
+}
+
+func (s *Subscription) wants(event Event) bool {
+	if event.OrganizationID != s.orgID || (s.userID != 0 && event.UserID != s.userID) {
+		return false
+	}
+	for _, t := range s.types {
+		if t == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Run listens on outbox.Channel and hands each committed event to the
+// subscribers of this replica until ctx is cancelled, then closes every
+// subscription. Every replica runs its own listener, so subscribers see the
+// events of all replicas.
+func Run(ctx context.Context, cfg config.DatabaseConfig) {
+	defer closeAll()
+
+	listener := pq.NewListener(cfg.URL, cfg.RetryBackoff, cfg.RetryMaxBackoff, func(_ pq.ListenerEventType, err error) {
+		if err != nil && ctx.Err() == nil {
+			logger.Warning("Event listener connection problem: %v", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(outbox.Channel); err != nil {
+		logger.Error("Error listening on %s: %v", outbox.Channel, err)
+		return
+	}
+
+	lastID, err := latestEventID(ctx, cfg.QueryTimeout)
+	if err != nil {
+		logger.Error("Error reading the latest event: %v", err)
+	}
+	logger.Info("Listening for events on %s", outbox.Channel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			var id int64
+			if n != nil {
+				id, _ = strconv.ParseInt(n.Extra, 10, 64)
+			}
+			var events []Event
+			if id > 0 {
+				// Events are published by ID so one that commits after a
+				// later ID is not skipped.
+				events, err = loadEvents(ctx, cfg.QueryTimeout, "id = $1", id)
+			} else {
+				// Several events were published at once, or the connection
+				// was lost and notifications may have been missed.
+				events, err = catchUp(ctx, cfg.QueryTimeout, lastID)
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("Error loading events: %v", err)
+				}
+				continue
+			}
+			for _, event := range events {
+				if event.ID > lastID {
+					lastID = event.ID
+				}
+				publish(event)
+			}
+		case <-time.After(pingInterval):
+			go listener.Ping()
+		}
+	}
+}
+
+// catchUp loads the events after lastID.
+func catchUp(ctx context.Context, timeout time.Duration, lastID int64) ([]Event, error) {
+	var all []Event
+	for {
+		events, err := loadEvents(ctx, timeout, "id > $1 ORDER BY id LIMIT "+strconv.Itoa(catchUpBatch), lastID)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, events...)
+		if len(events) < catchUpBatch {
+			return all, nil
+		}
+		lastID = events[len(events)-1].ID
+	}
+}
+
+func loadEvents(ctx context.Context, timeout time.Duration, where string, arg interface{}) ([]Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var events []Event
+	err := database.WithScope(ctx, database.SystemScope, func(ctx context.Context) error {
+		rows, err := database.From(ctx).QueryContext(ctx, `
+			SELECT id, type, organization_id, COALESCE(user_id, 0), actor, created_at, data
+			FROM outbox_events
+			WHERE `+where, arg)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var event Event
+			if err = rows.Scan(&event.ID, &event.Type, &event.OrganizationID, &event.UserID, &event.Actor, &event.OccurredAt, &event.Data); err != nil {
+				return err
+			}
+			event.OccurredAt = event.OccurredAt.UTC()
+			events = append(events, event)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading outbox events: %w", err)
+	}
+	return events, nil
+}
+
+func latestEventID(ctx context.Context, timeout time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var id int64
+	err := database.WithScope(ctx, database.SystemScope, func(ctx context.Context) error {
+		return database.From(ctx).QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM outbox_events").Scan(&id)
+	})
+	return id, err
+}
+
+// publish hands event to every subscriber that wants it. A subscriber whose
+// buffer is full is dropped rather than allowed to hold up the others.
+func publish(event Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	for sub := range subscriptions {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			logger.Warning("Dropping event subscriber of organization %d that fell behind", sub.orgID)
+			delete(subscriptions, sub)
+			close(sub.c)
+		}
+	}
+}
+
+func closeAll() {
+	mu.Lock()
+	defer mu.Unlock()
+	stopped = true
+	for sub := range subscriptions {
+		delete(subscriptions, sub)
+		close(sub.c)
+	}
+}
@@ -0,0 +1,56 @@
+// Command repair-tasks reports and optionally fixes overlapping, stale and
+// miscounted tasks in the live database.
+//
+// Usage:
+//
+//	repair-tasks [-stale-hours 12] [-user 0] [-commit] [-- config flags]
+//
+// Without -commit the planned fixes are printed and nothing is written.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"test-project/config"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/repair"
+	"time"
+)
+
+func main() {
+	fs := flag.NewFlagSet("repair-tasks", flag.ExitOnError)
+	staleHours := fs.Int("stale-hours", 12, "hours after which a running task is considered stale")
+	userID := fs.Int("user", 0, "restrict to one user ID (0 means all users)")
+	commit := fs.Bool("commit", false, "apply the fixes instead of only reporting them")
+	fs.Parse(os.Args[1:])
+
+	cfg, err := config.Load(fs.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger.Init(cfg.Log)
+
+	database.Connect(cfg.Database)
+	defer database.Close()
+
+	opts := repair.Options{StaleAfter: time.Duration(*staleHours) * time.Hour, UserID: *userID}
+	var report repair.Report
+	err = database.WithScope(context.Background(), database.SystemScope, func(ctx context.Context) error {
+		report, err = repair.Run(ctx, database.From(ctx), opts, *commit)
+		return err
+	})
+	if err != nil {
+		database.Close()
+		log.Fatal(err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		log.Print(err)
+	}
+}
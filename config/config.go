@@ -0,0 +1,506 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ProfileDev  = "dev"
+	ProfileTest = "test"
+	ProfileProd = "prod"
+)
+
+// Config is the typed application configuration.
+// Values are resolved from defaults, an optional YAML/TOML file, environment
+// variables and command-line flags, each layer overriding the previous one.
+type Config struct {
+	Profile   string          `yaml:"profile" toml:"profile"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	PeopleAPI PeopleAPIConfig `yaml:"people_api" toml:"people_api"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Retention RetentionConfig `yaml:"retention" toml:"retention"`
+	AutoStop  AutoStopConfig  `yaml:"auto_stop" toml:"auto_stop"`
+	Billing   BillingConfig   `yaml:"billing" toml:"billing"`
+	Tenancy   TenancyConfig   `yaml:"tenancy" toml:"tenancy"`
+	Jobs      JobsConfig      `yaml:"jobs" toml:"jobs"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks" toml:"webhooks"`
+	Streams   StreamsConfig   `yaml:"streams" toml:"streams"`
+}
+
+type ServerConfig struct {
+	Host              string        `yaml:"host" toml:"host"`
+	Port              int           `yaml:"port" toml:"port"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	TLSCertFile       string        `yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile        string        `yaml:"tls_key_file" toml:"tls_key_file"`
+}
+
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" toml:"url"`
+	MigrationsPath  string        `yaml:"migrations_path" toml:"migrations_path"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	QueryTimeout    time.Duration `yaml:"query_timeout" toml:"query_timeout"`
+	ConnectRetries  int           `yaml:"connect_retries" toml:"connect_retries"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+	// RequireRowSecurity refuses to start when the database role bypasses
+	// row-level security, as superusers and BYPASSRLS roles do.
+	RequireRowSecurity bool `yaml:"require_row_security" toml:"require_row_security"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" toml:"level"`
+}
+
+type PeopleAPIConfig struct {
+	URL string `yaml:"url" toml:"url"`
+}
+
+type AuthConfig struct {
+	AdminToken string `yaml:"admin_token" toml:"admin_token"`
+}
+
+type RetentionConfig struct {
+	DeletedUsers  time.Duration `yaml:"deleted_users" toml:"deleted_users"`
+	FinishedJobs  time.Duration `yaml:"finished_jobs" toml:"finished_jobs"`
+	Events        time.Duration `yaml:"events" toml:"events"`
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval"`
+}
+
+// AutoStopConfig controls the job that stops forgotten timers. MaxTaskDuration
+// applies to users without their own limit; EndOfDay is a local "HH:MM" cutoff
+// evaluated in each user's timezone, or empty to disable it.
+type AutoStopConfig struct {
+	Enabled         bool          `yaml:"enabled" toml:"enabled"`
+	Interval        time.Duration `yaml:"interval" toml:"interval"`
+	MaxTaskDuration time.Duration `yaml:"max_task_duration" toml:"max_task_duration"`
+	EndOfDay        string        `yaml:"end_of_day" toml:"end_of_day"`
+}
+
+// BillingConfig controls how tracked time is turned into money. Each task's
+// duration is rounded to a multiple of RoundingMinutes (0 disables rounding)
+// using RoundingMode "up", "down" or "nearest". Currency is used for rates
+// created without one.
+type BillingConfig struct {
+	RoundingMinutes int    `yaml:"rounding_minutes" toml:"rounding_minutes"`
+	RoundingMode    string `yaml:"rounding_mode" toml:"rounding_mode"`
+	Currency        string `yaml:"currency" toml:"currency"`
+}
+
+// TenancyConfig controls how a request is mapped to an organization.
+// An organization API token selects its organization; with BaseDomain set,
+// requests for <slug>.BaseDomain must carry that organization's token.
+// Requests without credentials use DefaultOrganization, or are rejected when
+// Required is set.
+type TenancyConfig struct {
+	BaseDomain          string `yaml:"base_domain" toml:"base_domain"`
+	DefaultOrganization string `yaml:"default_organization" toml:"default_organization"`
+	Required            bool   `yaml:"required" toml:"required"`
+}
+
+// JobsConfig controls the background job queue. Each replica runs Workers
+// jobs at a time and looks for new ones every PollInterval. A job holds a
+// lease of LeaseDuration that its worker keeps renewing; a job whose lease
+// expires, because its replica died, is picked up again. Failed jobs are
+// retried after RetryBackoff, doubling up to RetryMaxBackoff, until they have
+// run MaxAttempts times. A single run is cancelled after Timeout. With no
+// Workers, the replica only enqueues jobs.
+type JobsConfig struct {
+	Workers         int           `yaml:"workers" toml:"workers"`
+	PollInterval    time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	LeaseDuration   time.Duration `yaml:"lease_duration" toml:"lease_duration"`
+	MaxAttempts     int           `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+	Timeout         time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// WebhooksConfig controls delivery of domain events to webhooks. Each replica
+// sends up to Workers requests at a time and looks for new events every
+// PollInterval. A request that fails or times out after Timeout is retried
+// after RetryBackoff, doubling up to RetryMaxBackoff, and the delivery is
+// marked dead after MaxAttempts. With no Workers, the replica sends nothing.
+type WebhooksConfig struct {
+	Workers         int           `yaml:"workers" toml:"workers"`
+	PollInterval    time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	Timeout         time.Duration `yaml:"timeout" toml:"timeout"`
+	MaxAttempts     int           `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff" toml:"retry_max_backoff"`
+}
+
+// StreamsConfig controls the Server-Sent Events streams. An idle stream gets
+// a heartbeat comment every HeartbeatInterval so proxies keep it open, and a
+// timer stream gets the elapsed time of running timers every TickInterval.
+// A stream is closed after MaxDuration; clients reconnect and resume from the
+// last event they saw.
+type StreamsConfig struct {
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" toml:"heartbeat_interval"`
+	TickInterval      time.Duration `yaml:"tick_interval" toml:"tick_interval"`
+	MaxDuration       time.Duration `yaml:"max_duration" toml:"max_duration"`
+}
+
+// Address returns the host:port the HTTP server listens on.
+func (s ServerConfig) Address() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// Load builds the configuration from defaults, the optional config file,
+// the environment (including a .env file if present) and args.
+func Load(args []string) (*Config, error) {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+
+	fs := flag.NewFlagSet("test-project", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		configFile = fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+		profile    = fs.String("profile", envOr("APP_PROFILE", ProfileDev), "configuration profile: dev, test or prod")
+	)
+	var flagCfg Config
+	registerFlags(fs, &flagCfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	cfg := defaults(*profile)
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, cfg); err != nil {
+			return nil, err
+		}
+		// The profile fixes the defaults, so a file cannot switch it.
+		cfg.Profile = *profile
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		applyFlag(cfg, &flagCfg, f.Name)
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func defaults(profile string) *Config {
+	cfg := &Config{
+		Profile: profile,
+		Server: ServerConfig{
+			Host:              "localhost",
+			Port:              8000,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MigrationsPath:  "migrations",
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+			ConnectRetries:  10,
+			RetryBackoff:    500 * time.Millisecond,
+			RetryMaxBackoff: 15 * time.Second,
+		},
+		Log: LogConfig{
+			Level: "debug",
+		},
+		Retention: RetentionConfig{
+			DeletedUsers:  30 * 24 * time.Hour,
+			FinishedJobs:  7 * 24 * time.Hour,
+			Events:        30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		AutoStop: AutoStopConfig{
+			Enabled:         true,
+			Interval:        time.Minute,
+			MaxTaskDuration: 12 * time.Hour,
+		},
+		Billing: BillingConfig{
+			RoundingMode: "up",
+			Currency:     "USD",
+		},
+		Tenancy: TenancyConfig{
+			DefaultOrganization: "default",
+		},
+		Jobs: JobsConfig{
+			Workers:         4,
+			PollInterval:    time.Second,
+			LeaseDuration:   time.Minute,
+			MaxAttempts:     3,
+			RetryBackoff:    30 * time.Second,
+			RetryMaxBackoff: 10 * time.Minute,
+			Timeout:         time.Hour,
+		},
+		Webhooks: WebhooksConfig{
+			Workers:         4,
+			PollInterval:    time.Second,
+			Timeout:         10 * time.Second,
+			MaxAttempts:     10,
+			RetryBackoff:    10 * time.Second,
+			RetryMaxBackoff: time.Hour,
+		},
+		Streams: StreamsConfig{
+			HeartbeatInterval: 15 * time.Second,
+			TickInterval:      30 * time.Second,
+			MaxDuration:       time.Hour,
+		},
+	}
+
+	switch profile {
+	case ProfileTest:
+		cfg.Log.Level = "warning"
+		cfg.Server.ShutdownTimeout = 2 * time.Second
+		cfg.Database.ConnectRetries = 3
+	case ProfileProd:
+		cfg.Server.Host = "0.0.0.0"
+		cfg.Log.Level = "info"
+		cfg.Database.RequireRowSecurity = true
+	}
+	return cfg
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	strs := map[string]*string{
+		"API_HOST":              &cfg.Server.Host,
+		"TLS_CERT_FILE":         &cfg.Server.TLSCertFile,
+		"TLS_KEY_FILE":          &cfg.Server.TLSKeyFile,
+		"DATABASE_URL":          &cfg.Database.URL,
+		"MIGRATIONS_DIR":        &cfg.Database.MigrationsPath,
+		"LOG_LEVEL":             &cfg.Log.Level,
+		"PEOPLE_API_URL":        &cfg.PeopleAPI.URL,
+		"ADMIN_TOKEN":           &cfg.Auth.AdminToken,
+		"AUTO_STOP_EOD":         &cfg.AutoStop.EndOfDay,
+		"BILLING_ROUNDING_MODE": &cfg.Billing.RoundingMode,
+		"BILLING_CURRENCY":      &cfg.Billing.Currency,
+		"TENANCY_BASE_DOMAIN":   &cfg.Tenancy.BaseDomain,
+		"TENANCY_DEFAULT_ORG":   &cfg.Tenancy.DefaultOrganization,
+	}
+	for key, dst := range strs {
+		if value, ok := os.LookupEnv(key); ok {
+			*dst = value
+		}
+	}
+
+	ints := map[string]*int{
+		"API_PORT":                &cfg.Server.Port,
+		"SERVER_MAX_HEADER_BYTES": &cfg.Server.MaxHeaderBytes,
+		"DB_MAX_OPEN_CONNS":       &cfg.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS":       &cfg.Database.MaxIdleConns,
+		"DB_CONNECT_RETRIES":      &cfg.Database.ConnectRetries,
+		"BILLING_ROUNDING":        &cfg.Billing.RoundingMinutes,
+		"JOB_WORKERS":             &cfg.Jobs.Workers,
+		"JOB_MAX_ATTEMPTS":        &cfg.Jobs.MaxAttempts,
+		"WEBHOOK_WORKERS":         &cfg.Webhooks.Workers,
+		"WEBHOOK_MAX_ATTEMPTS":    &cfg.Webhooks.MaxAttempts,
+	}
+	for key, dst := range ints {
+		if value, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s value %q: %w", key, value, err)
+			}
+			*dst = n
+		}
+	}
+
+	if value, ok := os.LookupEnv("AUTO_STOP_ENABLED"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid AUTO_STOP_ENABLED value %q: %w", value, err)
+		}
+		cfg.AutoStop.Enabled = b
+	}
+
+	if value, ok := os.LookupEnv("DB_REQUIRE_ROW_SECURITY"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid DB_REQUIRE_ROW_SECURITY value %q: %w", value, err)
+		}
+		cfg.Database.RequireRowSecurity = b
+	}
+
+	if value, ok := os.LookupEnv("TENANCY_REQUIRED"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid TENANCY_REQUIRED value %q: %w", value, err)
+		}
+		cfg.Tenancy.Required = b
+	}
+
+	durations := map[string]*time.Duration{
+		"SERVER_READ_TIMEOUT":        &cfg.Server.ReadTimeout,
+		"SERVER_READ_HEADER_TIMEOUT": &cfg.Server.ReadHeaderTimeout,
+		"SERVER_WRITE_TIMEOUT":       &cfg.Server.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        &cfg.Server.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT":    &cfg.Server.ShutdownTimeout,
+		"DB_CONN_MAX_LIFETIME":       &cfg.Database.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME":      &cfg.Database.ConnMaxIdleTime,
+		"DB_QUERY_TIMEOUT":           &cfg.Database.QueryTimeout,
+		"DB_RETRY_BACKOFF":           &cfg.Database.RetryBackoff,
+		"DB_RETRY_MAX_BACKOFF":       &cfg.Database.RetryMaxBackoff,
+		"DELETED_USER_RETENTION":     &cfg.Retention.DeletedUsers,
+		"FINISHED_JOB_RETENTION":     &cfg.Retention.FinishedJobs,
+		"EVENT_RETENTION":            &cfg.Retention.Events,
+		"PURGE_INTERVAL":             &cfg.Retention.PurgeInterval,
+		"AUTO_STOP_INTERVAL":         &cfg.AutoStop.Interval,
+		"AUTO_STOP_MAX_DURATION":     &cfg.AutoStop.MaxTaskDuration,
+		"JOB_POLL_INTERVAL":          &cfg.Jobs.PollInterval,
+		"JOB_LEASE_DURATION":         &cfg.Jobs.LeaseDuration,
+		"JOB_RETRY_BACKOFF":          &cfg.Jobs.RetryBackoff,
+		"JOB_RETRY_MAX_BACKOFF":      &cfg.Jobs.RetryMaxBackoff,
+		"JOB_TIMEOUT":                &cfg.Jobs.Timeout,
+		"WEBHOOK_POLL_INTERVAL":      &cfg.Webhooks.PollInterval,
+		"WEBHOOK_TIMEOUT":            &cfg.Webhooks.Timeout,
+		"WEBHOOK_RETRY_BACKOFF":      &cfg.Webhooks.RetryBackoff,
+		"WEBHOOK_RETRY_MAX_BACKOFF":  &cfg.Webhooks.RetryMaxBackoff,
+		"STREAM_HEARTBEAT_INTERVAL":  &cfg.Streams.HeartbeatInterval,
+		"STREAM_TICK_INTERVAL":       &cfg.Streams.TickInterval,
+		"STREAM_MAX_DURATION":        &cfg.Streams.MaxDuration,
+	}
+	for key, dst := range durations {
+		if value, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s value %q: %w", key, value, err)
+			}
+			*dst = d
+		}
+	}
+	return nil
+}
+
+func registerFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.Server.Host, "host", "", "address to listen on")
+	fs.IntVar(&c.Server.Port, "port", 0, "port to listen on")
+	fs.DurationVar(&c.Server.ReadTimeout, "read-timeout", 0, "HTTP read timeout")
+	fs.DurationVar(&c.Server.ReadHeaderTimeout, "read-header-timeout", 0, "HTTP read header timeout")
+	fs.DurationVar(&c.Server.WriteTimeout, "write-timeout", 0, "HTTP write timeout")
+	fs.DurationVar(&c.Server.IdleTimeout, "idle-timeout", 0, "HTTP idle timeout")
+	fs.IntVar(&c.Server.MaxHeaderBytes, "max-header-bytes", 0, "maximum request header size")
+	fs.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", 0, "graceful shutdown deadline")
+	fs.StringVar(&c.Server.TLSCertFile, "tls-cert", "", "TLS certificate file")
+	fs.StringVar(&c.Server.TLSKeyFile, "tls-key", "", "TLS key file")
+	fs.StringVar(&c.Database.URL, "database-url", "", "Postgres connection string")
+	fs.StringVar(&c.Database.MigrationsPath, "migrations-dir", "", "directory containing SQL migrations")
+	fs.IntVar(&c.Database.MaxOpenConns, "db-max-open-conns", 0, "maximum open database connections")
+	fs.IntVar(&c.Database.MaxIdleConns, "db-max-idle-conns", 0, "maximum idle database connections")
+	fs.DurationVar(&c.Database.ConnMaxLifetime, "db-conn-max-lifetime", 0, "maximum lifetime of a database connection")
+	fs.DurationVar(&c.Database.ConnMaxIdleTime, "db-conn-max-idle-time", 0, "maximum idle time of a database connection")
+	fs.DurationVar(&c.Database.QueryTimeout, "db-query-timeout", 0, "timeout for a single database query")
+	fs.IntVar(&c.Database.ConnectRetries, "db-connect-retries", 0, "attempts to connect to the database on startup")
+	fs.DurationVar(&c.Retention.DeletedUsers, "deleted-user-retention", 0, "how long soft-deleted users are kept before purging")
+	fs.DurationVar(&c.Retention.PurgeInterval, "purge-interval", 0, "how often the purge job runs")
+	fs.IntVar(&c.Jobs.Workers, "job-workers", 0, "background jobs run at a time by this replica")
+	fs.StringVar(&c.Log.Level, "log-level", "", "log level: debug, info, warning or error")
+	fs.StringVar(&c.PeopleAPI.URL, "people-api-url", "", "base URL of the People info service")
+}
+
+func applyFlag(cfg, flagCfg *Config, name string) {
+	switch name {
+	case "host":
+		cfg.Server.Host = flagCfg.Server.Host
+	case "port":
+		cfg.Server.Port = flagCfg.Server.Port
+	case "read-timeout":
+		cfg.Server.ReadTimeout = flagCfg.Server.ReadTimeout
+	case "read-header-timeout":
+		cfg.Server.ReadHeaderTimeout = flagCfg.Server.ReadHeaderTimeout
+	case "write-timeout":
+		cfg.Server.WriteTimeout = flagCfg.Server.WriteTimeout
+	case "idle-timeout":
+		cfg.Server.IdleTimeout = flagCfg.Server.IdleTimeout
+	case "max-header-bytes":
+		cfg.Server.MaxHeaderBytes = flagCfg.Server.MaxHeaderBytes
+	case "shutdown-timeout":
+		cfg.Server.ShutdownTimeout = flagCfg.Server.ShutdownTimeout
+	case "tls-cert":
+		cfg.Server.TLSCertFile = flagCfg.Server.TLSCertFile
+	case "tls-key":
+		cfg.Server.TLSKeyFile = flagCfg.Server.TLSKeyFile
+	case "database-url":
+		cfg.Database.URL = flagCfg.Database.URL
+	case "migrations-dir":
+		cfg.Database.MigrationsPath = flagCfg.Database.MigrationsPath
+	case "db-max-open-conns":
+		cfg.Database.MaxOpenConns = flagCfg.Database.MaxOpenConns
+	case "db-max-idle-conns":
+		cfg.Database.MaxIdleConns = flagCfg.Database.MaxIdleConns
+	case "db-conn-max-lifetime":
+		cfg.Database.ConnMaxLifetime = flagCfg.Database.ConnMaxLifetime
+	case "db-conn-max-idle-time":
+		cfg.Database.ConnMaxIdleTime = flagCfg.Database.ConnMaxIdleTime
+	case "db-query-timeout":
+		cfg.Database.QueryTimeout = flagCfg.Database.QueryTimeout
+	case "db-connect-retries":
+		cfg.Database.ConnectRetries = flagCfg.Database.ConnectRetries
+	case "deleted-user-retention":
+		cfg.Retention.DeletedUsers = flagCfg.Retention.DeletedUsers
+	case "purge-interval":
+		cfg.Retention.PurgeInterval = flagCfg.Retention.PurgeInterval
+	case "job-workers":
+		cfg.Jobs.Workers = flagCfg.Jobs.Workers
+	case "log-level":
+		cfg.Log.Level = flagCfg.Log.Level
+	case "people-api-url":
+		cfg.PeopleAPI.URL = flagCfg.PeopleAPI.URL
+	}
+}
+
+func envOr(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
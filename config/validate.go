@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	slugPattern     = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,48}[a-z0-9])?$`)
+)
+
+// Validate checks the configuration and returns every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Profile {
+	case ProfileDev, ProfileTest, ProfileProd:
+	default:
+		errs = append(errs, fmt.Errorf("profile must be one of dev, test, prod, got %q", c.Profile))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.ReadHeaderTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("server timeouts must be positive"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	if c.Server.MaxHeaderBytes < 1024 {
+		errs = append(errs, fmt.Errorf("server.max_header_bytes must be at least 1024, got %d", c.Server.MaxHeaderBytes))
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("server.tls_cert_file and server.tls_key_file must be set together"))
+	}
+
+	if c.Database.URL == "" {
+		errs = append(errs, errors.New("database.url is required"))
+	}
+	if c.Database.MigrationsPath == "" {
+		errs = append(errs, errors.New("database.migrations_path is required"))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, fmt.Errorf("database.max_open_conns must be positive, got %d", c.Database.MaxOpenConns))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("database.max_idle_conns must be between 0 and max_open_conns, got %d", c.Database.MaxIdleConns))
+	}
+	if c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("database connection lifetimes must not be negative"))
+	}
+	if c.Database.QueryTimeout <= 0 {
+		errs = append(errs, errors.New("database.query_timeout must be positive"))
+	}
+	if c.Database.ConnectRetries < 1 {
+		errs = append(errs, fmt.Errorf("database.connect_retries must be at least 1, got %d", c.Database.ConnectRetries))
+	}
+	if c.Database.RetryBackoff <= 0 || c.Database.RetryMaxBackoff < c.Database.RetryBackoff {
+		errs = append(errs, errors.New("database.retry_backoff must be positive and not exceed retry_max_backoff"))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warning", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level must be one of debug, info, warning, error, got %q", c.Log.Level))
+	}
+
+	if c.PeopleAPI.URL != "" {
+		if u, err := url.Parse(c.PeopleAPI.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("people_api.url is not a valid URL: %q", c.PeopleAPI.URL))
+		}
+	}
+
+	if c.Retention.DeletedUsers <= 0 || c.Retention.FinishedJobs <= 0 || c.Retention.Events <= 0 || c.Retention.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("retention.deleted_users, retention.finished_jobs, retention.events and retention.purge_interval must be positive"))
+	}
+
+	if c.AutoStop.Interval <= 0 || c.AutoStop.MaxTaskDuration <= 0 {
+		errs = append(errs, errors.New("auto_stop.interval and auto_stop.max_task_duration must be positive"))
+	}
+	if c.AutoStop.EndOfDay != "" {
+		if _, err := time.Parse("15:04", c.AutoStop.EndOfDay); err != nil {
+			errs = append(errs, fmt.Errorf("auto_stop.end_of_day must be HH:MM, got %q", c.AutoStop.EndOfDay))
+		}
+	}
+
+	switch c.Billing.RoundingMinutes {
+	case 0, 6, 15, 30:
+	default:
+		errs = append(errs, fmt.Errorf("billing.rounding_minutes must be one of 0, 6, 15, 30, got %d", c.Billing.RoundingMinutes))
+	}
+	switch c.Billing.RoundingMode {
+	case "up", "down", "nearest":
+	default:
+		errs = append(errs, fmt.Errorf("billing.rounding_mode must be one of up, down, nearest, got %q", c.Billing.RoundingMode))
+	}
+	if !currencyPattern.MatchString(c.Billing.Currency) {
+		errs = append(errs, fmt.Errorf("billing.currency must be a three-letter ISO 4217 code, got %q", c.Billing.Currency))
+	}
+
+	if c.Tenancy.DefaultOrganization != "" && !slugPattern.MatchString(c.Tenancy.DefaultOrganization) {
+		errs = append(errs, fmt.Errorf("tenancy.default_organization is not a valid slug: %q", c.Tenancy.DefaultOrganization))
+	}
+	if c.Tenancy.DefaultOrganization == "" && !c.Tenancy.Required {
+		errs = append(errs, errors.New("tenancy.default_organization is required unless tenancy.required is set"))
+	}
+
+	if c.Jobs.Workers < 0 {
+		errs = append(errs, fmt.Errorf("jobs.workers must not be negative, got %d", c.Jobs.Workers))
+	}
+	if c.Jobs.PollInterval <= 0 || c.Jobs.LeaseDuration <= 0 || c.Jobs.Timeout <= 0 {
+		errs = append(errs, errors.New("jobs.poll_interval, jobs.lease_duration and jobs.timeout must be positive"))
+	}
+	if c.Jobs.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("jobs.max_attempts must be at least 1, got %d", c.Jobs.MaxAttempts))
+	}
+	if c.Jobs.RetryBackoff <= 0 || c.Jobs.RetryMaxBackoff < c.Jobs.RetryBackoff {
+		errs = append(errs, errors.New("jobs.retry_backoff must be positive and not exceed retry_max_backoff"))
+	}
+
+	if c.Webhooks.Workers < 0 {
+		errs = append(errs, fmt.Errorf("webhooks.workers must not be negative, got %d", c.Webhooks.Workers))
+	}
+	if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 {
+		errs = append(errs, errors.New("webhooks.poll_interval and webhooks.timeout must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("webhooks.max_attempts must be at least 1, got %d", c.Webhooks.MaxAttempts))
+	}
+	if c.Webhooks.RetryBackoff <= 0 || c.Webhooks.RetryMaxBackoff < c.Webhooks.RetryBackoff {
+		errs = append(errs, errors.New("webhooks.retry_backoff must be positive and not exceed retry_max_backoff"))
+	}
+
+	if c.Streams.HeartbeatInterval <= 0 || c.Streams.TickInterval <= 0 || c.Streams.MaxDuration <= 0 {
+		errs = append(errs, errors.New("streams.heartbeat_interval, streams.tick_interval and streams.max_duration must be positive"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
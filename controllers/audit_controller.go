@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"test-project/audit"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+)
+
+// @Summary Get audit log
+// @Description Get audit entries for an entity, newest first, with pagination
+// @Tags audit
+// @Produce json
+// @Param entity query string true "Entity type (user, task or timesheet)"
+// @Param id query int false "Entity ID"
+// @Param page query int false "Page number"
+// @Param limit query int false "Results per page"
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /audit [get]
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetAuditLog called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	entity := r.URL.Query().Get("entity")
+	if entity != audit.EntityUser && entity != audit.EntityTask && entity != audit.EntityTimesheet {
+		logger.Warning("Invalid audit entity: %q", entity)
+		http.Error(w, "entity must be user, task or timesheet", http.StatusBadRequest)
+		return
+	}
+
+	query := "WHERE entity = $1"
+	args := []interface{}{entity}
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			logger.Warning("Invalid entity ID: %v", err)
+			http.Error(w, "Invalid entity ID", http.StatusBadRequest)
+			return
+		}
+		query += " AND entity_id = $2"
+		args = append(args, id)
+	}
+
+	writeAuditEntries(ctx, w, r, query, args)
+}
+
+// @Summary Get user history
+// @Description Get audit entries for a user and their tasks, newest first
+// @Tags audit
+// @Produce json
+// @Param id path int true "User ID"
+// @Param page query int false "Page number"
+// @Param limit query int false "Results per page"
+// @Success 200 {array} models.AuditEntry
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/history [get]
+func GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetUserHistory called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		logger.Warning("Invalid user ID: %v", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	writeAuditEntries(ctx, w, r, "WHERE user_id = $1", []interface{}{id})
+}
+
+func writeAuditEntries(ctx context.Context, w http.ResponseWriter, r *http.Request, where string, args []interface{}) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 10
+	}
+	offset := (page - 1) * limit
+
+	query := fmt.Sprintf(`
+		SELECT id, entity, entity_id, COALESCE(user_id, 0), action, actor, COALESCE(request_id, ''), before, after, diff, created_at
+		FROM audit_log
+		%s AND organization_id = $%d
+		ORDER BY id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)+1, len(args)+2, len(args)+3)
+	args = append(args, tenant(ctx), limit, offset)
+
+	rows, err := database.From(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		var (
+			entry               models.AuditEntry
+			before, after, diff sql.NullString
+		)
+		if err = rows.Scan(&entry.ID, &entry.Entity, &entry.EntityID, &entry.UserID, &entry.Action, &entry.Actor, &entry.RequestID, &before, &after, &diff, &entry.CreatedAt); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		if diff.Valid {
+			entry.Diff = json.RawMessage(diff.String)
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(entries); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
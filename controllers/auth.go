@@ -0,0 +1,11 @@
+package controllers
+
+import (
+	"net/http"
+	"test-project/middleware"
+)
+
+// isAdmin reports whether the request carries the configured admin token as a bearer token.
+func isAdmin(r *http.Request) bool {
+	return middleware.IsAdmin(r.Context())
+}
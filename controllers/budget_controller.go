@@ -0,0 +1,541 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-project/billing"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+const (
+	alertScopeProject = "project"
+	alertScopeUser    = "user"
+
+	alertKindMinutes = "minutes"
+	alertKindAmount  = "amount"
+)
+
+// budgetThresholds are the percentages of a budget at which alerts fire.
+var budgetThresholds = []int{80, 100}
+
+var errBudgetExhausted = errors.New("budget exhausted")
+
+// projectEpoch is the period start of project budgets, which never reset.
+var projectEpoch = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// @Summary Get a project budget
+// @Description Get the project's budget with the time and cost consumed so far. Running tasks count up to now.
+// @Tags budgets
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.ProjectBudget
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id}/budget [get]
+func GetProjectBudget(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetProjectBudget called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	budget, err := loadProjectBudget(ctx, database.From(ctx), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error computing project budget: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(budget); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Set a project budget
+// @Description Set the project's budget in minutes, in money (minor units of currency) or both. Omitting both removes the budget. A hard budget refuses new timers once exhausted.
+// @Tags budgets
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param budget body models.ProjectBudget true "Budget"
+// @Success 200 {object} models.ProjectBudget
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id}/budget [put]
+func SetProjectBudget(w http.ResponseWriter, r *http.Request) {
+	logger.Info("SetProjectBudget called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ProjectBudget
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if (req.Minutes != nil && *req.Minutes <= 0) || (req.Amount != nil && *req.Amount <= 0) {
+		http.Error(w, "minutes and amount must be positive", http.StatusBadRequest)
+		return
+	}
+	var currency sql.NullString
+	if req.Amount != nil {
+		req.Currency = strings.ToUpper(req.Currency)
+		if req.Currency == "" {
+			req.Currency = cfg.Billing.Currency
+		}
+		if !currencyCode.MatchString(req.Currency) {
+			http.Error(w, "currency must be a three-letter ISO 4217 code", http.StatusBadRequest)
+			return
+		}
+		currency = sql.NullString{String: req.Currency, Valid: true}
+	}
+
+	var exists bool
+	if err = database.From(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM projects WHERE id = $1 AND organization_id = $2)", id, tenant(ctx)).Scan(&exists); err != nil {
+		logger.Error("Error querying project: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Minutes == nil && req.Amount == nil {
+		_, err = database.From(ctx).ExecContext(ctx, "DELETE FROM project_budgets WHERE project_id = $1", id)
+	} else {
+		_, err = database.From(ctx).ExecContext(ctx, `
+			INSERT INTO project_budgets (project_id, minutes, amount, currency, hard, updated_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())
+			ON CONFLICT (project_id) DO UPDATE
+			SET minutes = EXCLUDED.minutes, amount = EXCLUDED.amount, currency = EXCLUDED.currency,
+				hard = EXCLUDED.hard, updated_at = EXCLUDED.updated_at`,
+			id, req.Minutes, req.Amount, currency, req.Hard)
+	}
+	if err != nil {
+		logger.Error("Error saving project budget: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Budget of project %d updated", id)
+
+	budget, err := loadProjectBudget(ctx, database.From(ctx), id)
+	if err != nil {
+		logger.Error("Error computing project budget: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	checkBudgetAlerts(ctx, 0, &id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(budget); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get a user's weekly limit
+// @Description Get the user's weekly hour limit and the time tracked in the week containing date (default today)
+// @Tags budgets
+// @Produce json
+// @Param id path int true "User ID"
+// @Param date query string false "Any day of the week (YYYY-MM-DD)"
+// @Success 200 {object} models.UserWeeklyLimit
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/budget [get]
+func GetUserBudget(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetUserBudget called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	at := time.Now().UTC()
+	if v := r.URL.Query().Get("date"); v != "" {
+		if at, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid date format, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		at = at.Add(12 * time.Hour)
+	}
+
+	limit, err := loadUserWeeklyLimit(ctx, database.From(ctx), id, at)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error computing weekly limit: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(limit); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Set a user's weekly limit
+// @Description Set the user's weekly limit in minutes, or remove it by omitting minutes. A hard limit refuses new timers once reached.
+// @Tags budgets
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param limit body models.UserWeeklyLimit true "Weekly limit"
+// @Success 200 {object} models.UserWeeklyLimit
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/budget [put]
+func SetUserBudget(w http.ResponseWriter, r *http.Request) {
+	logger.Info("SetUserBudget called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UserWeeklyLimit
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if req.Minutes != nil && (*req.Minutes <= 0 || *req.Minutes > 7*24*60) {
+		http.Error(w, "minutes must be between 1 and 10080", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err = database.From(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL)", id, tenant(ctx)).Scan(&exists); err != nil {
+		logger.Error("Error querying user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Minutes == nil {
+		_, err = database.From(ctx).ExecContext(ctx, "DELETE FROM user_weekly_limits WHERE user_id = $1", id)
+	} else {
+		_, err = database.From(ctx).ExecContext(ctx, `
+			INSERT INTO user_weekly_limits (user_id, minutes, hard, updated_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (user_id) DO UPDATE
+			SET minutes = EXCLUDED.minutes, hard = EXCLUDED.hard, updated_at = EXCLUDED.updated_at`,
+			id, *req.Minutes, req.Hard)
+	}
+	if err != nil {
+		logger.Error("Error saving weekly limit: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Weekly limit of user %d updated", id)
+
+	limit, err := loadUserWeeklyLimit(ctx, database.From(ctx), id, time.Now().UTC())
+	if err != nil {
+		logger.Error("Error computing weekly limit: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	checkBudgetAlerts(ctx, id, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(limit); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get budget alerts
+// @Description Get the 80% and 100% threshold crossings of project budgets and weekly limits, newest first
+// @Tags budgets
+// @Produce json
+// @Param scope query string false "project or user"
+// @Param id query int false "Project or user ID"
+// @Success 200 {array} models.BudgetAlert
+// @Failure 500 {object} models.ErrorResponse
+// @Router /budget-alerts [get]
+func GetBudgetAlerts(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetBudgetAlerts called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	scope := r.URL.Query().Get("scope")
+	scopeID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT id, scope, scope_id, kind, threshold, period_start, budget, consumed, created_at
+		FROM budget_alerts
+		WHERE ($1 = '' OR scope = $1) AND ($2 = 0 OR scope_id = $2) AND organization_id = $3
+		ORDER BY id DESC
+		LIMIT 500`, scope, scopeID, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	alerts := make([]models.BudgetAlert, 0)
+	for rows.Next() {
+		var alert models.BudgetAlert
+		if err = rows.Scan(&alert.ID, &alert.Scope, &alert.ScopeID, &alert.Kind, &alert.Threshold, &alert.PeriodStart, &alert.Budget, &alert.Consumed, &alert.CreatedAt); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		alerts = append(alerts, alert)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(alerts); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// loadProjectBudget returns the project's budget and consumption. It returns
+// sql.ErrNoRows if the project does not exist.
+func loadProjectBudget(ctx context.Context, q dbQuerier, projectID int) (models.ProjectBudget, error) {
+	budget := models.ProjectBudget{ProjectID: projectID}
+	var (
+		minutes  sql.NullInt64
+		amount   sql.NullInt64
+		currency sql.NullString
+	)
+	err := q.QueryRowContext(ctx, `
+		SELECT b.minutes, b.amount, b.currency, COALESCE(b.hard, FALSE)
+		FROM projects p
+		LEFT JOIN project_budgets b ON b.project_id = p.id
+		WHERE p.id = $1 AND p.organization_id = $2`, projectID, tenant(ctx)).Scan(&minutes, &amount, &currency, &budget.Hard)
+	if err != nil {
+		return budget, err
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT FLOOR(EXTRACT(EPOCH FROM COALESCE(t.end_time, NOW()) - t.start_time) / 60)::INTEGER,
+			t.billable, rate.amount, COALESCE(rate.currency, '')
+		FROM tasks t`+rateLateral+`
+		WHERE t.project_id = $1`, projectID)
+	if err != nil {
+		return budget, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			taskMinutes  int
+			billable     bool
+			rateAmount   sql.NullInt64
+			rateCurrency string
+		)
+		if err = rows.Scan(&taskMinutes, &billable, &rateAmount, &rateCurrency); err != nil {
+			return budget, err
+		}
+		budget.ConsumedMinutes += taskMinutes
+		if billable && rateAmount.Valid && currency.Valid && rateCurrency == currency.String {
+			budget.ConsumedAmount += billing.Cost(billing.RoundMinutes(taskMinutes, cfg.Billing), rateAmount.Int64)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return budget, err
+	}
+
+	if minutes.Valid {
+		m := int(minutes.Int64)
+		remaining := m - budget.ConsumedMinutes
+		budget.Minutes = &m
+		budget.RemainingMinutes = &remaining
+	}
+	if amount.Valid {
+		remaining := amount.Int64 - budget.ConsumedAmount
+		budget.Amount = &amount.Int64
+		budget.Currency = currency.String
+		budget.RemainingAmount = &remaining
+	}
+	return budget, nil
+}
+
+// loadUserWeeklyLimit returns the user's weekly limit and the time tracked in
+// the week containing at. It returns sql.ErrNoRows if the user does not exist.
+func loadUserWeeklyLimit(ctx context.Context, q dbQuerier, userID int, at time.Time) (models.UserWeeklyLimit, error) {
+	limit := models.UserWeeklyLimit{UserID: userID}
+	var (
+		minutes  sql.NullInt64
+		timezone string
+	)
+	err := q.QueryRowContext(ctx, `
+		SELECT l.minutes, COALESCE(l.hard, FALSE), u.timezone
+		FROM users u
+		LEFT JOIN user_weekly_limits l ON l.user_id = u.id
+		WHERE u.id = $1 AND u.organization_id = $2 AND u.deleted_at IS NULL`, userID, tenant(ctx)).Scan(&minutes, &limit.Hard, &timezone)
+	if err != nil {
+		return limit, err
+	}
+
+	limit.WeekStart = weekStart(at, timezone)
+	err = q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(FLOOR(EXTRACT(EPOCH FROM COALESCE(end_time, NOW()) - start_time) / 60)), 0)::INTEGER
+		FROM tasks
+		WHERE user_id = $1 AND start_time >= $2 AND start_time < $3`,
+		userID, limit.WeekStart, limit.WeekStart.AddDate(0, 0, 7)).Scan(&limit.ConsumedMinutes)
+	if err != nil {
+		return limit, err
+	}
+
+	if minutes.Valid {
+		m := int(minutes.Int64)
+		remaining := m - limit.ConsumedMinutes
+		limit.Minutes = &m
+		limit.RemainingMinutes = &remaining
+	}
+	return limit, nil
+}
+
+// weekStart returns midnight of the Monday on or before at in timezone.
+func weekStart(at time.Time, timezone string) time.Time {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+	offset := (int(local.Weekday()) + 6) % 7
+	return time.Date(local.Year(), local.Month(), local.Day()-offset, 0, 0, 0, 0, loc)
+}
+
+// checkStartBudget is run before starting a timer. It returns
+// errBudgetExhausted if a hard project budget or weekly limit is used up, and
+// otherwise a warning for each soft one that is.
+func checkStartBudget(ctx context.Context, tx *sql.Tx, userID int, projectID *int) ([]string, error) {
+	var warnings []string
+	exhausted := func(hard bool, what string) error {
+		if hard {
+			return fmt.Errorf("%w: %s", errBudgetExhausted, what)
+		}
+		warnings = append(warnings, what+" exhausted")
+		return nil
+	}
+
+	limit, err := loadUserWeeklyLimit(ctx, tx, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if limit.RemainingMinutes != nil && *limit.RemainingMinutes <= 0 {
+		if err = exhausted(limit.Hard, "weekly hour limit"); err != nil {
+			return nil, err
+		}
+	}
+
+	if projectID == nil {
+		return warnings, nil
+	}
+	budget, err := loadProjectBudget(ctx, tx, *projectID)
+	if err != nil {
+		return nil, err
+	}
+	if budget.RemainingMinutes != nil && *budget.RemainingMinutes <= 0 {
+		if err = exhausted(budget.Hard, "project hour budget"); err != nil {
+			return nil, err
+		}
+	}
+	if budget.RemainingAmount != nil && *budget.RemainingAmount <= 0 {
+		if err = exhausted(budget.Hard, "project money budget"); err != nil {
+			return nil, err
+		}
+	}
+	return warnings, nil
+}
+
+// checkBudgetAlerts records threshold crossings of the user's weekly limit
+// (skipped when userID is 0) and of the project's budget. It runs after the
+// triggering change has committed, so failures are only logged.
+func checkBudgetAlerts(ctx context.Context, userID int, projectID *int) {
+	if userID != 0 {
+		limit, err := loadUserWeeklyLimit(ctx, database.From(ctx), userID, time.Now().UTC())
+		if err != nil {
+			logger.Error("Error checking weekly limit of user %d: %v", userID, err)
+		} else if limit.Minutes != nil {
+			recordBudgetAlerts(ctx, alertScopeUser, userID, alertKindMinutes, limit.WeekStart, int64(*limit.Minutes), int64(limit.ConsumedMinutes))
+		}
+	}
+
+	if projectID == nil {
+		return
+	}
+	budget, err := loadProjectBudget(ctx, database.From(ctx), *projectID)
+	if err != nil {
+		logger.Error("Error checking budget of project %d: %v", *projectID, err)
+		return
+	}
+	if budget.Minutes != nil {
+		recordBudgetAlerts(ctx, alertScopeProject, *projectID, alertKindMinutes, projectEpoch, int64(*budget.Minutes), int64(budget.ConsumedMinutes))
+	}
+	if budget.Amount != nil {
+		recordBudgetAlerts(ctx, alertScopeProject, *projectID, alertKindAmount, projectEpoch, *budget.Amount, budget.ConsumedAmount)
+	}
+}
+
+func recordBudgetAlerts(ctx context.Context, scope string, scopeID int, kind string, periodStart time.Time, budget, consumed int64) {
+	for _, threshold := range budgetThresholds {
+		if consumed*100 < budget*int64(threshold) {
+			return
+		}
+		result, err := database.From(ctx).ExecContext(ctx, `
+			INSERT INTO budget_alerts (organization_id, scope, scope_id, kind, threshold, period_start, budget, consumed)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT DO NOTHING`,
+			tenant(ctx), scope, scopeID, kind, threshold, periodStart.Format("2006-01-02"), budget, consumed)
+		if err != nil {
+			logger.Error("Error recording budget alert for %s %d: %v", scope, scopeID, err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			logger.Warning("Budget alert: %s %d reached %d%% of its %s budget (%d of %d)", scope, scopeID, threshold, kind, consumed, budget)
+		}
+	}
+}
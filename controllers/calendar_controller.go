@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"test-project/database"
+	"test-project/ical"
+	"test-project/logger"
+	"test-project/models"
+)
+
+// maxCalendarSize bounds an imported iCalendar file.
+const maxCalendarSize = 1 << 20
+
+// @Summary Get holiday calendars
+// @Description Get all holiday calendars, without their holidays
+// @Tags calendars
+// @Produce json
+// @Success 200 {array} models.HolidayCalendar
+// @Failure 500 {object} models.ErrorResponse
+// @Router /calendars [get]
+func GetHolidayCalendars(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetHolidayCalendars called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT id, name, created_at, updated_at FROM holiday_calendars WHERE organization_id = $1 ORDER BY name", tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	calendars := make([]models.HolidayCalendar, 0)
+	for rows.Next() {
+		var calendar models.HolidayCalendar
+		if err = rows.Scan(&calendar.ID, &calendar.Name, &calendar.CreatedAt, &calendar.UpdatedAt); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		calendars = append(calendars, calendar)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(calendars); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get a holiday calendar
+// @Description Get a holiday calendar with its holidays, optionally limited to one year
+// @Tags calendars
+// @Produce json
+// @Param id path int true "Calendar ID"
+// @Param year query int false "Only holidays in this year"
+// @Success 200 {object} models.HolidayCalendar
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /calendars/{id} [get]
+func GetHolidayCalendar(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetHolidayCalendar called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid calendar ID", http.StatusBadRequest)
+		return
+	}
+	year := 0
+	if v := r.URL.Query().Get("year"); v != "" {
+		if year, err = strconv.Atoi(v); err != nil || year < 1 || year > 9999 {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var calendar models.HolidayCalendar
+	err = database.From(ctx).QueryRowContext(ctx, "SELECT id, name, created_at, updated_at FROM holiday_calendars WHERE id = $1 AND organization_id = $2", id, tenant(ctx)).
+		Scan(&calendar.ID, &calendar.Name, &calendar.CreatedAt, &calendar.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Calendar not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying calendar: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT to_char(day, 'YYYY-MM-DD'), name
+		FROM holidays
+		WHERE calendar_id = $1 AND ($2 = 0 OR EXTRACT(YEAR FROM day) = $2)
+		ORDER BY day`, id, year)
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	calendar.Holidays = make([]models.Holiday, 0)
+	for rows.Next() {
+		var holiday models.Holiday
+		if err = rows.Scan(&holiday.Date, &holiday.Name); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		calendar.Holidays = append(calendar.Holidays, holiday)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(calendar); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Create a holiday calendar
+// @Description Create an empty holiday calendar. Holidays are added by importing an iCalendar file.
+// @Tags calendars
+// @Accept json
+// @Produce json
+// @Param calendar body models.HolidayCalendar true "Calendar name"
+// @Success 201 {object} models.HolidayCalendar
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /calendars [post]
+func CreateHolidayCalendar(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateHolidayCalendar called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var calendar models.HolidayCalendar
+	if err := json.NewDecoder(r.Body).Decode(&calendar); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if calendar.Name == "" || len(calendar.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	err := database.From(ctx).QueryRowContext(ctx, `
+		INSERT INTO holiday_calendars (organization_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at`, tenant(ctx), calendar.Name).
+		Scan(&calendar.ID, &calendar.CreatedAt, &calendar.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			http.Error(w, "Calendar already exists", http.StatusConflict)
+		} else {
+			logger.Error("Error inserting calendar: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	calendar.Holidays = nil
+	logger.Info("Holiday calendar %d created", calendar.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(calendar); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a holiday calendar
+// @Description Delete a holiday calendar and its holidays. Users following it fall back to no holidays.
+// @Tags calendars
+// @Param id path int true "Calendar ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /calendars/{id} [delete]
+func DeleteHolidayCalendar(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteHolidayCalendar called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid calendar ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "DELETE FROM holiday_calendars WHERE id = $1 AND organization_id = $2", id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error deleting calendar: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Import holidays
+// @Description Add the events of an iCalendar file to a holiday calendar. All-day events cover each of their days; timed events cover the day they start on, in their own timezone. Recurring events are skipped. With replace, the calendar's existing holidays are removed first.
+// @Tags calendars
+// @Accept text/calendar
+// @Produce json
+// @Param id path int true "Calendar ID"
+// @Param replace query bool false "Replace all existing holidays"
+// @Success 200 {object} models.HolidayImport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /calendars/{id}/import [post]
+func ImportHolidays(w http.ResponseWriter, r *http.Request) {
+	logger.Info("ImportHolidays called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid calendar ID", http.StatusBadRequest)
+		return
+	}
+	replace := r.URL.Query().Get("replace") == "true"
+
+	events, err := ical.Parse(http.MaxBytesReader(w, r.Body, maxCalendarSize))
+	if err != nil {
+		logger.Warning("Invalid iCalendar file: %v", err)
+		http.Error(w, "Invalid iCalendar file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := models.HolidayImport{CalendarID: id}
+	holidays := make(map[string]string)
+	for _, event := range events {
+		if event.Recurring {
+			result.Skipped++
+			continue
+		}
+		for _, day := range event.Days() {
+			holidays[day.Format("2006-01-02")] = event.Summary
+		}
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM holiday_calendars WHERE id = $1 AND organization_id = $2)", id, tenant(ctx)).Scan(&exists); err != nil {
+		logger.Error("Error querying calendar: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	}
+
+	if replace {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM holidays WHERE calendar_id = $1", id); err != nil {
+			logger.Error("Error clearing holidays: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for day, name := range holidays {
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO holidays (calendar_id, day, name)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (calendar_id, day) DO UPDATE SET name = EXCLUDED.name`, id, day, name)
+		if err != nil {
+			logger.Error("Error inserting holiday: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Imported++
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE holiday_calendars SET updated_at = NOW() WHERE id = $1", id); err != nil {
+		logger.Error("Error updating calendar: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("Error committing transaction: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Imported %d holidays into calendar %d", result.Imported, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
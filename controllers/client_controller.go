@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+// @Summary Get clients
+// @Description Get all clients
+// @Tags clients
+// @Produce json
+// @Success 200 {array} models.Client
+// @Failure 500 {object} models.ErrorResponse
+// @Router /clients [get]
+func GetClients(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetClients called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT id, name, created_at, updated_at FROM clients WHERE organization_id = $1 ORDER BY id", tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	clients := make([]models.Client, 0)
+	for rows.Next() {
+		var client models.Client
+		if err = rows.Scan(&client.ID, &client.Name, &client.CreatedAt, &client.UpdatedAt); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		clients = append(clients, client)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(clients); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get a client
+// @Description Get a client by ID
+// @Tags clients
+// @Produce json
+// @Param id path int true "Client ID"
+// @Success 200 {object} models.Client
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /clients/{id} [get]
+func GetClient(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetClient called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+		return
+	}
+
+	var client models.Client
+	err = database.From(ctx).QueryRowContext(ctx, "SELECT id, name, created_at, updated_at FROM clients WHERE id = $1 AND organization_id = $2", id, tenant(ctx)).
+		Scan(&client.ID, &client.Name, &client.CreatedAt, &client.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Client not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying client: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(client); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Create a client
+// @Description Create a new client
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param client body models.Client true "Client"
+// @Success 201 {object} models.Client
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /clients [post]
+func CreateClient(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateClient called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var client models.Client
+	if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if client.Name == "" || len(client.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	client.CreatedAt = time.Now().UTC()
+	client.UpdatedAt = client.CreatedAt
+	err := database.From(ctx).QueryRowContext(ctx, "INSERT INTO clients (organization_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		tenant(ctx), client.Name, client.CreatedAt, client.UpdatedAt).Scan(&client.ID)
+	if err != nil {
+		logger.Error("Error inserting client: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Client created with ID %d", client.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(client); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Update a client
+// @Description Rename a client
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param id path int true "Client ID"
+// @Param client body models.Client true "Client"
+// @Success 200 {object} models.Client
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /clients/{id} [patch]
+func UpdateClient(w http.ResponseWriter, r *http.Request) {
+	logger.Info("UpdateClient called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+		return
+	}
+
+	var client models.Client
+	if err = json.NewDecoder(r.Body).Decode(&client); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if client.Name == "" || len(client.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	err = database.From(ctx).QueryRowContext(ctx, "UPDATE clients SET name = $1, updated_at = $2 WHERE id = $3 AND organization_id = $4 RETURNING id, name, created_at, updated_at",
+		client.Name, time.Now().UTC(), id, tenant(ctx)).Scan(&client.ID, &client.Name, &client.CreatedAt, &client.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Client not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error updating client: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(client); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a client
+// @Description Delete a client that has no projects
+// @Tags clients
+// @Param id path int true "Client ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /clients/{id} [delete]
+func DeleteClient(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteClient called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+		return
+	}
+
+	var projects int
+	if err = database.From(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM projects WHERE client_id = $1 AND organization_id = $2", id, tenant(ctx)).Scan(&projects); err != nil {
+		logger.Error("Error counting projects: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if projects > 0 {
+		http.Error(w, "Client still has projects", http.StatusConflict)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "DELETE FROM clients WHERE id = $1 AND organization_id = $2", id, tenant(ctx))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		http.Error(w, "Client has invoices", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Error("Error deleting client: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("Client %d deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
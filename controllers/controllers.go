@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"test-project/config"
+	"time"
+)
+
+var cfg = &config.Config{Database: config.DatabaseConfig{QueryTimeout: 5 * time.Second}}
+
+// Init injects the application configuration into the handlers.
+func Init(c *config.Config) {
+	cfg = c
+	setMigrationsPath(c.Database.MigrationsPath)
+}
+
+// dbQuerier is satisfied by both *sql.DB and *sql.Tx, for helpers that run
+// inside or outside a transaction.
+type dbQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// queryContext derives a context bounded by the configured query timeout from
+// the request. Background jobs are bounded by their own timeout instead.
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if inJob(r.Context()) {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), cfg.Database.QueryTimeout)
+}
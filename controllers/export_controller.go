@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-project/database"
+	"test-project/export"
+	"test-project/logger"
+	"test-project/parquet"
+	"time"
+)
+
+// exportFetchSize is the number of rows fetched from the cursor at a time.
+const exportFetchSize = 1000
+
+var userExportColumns = []export.Column{
+	{Name: "id", Type: parquet.Int64},
+	{Name: "organizationId", Type: parquet.Int64},
+	{Name: "passport_number", Type: parquet.String},
+	{Name: "surname", Type: parquet.String},
+	{Name: "name", Type: parquet.String},
+	{Name: "patronymic", Type: parquet.String},
+	{Name: "address", Type: parquet.String},
+	{Name: "timezone", Type: parquet.String},
+	{Name: "maxTaskMinutes", Type: parquet.Int64, Optional: true},
+	{Name: "createdAt", Type: parquet.Timestamp},
+	{Name: "updatedAt", Type: parquet.Timestamp},
+}
+
+var taskExportColumns = []export.Column{
+	{Name: "id", Type: parquet.Int64},
+	{Name: "userId", Type: parquet.Int64},
+	{Name: "projectId", Type: parquet.Int64, Optional: true},
+	{Name: "name", Type: parquet.String, Optional: true},
+	{Name: "hours", Type: parquet.Int64, Optional: true},
+	{Name: "minutes", Type: parquet.Int64, Optional: true},
+	{Name: "startTime", Type: parquet.Timestamp},
+	{Name: "endTime", Type: parquet.Timestamp, Optional: true},
+	{Name: "autoStopped", Type: parquet.Bool},
+	{Name: "billable", Type: parquet.Bool},
+	{Name: "invoiceId", Type: parquet.Int64, Optional: true},
+	{Name: "notes", Type: parquet.String, Optional: true},
+	{Name: "tags", Type: parquet.String},
+	{Name: "createdAt", Type: parquet.Timestamp},
+	{Name: "updatedAt", Type: parquet.Timestamp},
+}
+
+// @Summary Export users
+// @Description Stream every user of the organization, like GET /users without paging, as CSV, JSON Lines or Parquet. The response is gzip-compressed when the client accepts it.
+// @Tags users
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.apache.parquet
+// @Param format query string false "csv (default), ndjson or parquet"
+// @Success 200 {file} file
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/export [get]
+func ExportUsers(w http.ResponseWriter, r *http.Request) {
+	logger.Info("ExportUsers called")
+
+	query := `
+		SELECT id, organization_id, passport_number, surname, name, patronymic, address, timezone, max_task_minutes, created_at, updated_at
+		FROM users
+		WHERE deleted_at IS NULL AND organization_id = $1
+		ORDER BY id`
+
+	streamExport(w, r, "users", userExportColumns, query, []interface{}{tenant(r.Context())}, func(rows *sql.Rows) ([]interface{}, error) {
+		var (
+			id, orgID                                    int64
+			passport, surname, name, patronymic, address string
+			timezone                                     string
+			maxTaskMinutes                               sql.NullInt64
+			createdAt, updatedAt                         time.Time
+		)
+		if err := rows.Scan(&id, &orgID, &passport, &surname, &name, &patronymic, &address, &timezone, &maxTaskMinutes, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		return []interface{}{id, orgID, passport, surname, name, patronymic, address, timezone, nullInt(maxTaskMinutes), createdAt, updatedAt}, nil
+	})
+}
+
+// @Summary Export tasks
+// @Description Stream the tasks of every user of the organization, or of one user, as CSV, JSON Lines or Parquet. The date range and tag filters are those of GET /users/{id}/tasks, with dates in each user's timezone. Tags are comma-separated. The response is gzip-compressed when the client accepts it.
+// @Tags tasks
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.apache.parquet
+// @Param format query string false "csv (default), ndjson or parquet"
+// @Param userId query int false "Only this user's tasks"
+// @Param startTime query string false "Start date (YYYY-MM-DD)"
+// @Param endTime query string false "End date (YYYY-MM-DD)"
+// @Param tags query string false "Comma-separated tag names to filter by"
+// @Param match query string false "Tag match mode: any (default) or all"
+// @Success 200 {file} file
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tasks/export [get]
+func ExportTasks(w http.ResponseWriter, r *http.Request) {
+	logger.Info("ExportTasks called")
+
+	filter, err := parseUserTaskFilter(r, time.UTC)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		SELECT t.id, t.user_id, t.project_id, t.name, t.hours, t.minutes, t.start_time, t.end_time, t.auto_stopped, t.billable, t.invoice_id, t.notes,
+			COALESCE((SELECT string_agg(g.name, ',' ORDER BY g.name) FROM task_tags tt JOIN tags g ON g.id = tt.tag_id WHERE tt.task_id = t.id), ''),
+			t.created_at, t.updated_at
+		FROM tasks t
+		JOIN users u ON u.id = t.user_id
+		WHERE u.deleted_at IS NULL AND u.organization_id = $1`
+	args := []interface{}{tenant(r.Context())}
+
+	if v := r.URL.Query().Get("userId"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		args = append(args, userID)
+		query += fmt.Sprintf(` AND t.user_id = $%d`, len(args))
+	}
+	if !filter.startDate.IsZero() {
+		args = append(args, filter.startDate.Format("2006-01-02"), filter.endDate.Format("2006-01-02"))
+		query += fmt.Sprintf(`
+		AND t.start_time >= ($%d::date::timestamp AT TIME ZONE u.timezone)
+		AND t.end_time <= ($%d::date::timestamp AT TIME ZONE u.timezone)`, len(args)-1, len(args))
+	}
+	if len(filter.tags) > 0 {
+		args = append(args, pq.Array(filter.tags))
+		tagFilter := fmt.Sprintf(`
+		SELECT tt.task_id FROM task_tags tt
+		JOIN tags g ON g.id = tt.tag_id
+		WHERE g.name = ANY($%d)`, len(args))
+		if filter.matchAll {
+			args = append(args, len(filter.tags))
+			tagFilter += fmt.Sprintf(`
+		GROUP BY tt.task_id
+		HAVING COUNT(DISTINCT g.id) = $%d`, len(args))
+		}
+		query += ` AND t.id IN (` + tagFilter + `)`
+	}
+	query += ` ORDER BY t.id`
+
+	streamExport(w, r, "tasks", taskExportColumns, query, args, func(rows *sql.Rows) ([]interface{}, error) {
+		var (
+			id, userID                           int64
+			projectID, hours, minutes, invoiceID sql.NullInt64
+			name, notes                          sql.NullString
+			startTime                            time.Time
+			endTime                              sql.NullTime
+			autoStopped, billable                bool
+			tags                                 string
+			createdAt, updatedAt                 time.Time
+		)
+		err := rows.Scan(&id, &userID, &projectID, &name, &hours, &minutes, &startTime, &endTime, &autoStopped, &billable, &invoiceID, &notes, &tags, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		var end interface{}
+		if endTime.Valid {
+			end = endTime.Time
+		}
+		return []interface{}{id, userID, nullInt(projectID), nullString(name), nullInt(hours), nullInt(minutes), startTime, end, autoStopped, billable, nullInt(invoiceID), nullString(notes), tags, createdAt, updatedAt}, nil
+	})
+}
+
+// streamExport runs query through a server-side cursor and writes each row
+// returned by scan in the format the request asks for, so that memory use
+// does not depend on the number of rows. Once the first rows are sent an
+// error can no longer be reported, so the response is aborted instead.
+func streamExport(w http.ResponseWriter, r *http.Request, name string, columns []export.Column, query string, args []interface{}, scan func(*sql.Rows) ([]interface{}, error)) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	contentType := export.ContentType(format)
+	if contentType == "" {
+		http.Error(w, "format must be csv, ndjson or parquet", http.StatusBadRequest)
+		return
+	}
+
+	// The export runs as long as the client keeps reading; only single
+	// fetches are bounded by the query timeout.
+	ctx := r.Context()
+	tx, err := database.From(ctx).BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		logger.Error("Error declaring export cursor: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	w.Header().Add("Vary", "Accept-Encoding")
+	var out io.Writer = w
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	rc := http.NewResponseController(w)
+
+	writer, err := export.NewWriter(format, out, columns)
+	total := 0
+	for err == nil {
+		// Each batch gets a fresh write deadline, so large exports are not cut
+		// off by the server's write timeout while the client keeps reading.
+		if err = rc.SetWriteDeadline(time.Now().Add(cfg.Server.WriteTimeout)); errors.Is(err, http.ErrNotSupported) {
+			err = nil
+		}
+		var n int
+		if n, err = fetchExportRows(ctx, tx, writer, scan); err != nil || n == 0 {
+			break
+		}
+		total += n
+		reportProgress(ctx, int64(total), 0)
+		if err = writer.Flush(); err == nil {
+			if gz, ok := out.(*gzip.Writer); ok {
+				err = gz.Flush()
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		logger.Error("Error exporting %s after %d rows: %v", name, total, err)
+		panic(http.ErrAbortHandler)
+	}
+	logger.Info("Exported %d %s as %s", total, name, format)
+}
+
+// fetchExportRows writes the next batch of rows from the export cursor and
+// returns how many there were.
+func fetchExportRows(ctx context.Context, tx *sql.Tx, writer export.Writer, scan func(*sql.Rows) ([]interface{}, error)) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportFetchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		row, err := scan(rows)
+		if err != nil {
+			return n, err
+		}
+		if err = writer.Write(row); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+func nullInt(v sql.NullInt64) interface{} {
+	if v.Valid {
+		return v.Int64
+	}
+	return nil
+}
+
+func nullString(v sql.NullString) interface{} {
+	if v.Valid {
+		return v.String
+	}
+	return nil
+}
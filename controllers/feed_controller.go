@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-project/database"
+	"test-project/ical"
+	"test-project/logger"
+	"test-project/middleware"
+	"test-project/models"
+	"time"
+)
+
+// taskUIDDomain qualifies task UIDs so they stay unique across calendars.
+const taskUIDDomain = "tasks.test-project"
+
+// @Summary Get a user's tasks as iCalendar
+// @Description Render the user's tasks as VEVENTs, with the same date range and tag filters as the task list. Running tasks end now.
+// @Tags tasks
+// @Produce text/calendar
+// @Param id path int true "User ID"
+// @Param startTime query string false "Start date (YYYY-MM-DD)"
+// @Param endTime query string false "End date (YYYY-MM-DD)"
+// @Param tags query string false "Comma-separated tag names to filter by"
+// @Param match query string false "Tag match mode: any (default) or all"
+// @Success 200 {string} string "iCalendar stream"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/tasks.ics [get]
+func GetUserTasksCalendar(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetUserTasksCalendar called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	writeTaskCalendar(ctx, w, r, userID)
+}
+
+// @Summary Get a calendar feed
+// @Description Render the tasks of the user owning the feed token as iCalendar, for calendar apps to subscribe to. No API token is needed; accepts the same query parameters as /users/{id}/tasks.ics.
+// @Tags tasks
+// @Produce text/calendar
+// @Param token path string true "Feed token"
+// @Success 200 {string} string "iCalendar stream"
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /feeds/{token}.ics [get]
+func GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetCalendarFeed called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	// The token names the user, so it is looked up before any organization is known.
+	var userID, orgID int
+	err := database.WithScope(ctx, database.SystemScope, func(ctx context.Context) error {
+		return database.From(ctx).QueryRowContext(ctx, "SELECT id, organization_id FROM users WHERE feed_token_hash = $1 AND deleted_at IS NULL",
+			hashToken(mux.Vars(r)["token"])).Scan(&userID, &orgID)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error resolving feed token: %v", err)
+			http.Error(w, "Error resolving feed", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ctx = middleware.WithOrganization(ctx, orgID)
+	err = database.WithScope(ctx, strconv.Itoa(orgID), func(ctx context.Context) error {
+		writeTaskCalendar(ctx, w, r, userID)
+		return nil
+	})
+	if err != nil {
+		logger.Error("Error scoping database connection: %v", err)
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+	}
+}
+
+// @Summary Create a calendar feed
+// @Description Create a secret feed URL for the user's tasks, replacing any previous one. The token is only returned once.
+// @Tags tasks
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 201 {object} models.CalendarFeed
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/feed [post]
+func CreateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateCalendarFeed called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	token := newToken("feed_")
+	result, err := database.From(ctx).ExecContext(ctx, "UPDATE users SET feed_token_hash = $1 WHERE id = $2 AND organization_id = $3 AND deleted_at IS NULL",
+		hashToken(token), userID, tenant(ctx))
+	if err != nil {
+		logger.Error("Error saving feed token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("Calendar feed of user %d created", userID)
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	feed := models.CalendarFeed{
+		UserID: userID,
+		Token:  token,
+		URL:    fmt.Sprintf("%s://%s/feeds/%s.ics", scheme, r.Host, token),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(feed); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Revoke a calendar feed
+// @Description Revoke the user's feed URL. Subscribed calendar apps stop receiving updates.
+// @Tags tasks
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/feed [delete]
+func RevokeCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RevokeCalendarFeed called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "UPDATE users SET feed_token_hash = NULL WHERE id = $1 AND organization_id = $2 AND feed_token_hash IS NOT NULL",
+		userID, tenant(ctx))
+	if err != nil {
+		logger.Error("Error revoking feed token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("Calendar feed of user %d revoked", userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTaskCalendar renders the user's tasks selected by the request's
+// filters as an iCalendar stream.
+func writeTaskCalendar(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int) {
+	var name, timezone string
+	err := database.From(ctx).QueryRowContext(ctx, "SELECT name || ' ' || surname, timezone FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL",
+		userID, tenant(ctx)).Scan(&name, &timezone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying user: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	filter, err := parseUserTaskFilter(r, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tasks, err := selectUserTasks(ctx, userID, filter, loc)
+	if err != nil {
+		logger.Error("Error selecting tasks: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	events := make([]ical.Event, 0, len(tasks))
+	for _, task := range tasks {
+		event := ical.Event{
+			UID:         fmt.Sprintf("task-%d@%s", task.ID, taskUIDDomain),
+			Summary:     task.Name,
+			Description: task.Notes,
+			Modified:    task.UpdatedAt,
+			Start:       task.StartTime,
+			End:         task.EndTime,
+		}
+		if event.Summary == "" {
+			event.Summary = "Untitled task"
+		}
+		if len(task.Tags) > 0 {
+			event.Description = strings.TrimSpace(event.Description + "\n\nTags: " + strings.Join(task.Tags, ", "))
+		}
+		if event.End.IsZero() {
+			event.End = now
+		}
+		events = append(events, event)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err = ical.Write(w, name+" tasks", events); err != nil {
+		logger.Error("Error writing calendar: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"test-project/database"
+	"test-project/logger"
+	"time"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+var shuttingDown atomic.Bool
+
+type healthCheck struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// CheckResult describes the outcome of a single readiness check.
+type CheckResult struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthReport is the JSON body returned by the health detail endpoint.
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// SetShuttingDown marks the service as draining so that /readyz starts failing.
+func SetShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// @Summary Liveness probe
+// @Description Reports that the process is up
+// @Tags health
+// @Produce plain
+// @Success 200
+// @Router /healthz [get]
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// @Summary Readiness probe
+// @Description Reports whether the service can take traffic
+// @Tags health
+// @Produce plain
+// @Success 200
+// @Failure 503
+// @Router /readyz [get]
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	report := runHealthChecks(r.Context())
+
+	w.Header().Set("Content-Type", "text/plain")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(report.Status))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// @Summary Health details
+// @Description Lists every readiness check with its status and latency
+// @Tags health
+// @Produce json
+// @Success 200 {object} controllers.HealthReport
+// @Failure 503 {object} controllers.HealthReport
+// @Router /health [get]
+func HealthDetails(w http.ResponseWriter, r *http.Request) {
+	report := runHealthChecks(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+func runHealthChecks(ctx context.Context) HealthReport {
+	checks := []healthCheck{
+		{"shutdown", checkNotShuttingDown},
+		{"database", checkDatabase},
+		{"migrations", checkMigrations},
+	}
+	if cfg.PeopleAPI.URL != "" {
+		checks = append(checks, healthCheck{"people_api", checkPeopleAPI})
+	}
+
+	report := HealthReport{Status: "ok"}
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		start := time.Now()
+		err := check.fn(checkCtx)
+		cancel()
+
+		result := CheckResult{
+			Name:      check.name,
+			Status:    "ok",
+			LatencyMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			logger.Warning("Health check %s failed: %v", check.name, err)
+			result.Status = "fail"
+			result.Error = err.Error()
+			report.Status = "fail"
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	return report
+}
+
+func checkNotShuttingDown(ctx context.Context) error {
+	if shuttingDown.Load() {
+		return fmt.Errorf("server is shutting down")
+	}
+	return nil
+}
+
+func checkDatabase(ctx context.Context) error {
+	if database.DB == nil {
+		return fmt.Errorf("database is not initialized")
+	}
+	return database.DB.PingContext(ctx)
+}
+
+func checkMigrations(ctx context.Context) error {
+	if database.DB == nil {
+		return fmt.Errorf("database is not initialized")
+	}
+	pending, err := database.PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("migrations not applied: %v", pending)
+	}
+	return nil
+}
+
+// checkPeopleAPI treats any non-5xx response as reachable: the /info endpoint
+// answers 400 without query parameters, which is enough to prove it is up.
+func checkPeopleAPI(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.PeopleAPI.URL+"/info", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("people api returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"test-project/audit"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"test-project/outbox"
+	"test-project/spreadsheet"
+	"time"
+)
+
+const (
+	maxImportSize      = 32 << 20
+	defaultImportBatch = 500
+	maxImportBatch     = 10000
+	// copyThreshold is the batch size from which users are loaded with COPY
+	// instead of one INSERT each.
+	copyThreshold = 1000
+
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// importColumns are the user fields an import can set, named by their default
+// column header. The first three are required.
+var importColumns = []string{"passport_number", "surname", "name", "patronymic", "address", "timezone", "max_task_minutes"}
+
+// importedUser is a validated user and the file row it came from.
+type importedUser struct {
+	row  int
+	user models.User
+}
+
+// @Summary Import users
+// @Description Create users from a CSV file or the first sheet of an XLSX workbook. The first row holds the column headers, which default to the field names; columns maps fields to other headers. Each row is validated like a new user. A dry run only reports per-row errors. In mode all (default) nothing is imported if any row is invalid; in mode batch valid rows are imported in transactions of batchSize rows and invalid ones are skipped.
+// @Tags users
+// @Accept text/csv
+// @Accept application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce json
+// @Param format query string false "csv or xlsx (default: from Content-Type)"
+// @Param columns query string false "Column mapping, e.g. surname=Last name,name=First name"
+// @Param dryRun query bool false "Validate only"
+// @Param mode query string false "all (default) or batch"
+// @Param batchSize query int false "Rows per transaction in batch mode (default 500)"
+// @Success 200 {object} models.UserImport
+// @Success 201 {object} models.UserImport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.UserImport
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/import [post]
+func ImportUsers(w http.ResponseWriter, r *http.Request) {
+	logger.Info("ImportUsers called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+		case "text/csv":
+			format = spreadsheet.FormatCSV
+		case xlsxContentType:
+			format = spreadsheet.FormatXLSX
+		}
+	}
+	if format != spreadsheet.FormatCSV && format != spreadsheet.FormatXLSX {
+		http.Error(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+	mode := query.Get("mode")
+	if mode == "" {
+		mode = "all"
+	}
+	if mode != "all" && mode != "batch" {
+		http.Error(w, "mode must be all or batch", http.StatusBadRequest)
+		return
+	}
+	batchSize := defaultImportBatch
+	if v := query.Get("batchSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxImportBatch {
+			http.Error(w, fmt.Sprintf("batchSize must be between 1 and %d", maxImportBatch), http.StatusBadRequest)
+			return
+		}
+		batchSize = n
+	}
+	mapping, err := parseColumnMapping(query.Get("columns"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		logger.Warning("Error reading import file: %v", err)
+		http.Error(w, fmt.Sprintf("Error reading file, the limit is %d MB", maxImportSize>>20), http.StatusBadRequest)
+		return
+	}
+	rows, err := spreadsheet.Read(format, data)
+	if err != nil {
+		logger.Warning("Invalid import file: %v", err)
+		http.Error(w, "Invalid "+format+" file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) == 0 {
+		http.Error(w, "The file has no header row", http.StatusBadRequest)
+		return
+	}
+	columns, err := importColumnIndexes(rows[0].Cells, mapping)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := models.UserImport{DryRun: query.Get("dryRun") == "true", Rows: len(rows) - 1, Errors: make([]models.ImportRowError, 0)}
+	users := validateImportRows(rows[1:], columns, &result)
+	if users, err = rejectExistingPassports(ctx, users, &result); err != nil {
+		logger.Error("Error checking existing passports: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result.Valid = len(users)
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+
+	status := http.StatusOK
+	switch {
+	case result.DryRun:
+	case mode == "all" && len(result.Errors) > 0:
+		status = http.StatusUnprocessableEntity
+	default:
+		if mode == "all" {
+			batchSize = len(users)
+		}
+		for start := 0; start < len(users); start += batchSize {
+			batch := users[start:min(start+batchSize, len(users))]
+			if err = insertImportedUsers(ctx, batch); err != nil {
+				logger.Error("Error importing users: %v", err)
+				if mode == "all" {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for _, u := range batch {
+					result.Errors = append(result.Errors, models.ImportRowError{Row: u.row, Error: "batch failed: " + err.Error()})
+				}
+				reportProgress(ctx, int64(start+len(batch)), int64(len(users)))
+				continue
+			}
+			result.Imported += len(batch)
+			reportProgress(ctx, int64(start+len(batch)), int64(len(users)))
+		}
+		if result.Imported > 0 {
+			status = http.StatusCreated
+		}
+		logger.Info("Imported %d of %d users", result.Imported, result.Rows)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// parseColumnMapping parses "field=Header,..." into headers keyed by field.
+func parseColumnMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if s == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, header, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		if !ok || !contains(importColumns, field) {
+			return nil, fmt.Errorf("invalid column mapping %q, fields are %s", pair, strings.Join(importColumns, ", "))
+		}
+		mapping[field] = strings.TrimSpace(header)
+	}
+	return mapping, nil
+}
+
+// importColumnIndexes returns the column of each field found in the header
+// row. Headers are matched case-insensitively.
+func importColumnIndexes(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := make(map[string]int)
+	for _, field := range importColumns {
+		name := field
+		if mapped, ok := mapping[field]; ok {
+			name = mapped
+		}
+		for i, cell := range header {
+			if strings.EqualFold(strings.TrimSpace(cell), name) {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	for _, field := range importColumns[:3] {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("Missing required column %s", field)
+		}
+	}
+	return columns, nil
+}
+
+// validateImportRows builds a user from each row and validates it like
+// CreateUser does, recording every problem in result. Passport numbers must
+// also be unique within the file.
+func validateImportRows(rows []spreadsheet.Row, columns map[string]int, result *models.UserImport) []importedUser {
+	var users []importedUser
+	seen := make(map[string]int)
+	for _, row := range rows {
+		cell := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(row.Cells) {
+				return strings.TrimSpace(row.Cells[i])
+			}
+			return ""
+		}
+		fail := func(field, msg string) {
+			result.Errors = append(result.Errors, models.ImportRowError{Row: row.Line, Field: field, Error: msg})
+		}
+		errorCount := len(result.Errors)
+
+		user := models.User{
+			PassportNumber: cell("passport_number"),
+			Surname:        cell("surname"),
+			Name:           cell("name"),
+			Patronymic:     cell("patronymic"),
+			Address:        cell("address"),
+			Timezone:       cell("timezone"),
+		}
+		if user.Name == "" || user.Surname == "" {
+			fail("", "Name and Surname are required fields")
+		}
+		for _, field := range []string{"surname", "name", "patronymic"} {
+			if len(cell(field)) > 50 {
+				fail(field, field+" must be at most 50 characters")
+			}
+		}
+		if len(user.Address) > 255 {
+			fail("address", "address must be at most 255 characters")
+		}
+		if _, _, err := parsePassportNumber(user.PassportNumber); err != nil {
+			fail("passport_number", err.Error())
+		} else if first, ok := seen[user.PassportNumber]; ok {
+			fail("passport_number", fmt.Sprintf("Passport number repeats row %d", first))
+		} else {
+			seen[user.PassportNumber] = row.Line
+		}
+		if v := cell("max_task_minutes"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				fail("max_task_minutes", "max_task_minutes must be a whole number")
+			} else {
+				user.MaxTaskMinutes = &n
+			}
+		}
+		if err := validateUserSettings(&user); err != nil {
+			fail("", err.Error())
+		}
+
+		if len(result.Errors) == errorCount {
+			users = append(users, importedUser{row: row.Line, user: user})
+		}
+	}
+	return users
+}
+
+// rejectExistingPassports moves users whose passport number is already taken
+// in the organization, including by deleted users, to the errors of result.
+func rejectExistingPassports(ctx context.Context, users []importedUser, result *models.UserImport) ([]importedUser, error) {
+	if len(users) == 0 {
+		return users, nil
+	}
+	passports := make([]string, len(users))
+	for i, u := range users {
+		passports[i] = u.user.PassportNumber
+	}
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT passport_number FROM users WHERE organization_id = $1 AND passport_number = ANY($2)",
+		tenant(ctx), pq.Array(passports))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var passport string
+		if err = rows.Scan(&passport); err != nil {
+			return nil, err
+		}
+		taken[passport] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	valid := users[:0]
+	for _, u := range users {
+		if taken[u.user.PassportNumber] {
+			result.Errors = append(result.Errors, models.ImportRowError{Row: u.row, Field: "passport_number", Error: "A user with this passport number already exists"})
+			continue
+		}
+		valid = append(valid, u)
+	}
+	return valid, nil
+}
+
+// insertImportedUsers creates the users and their audit entries in one
+// transaction.
+func insertImportedUsers(ctx context.Context, users []importedUser) error {
+	now := time.Now().UTC()
+	for i := range users {
+		users[i].user.OrganizationID = tenant(ctx)
+		users[i].user.CreatedAt = now
+		users[i].user.UpdatedAt = now
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(users) >= copyThreshold {
+		err = copyImportedUsers(ctx, tx, users)
+	} else {
+		for i := range users {
+			u := &users[i].user
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO users (organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at, timezone, max_task_minutes)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				RETURNING id`,
+				u.OrganizationID, u.PassportNumber, u.Surname, u.Name, u.Patronymic, u.Address, u.CreatedAt, u.UpdatedAt, u.Timezone, u.MaxTaskMinutes).Scan(&u.ID)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return errors.New("A user with one of these passport numbers was created meanwhile")
+	}
+	if err != nil {
+		return fmt.Errorf("error inserting users: %w", err)
+	}
+
+	entries := make([]audit.Entry, len(users))
+	events := make([]outbox.Event, len(users))
+	for i, u := range users {
+		entries[i] = audit.Entry{Entity: audit.EntityUser, EntityID: u.user.ID, UserID: u.user.ID, Action: audit.ActionCreate, After: u.user}
+		events[i] = outbox.Event{Type: outbox.EventUserCreated, UserID: u.user.ID, Data: u.user}
+	}
+	if err = audit.RecordAll(ctx, tx, entries); err != nil {
+		return err
+	}
+	if err = outbox.PublishAll(ctx, tx, events); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing users: %w", err)
+	}
+
+	for _, u := range users {
+		addUserToMigrationFile(u.user)
+	}
+	return nil
+}
+
+// copyImportedUsers loads the users into a temporary table with COPY and
+// inserts them from there, to learn their IDs.
+func copyImportedUsers(ctx context.Context, tx *sql.Tx, users []importedUser) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TEMP TABLE users_import (
+			line INTEGER NOT NULL,
+			organization_id INTEGER NOT NULL,
+			passport_number VARCHAR(20) NOT NULL,
+			surname VARCHAR(50) NOT NULL,
+			name VARCHAR(50) NOT NULL,
+			patronymic VARCHAR(50),
+			address VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			timezone VARCHAR(64) NOT NULL,
+			max_task_minutes INTEGER
+		) ON COMMIT DROP`)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("users_import", "line", "organization_id", "passport_number", "surname", "name", "patronymic", "address", "created_at", "updated_at", "timezone", "max_task_minutes"))
+	if err != nil {
+		return err
+	}
+	for _, iu := range users {
+		u := iu.user
+		if _, err = stmt.ExecContext(ctx, iu.row, u.OrganizationID, u.PassportNumber, u.Surname, u.Name, u.Patronymic, u.Address, u.CreatedAt, u.UpdatedAt, u.Timezone, u.MaxTaskMinutes); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO users (organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at, timezone, max_task_minutes)
+		SELECT organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at, timezone, max_task_minutes
+		FROM users_import
+		ORDER BY line
+		RETURNING id, passport_number`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	ids := make(map[string]int, len(users))
+	for rows.Next() {
+		var (
+			id       int
+			passport string
+		)
+		if err = rows.Scan(&id, &passport); err != nil {
+			return err
+		}
+		ids[passport] = id
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for i := range users {
+		users[i].user.ID = ids[users[i].user.PassportNumber]
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,504 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-project/billing"
+	"test-project/database"
+	"test-project/invoice"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+// InvoiceRequest is the body for creating an invoice. The period is given as
+// inclusive YYYY-MM-DD dates; tasks are selected by their start time.
+type InvoiceRequest struct {
+	ClientID    int    `json:"clientId"`
+	PeriodStart string `json:"periodStart"`
+	PeriodEnd   string `json:"periodEnd"`
+	GroupBy     string `json:"groupBy"`
+	Currency    string `json:"currency"`
+}
+
+const invoiceColumns = "i.id, i.client_id, c.name, i.status, i.period_start, i.period_end, i.group_by, i.currency, i.total, i.created_at, i.voided_at"
+
+var (
+	errNoInvoiceTasks = errors.New("no uninvoiced billable tasks for the client in the period")
+	errUnpricedTasks  = errors.New("billable tasks without a rate")
+)
+
+// @Summary Create an invoice
+// @Description Collect the client's uninvoiced billable tasks of a period into an invoice with one line per project or per task. Invoiced tasks cannot be edited until the invoice is voided. Requires the admin token.
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param invoice body controllers.InvoiceRequest true "Client, period and grouping"
+// @Success 201 {object} models.Invoice
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /invoices [post]
+func CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateInvoice called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Creating invoices requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var req InvoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	inv := models.Invoice{ClientID: req.ClientID, Status: models.InvoiceIssued, GroupBy: req.GroupBy, Currency: strings.ToUpper(req.Currency)}
+	if inv.GroupBy == "" {
+		inv.GroupBy = "project"
+	}
+	if inv.GroupBy != "project" && inv.GroupBy != "task" {
+		http.Error(w, "groupBy must be project or task", http.StatusBadRequest)
+		return
+	}
+	if inv.Currency == "" {
+		inv.Currency = cfg.Billing.Currency
+	}
+	if !currencyCode.MatchString(inv.Currency) {
+		http.Error(w, "currency must be a three-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if inv.PeriodStart, err = time.Parse("2006-01-02", req.PeriodStart); err != nil {
+		http.Error(w, "Invalid periodStart, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if inv.PeriodEnd, err = time.Parse("2006-01-02", req.PeriodEnd); err != nil {
+		http.Error(w, "Invalid periodEnd, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if inv.PeriodEnd.Before(inv.PeriodStart) {
+		http.Error(w, "periodEnd must not be before periodStart", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, "SELECT name FROM clients WHERE id = $1 AND organization_id = $2", inv.ClientID, tenant(ctx)).Scan(&inv.ClientName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Client not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying client: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	taskIDs, err := buildInvoiceLines(ctx, tx, &inv)
+	if err != nil {
+		if errors.Is(err, errNoInvoiceTasks) || errors.Is(err, errUnpricedTasks) {
+			logger.Warning("Rejected invoice for client %d: %v", inv.ClientID, err)
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			logger.Error("Error collecting invoice tasks: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO invoices (client_id, status, period_start, period_end, group_by, currency, total)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		inv.ClientID, inv.Status, inv.PeriodStart, inv.PeriodEnd, inv.GroupBy, inv.Currency, inv.Total).Scan(&inv.ID, &inv.CreatedAt)
+	if err == nil {
+		err = insertInvoiceLines(ctx, tx, &inv)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, "UPDATE tasks SET invoice_id = $1 WHERE id = ANY($2)", inv.ID, pq.Array(taskIDs))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error saving invoice: %v", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+	inv.Number = invoiceNumber(inv.ID)
+	logger.Info("Invoice %s created for client %d with %d tasks", inv.Number, inv.ClientID, len(taskIDs))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(inv); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get invoices
+// @Description Get invoices without their lines, newest first
+// @Tags invoices
+// @Produce json
+// @Param clientId query int false "Client ID"
+// @Param status query string false "issued or void"
+// @Success 200 {array} models.Invoice
+// @Failure 500 {object} models.ErrorResponse
+// @Router /invoices [get]
+func GetInvoices(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetInvoices called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	clientID, _ := strconv.Atoi(r.URL.Query().Get("clientId"))
+	status := r.URL.Query().Get("status")
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT `+invoiceColumns+`
+		FROM invoices i JOIN clients c ON c.id = i.client_id
+		WHERE ($1 = 0 OR i.client_id = $1) AND ($2 = '' OR i.status = $2) AND c.organization_id = $3
+		ORDER BY i.id DESC`, clientID, status, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	invoices := make([]models.Invoice, 0)
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		invoices = append(invoices, inv)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(invoices); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get an invoice
+// @Description Get an invoice with its lines as JSON, CSV or PDF
+// @Tags invoices
+// @Produce json
+// @Produce text/csv
+// @Produce application/pdf
+// @Param id path int true "Invoice ID"
+// @Param format query string false "json (default), csv or pdf"
+// @Success 200 {object} models.Invoice
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /invoices/{id} [get]
+func GetInvoice(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetInvoice called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" && format != "pdf" {
+		http.Error(w, "format must be json, csv or pdf", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := scanInvoice(database.From(ctx).QueryRowContext(ctx, `
+		SELECT `+invoiceColumns+`
+		FROM invoices i JOIN clients c ON c.id = i.client_id
+		WHERE i.id = $1 AND c.organization_id = $2`, id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying invoice: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if inv.Lines, err = loadInvoiceLines(ctx, inv.ID); err != nil {
+		logger.Error("Error loading invoice lines: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inv.Number+".csv"))
+		err = invoice.WriteCSV(w, inv)
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inv.Number+".pdf"))
+		err = invoice.WritePDF(w, inv)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(inv)
+	}
+	if err != nil {
+		logger.Error("Error writing invoice %d: %v", inv.ID, err)
+	}
+}
+
+// @Summary Void an invoice
+// @Description Mark an invoice void and release its tasks so that they can be edited and invoiced again. Requires the admin token.
+// @Tags invoices
+// @Produce json
+// @Param id path int true "Invoice ID"
+// @Success 200 {object} models.Invoice
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /invoices/{id}/void [post]
+func VoidInvoice(w http.ResponseWriter, r *http.Request) {
+	logger.Info("VoidInvoice called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Voiding invoices requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	inv, err := scanInvoice(tx.QueryRowContext(ctx, `
+		SELECT `+invoiceColumns+`
+		FROM invoices i JOIN clients c ON c.id = i.client_id
+		WHERE i.id = $1 AND c.organization_id = $2
+		FOR UPDATE OF i`, id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying invoice: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if inv.Status == models.InvoiceVoid {
+		http.Error(w, "Invoice is already void", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	inv.Status = models.InvoiceVoid
+	inv.VoidedAt = &now
+	_, err = tx.ExecContext(ctx, "UPDATE invoices SET status = $1, voided_at = $2 WHERE id = $3", inv.Status, now, inv.ID)
+	var released sql.Result
+	if err == nil {
+		released, err = tx.ExecContext(ctx, "UPDATE tasks SET invoice_id = NULL WHERE invoice_id = $1", inv.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error voiding invoice %d: %v", inv.ID, err)
+		http.Error(w, "Error voiding invoice", http.StatusInternalServerError)
+		return
+	}
+	n, _ := released.RowsAffected()
+	logger.Info("Invoice %s voided, %d tasks released", inv.Number, n)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(inv); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// buildInvoiceLines locks the client's uninvoiced billable tasks of the
+// invoice period, prices them and fills in inv.Lines and inv.Total. Every task
+// must have a rate in the invoice currency, so that no time is left out
+// silently.
+func buildInvoiceLines(ctx context.Context, tx *sql.Tx, inv *models.Invoice) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT t.id, p.id, p.name, COALESCE(t.name, ''), t.start_time,
+			FLOOR(EXTRACT(EPOCH FROM t.end_time - t.start_time) / 60)::INTEGER,
+			rate.amount, COALESCE(rate.currency, '')
+		FROM tasks t
+		JOIN projects p ON p.id = t.project_id`+rateLateral+`
+		WHERE p.client_id = $1 AND t.billable AND t.end_time IS NOT NULL AND t.invoice_id IS NULL
+		AND t.start_time >= $2 AND t.start_time < $3
+		ORDER BY p.name, p.id, t.start_time, t.id
+		FOR UPDATE OF t`,
+		inv.ClientID, inv.PeriodStart, inv.PeriodEnd.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		taskIDs  []int64
+		unpriced int
+	)
+	for rows.Next() {
+		var (
+			taskID, projectID int
+			projectName       string
+			taskName          string
+			startTime         time.Time
+			minutes           int
+			amount            sql.NullInt64
+			currency          string
+		)
+		if err = rows.Scan(&taskID, &projectID, &projectName, &taskName, &startTime, &minutes, &amount, &currency); err != nil {
+			return nil, err
+		}
+		if !amount.Valid || strings.TrimSpace(currency) != inv.Currency {
+			unpriced++
+			continue
+		}
+		taskIDs = append(taskIDs, int64(taskID))
+
+		billable := billing.RoundMinutes(minutes, cfg.Billing)
+		cost := billing.Cost(billable, amount.Int64)
+		inv.Total += cost
+
+		n := len(inv.Lines)
+		if inv.GroupBy == "project" && n > 0 && *inv.Lines[n-1].ProjectID == projectID {
+			inv.Lines[n-1].Tasks++
+			inv.Lines[n-1].Minutes += billable
+			inv.Lines[n-1].Amount += cost
+			continue
+		}
+		line := models.InvoiceLine{ProjectID: &projectID, Description: projectName, Tasks: 1, Minutes: billable, Amount: cost}
+		if inv.GroupBy == "task" {
+			id := taskID
+			line.TaskID = &id
+			if taskName == "" {
+				taskName = fmt.Sprintf("Task %d", taskID)
+			}
+			line.Description = fmt.Sprintf("%s: %s (%s)", projectName, taskName, startTime.Format("2006-01-02"))
+		}
+		if runes := []rune(line.Description); len(runes) > 200 {
+			line.Description = string(runes[:200])
+		}
+		inv.Lines = append(inv.Lines, line)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if unpriced > 0 {
+		return nil, fmt.Errorf("%w: %d tasks have no rate in %s", errUnpricedTasks, unpriced, inv.Currency)
+	}
+	if len(taskIDs) == 0 {
+		return nil, errNoInvoiceTasks
+	}
+	return taskIDs, nil
+}
+
+func insertInvoiceLines(ctx context.Context, tx *sql.Tx, inv *models.Invoice) error {
+	for i := range inv.Lines {
+		line := &inv.Lines[i]
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO invoice_lines (invoice_id, project_id, task_id, description, tasks, minutes, amount)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id`,
+			inv.ID, line.ProjectID, line.TaskID, line.Description, line.Tasks, line.Minutes, line.Amount).Scan(&line.ID)
+		if err != nil {
+			return fmt.Errorf("error inserting invoice line: %w", err)
+		}
+	}
+	return nil
+}
+
+func loadInvoiceLines(ctx context.Context, invoiceID int) ([]models.InvoiceLine, error) {
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT id, project_id, task_id, description, tasks, minutes, amount
+		FROM invoice_lines WHERE invoice_id = $1 ORDER BY id`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []models.InvoiceLine
+	for rows.Next() {
+		var (
+			line              models.InvoiceLine
+			projectID, taskID sql.NullInt64
+		)
+		if err = rows.Scan(&line.ID, &projectID, &taskID, &line.Description, &line.Tasks, &line.Minutes, &line.Amount); err != nil {
+			return nil, err
+		}
+		if projectID.Valid {
+			id := int(projectID.Int64)
+			line.ProjectID = &id
+		}
+		if taskID.Valid {
+			id := int(taskID.Int64)
+			line.TaskID = &id
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+func scanInvoice(row rowScanner) (models.Invoice, error) {
+	var (
+		inv      models.Invoice
+		voidedAt sql.NullTime
+	)
+	err := row.Scan(&inv.ID, &inv.ClientID, &inv.ClientName, &inv.Status, &inv.PeriodStart, &inv.PeriodEnd, &inv.GroupBy, &inv.Currency, &inv.Total, &inv.CreatedAt, &voidedAt)
+	if err != nil {
+		return inv, err
+	}
+	if voidedAt.Valid {
+		inv.VoidedAt = &voidedAt.Time
+	}
+	inv.Number = invoiceNumber(inv.ID)
+	return inv, nil
+}
+
+func invoiceNumber(id int) string {
+	return fmt.Sprintf("INV-%06d", id)
+}
@@ -0,0 +1,436 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/middleware"
+	"test-project/models"
+	"time"
+)
+
+// maxJobsListed bounds GET /jobs, which returns the most recent jobs first.
+const maxJobsListed = 100
+
+// jobKind is an endpoint that can run as a background job. The job replays a
+// request to it, so a job behaves exactly like the synchronous call.
+type jobKind struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+var jobKinds = map[string]jobKind{
+	"users.import":       {http.MethodPost, "/users/import", ImportUsers},
+	"users.export":       {http.MethodGet, "/users/export", ExportUsers},
+	"tasks.export":       {http.MethodGet, "/tasks/export", ExportTasks},
+	"reports.time":       {http.MethodGet, "/reports/time", GetTimeReport},
+	"reports.cost":       {http.MethodGet, "/reports/cost", GetCostReport},
+	"reports.attendance": {http.MethodGet, "/reports/attendance", GetAttendanceReport},
+}
+
+// JobRequest is the request a job replays, on behalf of the organization and
+// actor that enqueued it.
+type JobRequest struct {
+	OrganizationID int
+	Actor          string
+	Kind           string
+	Query          string
+	ContentType    string
+	Payload        []byte
+}
+
+// ProgressFunc receives the rows a job has processed so far, and the total
+// when it is known, or 0.
+type ProgressFunc func(done, total int64)
+
+type progressKey struct{}
+
+// RunJob replays req against the endpoint of its kind, writing the response
+// to w. Queries are bounded by ctx instead of the per-query timeout.
+func RunJob(ctx context.Context, req JobRequest, w http.ResponseWriter, progress ProgressFunc) error {
+	kind, ok := jobKinds[req.Kind]
+	if !ok {
+		return fmt.Errorf("unknown job kind %q", req.Kind)
+	}
+	ctx = middleware.WithOrganization(ctx, req.OrganizationID)
+	ctx = middleware.WithActor(ctx, req.Actor)
+	ctx = context.WithValue(ctx, progressKey{}, progress)
+
+	return database.WithScope(ctx, strconv.Itoa(req.OrganizationID), func(ctx context.Context) error {
+		r, err := http.NewRequestWithContext(ctx, kind.method, kind.path+"?"+req.Query, bytes.NewReader(req.Payload))
+		if err != nil {
+			return err
+		}
+		if req.ContentType != "" {
+			r.Header.Set("Content-Type", req.ContentType)
+		}
+		kind.handler(w, r)
+		return nil
+	})
+}
+
+// inJob reports whether ctx belongs to a background job.
+func inJob(ctx context.Context) bool {
+	return ctx.Value(progressKey{}) != nil
+}
+
+// reportProgress passes progress to the job running the request, if any.
+func reportProgress(ctx context.Context, done, total int64) {
+	if progress, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && progress != nil {
+		progress(done, total)
+	}
+}
+
+// @Summary Enqueue a job
+// @Description Run an import, export or report in the background. The query parameters other than kind and the request body are passed to the endpoint of that kind: users.import (POST /users/import), users.export, tasks.export, reports.time, reports.cost or reports.attendance. Poll the returned job for its status and result.
+// @Tags jobs
+// @Accept text/csv
+// @Accept application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce json
+// @Param kind query string true "Job kind"
+// @Success 202 {object} models.Job
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /jobs [post]
+func EnqueueJob(w http.ResponseWriter, r *http.Request) {
+	logger.Info("EnqueueJob called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	params := r.URL.Query()
+	kindName := params.Get("kind")
+	kind, ok := jobKinds[kindName]
+	if !ok {
+		names := make([]string, 0, len(jobKinds))
+		for name := range jobKinds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		http.Error(w, "kind must be one of "+strings.Join(names, ", "), http.StatusBadRequest)
+		return
+	}
+	params.Del("kind")
+
+	var (
+		payload     []byte
+		contentType string
+		err         error
+	)
+	if kind.method == http.MethodPost {
+		if payload, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize)); err != nil {
+			logger.Warning("Error reading job payload: %v", err)
+			http.Error(w, fmt.Sprintf("Error reading body, the limit is %d MB", maxImportSize>>20), http.StatusBadRequest)
+			return
+		}
+		contentType = r.Header.Get("Content-Type")
+	}
+
+	row := database.From(ctx).QueryRowContext(ctx, `
+		INSERT INTO jobs (organization_id, kind, query, content_type, payload, actor, max_attempts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+jobColumns,
+		tenant(ctx), kindName, params.Encode(), contentType, payload, middleware.ActorFromContext(ctx), cfg.Jobs.MaxAttempts)
+	job, err := scanJob(row)
+	if err != nil {
+		logger.Error("Error enqueueing job: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Job %d (%s) enqueued", job.ID, job.Kind)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(job); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get jobs
+// @Description Get the organization's most recent jobs, newest first
+// @Tags jobs
+// @Produce json
+// @Param status query string false "queued, running, succeeded, failed or cancelled"
+// @Success 200 {array} models.Job
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /jobs [get]
+func GetJobs(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetJobs called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.JobQueued, models.JobRunning, models.JobSucceeded, models.JobFailed, models.JobCancelled:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3`, tenant(ctx), status, maxJobsListed)
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	jobs := make([]models.Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(jobs); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get a job
+// @Description Get a job's status, progress and, once it has one, the location of its result
+// @Tags jobs
+// @Produce json
+// @Param id path int true "Job ID"
+// @Success 200 {object} models.Job
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /jobs/{id} [get]
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetJob called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := scanJob(database.From(ctx).QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE id = $1 AND organization_id = $2", id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Job not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying job: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(job); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Cancel a job
+// @Description Cancel a job. A queued job is cancelled at once; a running job is stopped by its worker shortly after, and 202 is returned meanwhile.
+// @Tags jobs
+// @Produce json
+// @Param id path int true "Job ID"
+// @Success 200 {object} models.Job
+// @Success 202 {object} models.Job
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /jobs/{id}/cancel [post]
+func CancelJob(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CancelJob called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := scanJob(database.From(ctx).QueryRowContext(ctx, `
+		UPDATE jobs
+		SET cancel_requested = TRUE,
+			status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+			finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END,
+			updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND status IN ('queued', 'running')
+		RETURNING `+jobColumns, id, tenant(ctx)))
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err = database.From(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM jobs WHERE id = $1 AND organization_id = $2)", id, tenant(ctx)).Scan(&exists); err == nil {
+			if exists {
+				http.Error(w, "Job already finished", http.StatusConflict)
+			} else {
+				http.Error(w, "Job not found", http.StatusNotFound)
+			}
+			return
+		}
+	}
+	if err != nil {
+		logger.Error("Error cancelling job: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Cancellation of job %d requested", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if job.Status == models.JobRunning {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	if err = json.NewEncoder(w).Encode(job); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get a job's result
+// @Description Download what the job's endpoint responded, with its status code and content type. A job that failed on invalid input has the error response as its result.
+// @Tags jobs
+// @Produce octet-stream
+// @Param id path int true "Job ID"
+// @Success 200 {file} file
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /jobs/{id}/result [get]
+func GetJobResult(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetJobResult called")
+
+	// The result streams for as long as the client reads it.
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		status                   string
+		resultStatus, size       sql.NullInt64
+		contentType, disposition sql.NullString
+	)
+	err = database.From(ctx).QueryRowContext(ctx, `
+		SELECT status, result_status, result_content_type, result_disposition, result_size
+		FROM jobs WHERE id = $1 AND organization_id = $2`, id, tenant(ctx)).
+		Scan(&status, &resultStatus, &contentType, &disposition, &size)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Job not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying job: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if !resultStatus.Valid {
+		if status == models.JobQueued || status == models.JobRunning {
+			http.Error(w, "Job has not finished", http.StatusConflict)
+		} else {
+			http.Error(w, "Job has no result", http.StatusNotFound)
+		}
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT data FROM job_result_chunks WHERE job_id = $1 ORDER BY seq", id)
+	if err != nil {
+		logger.Error("Error querying job result: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	if contentType.String != "" {
+		w.Header().Set("Content-Type", contentType.String)
+	}
+	if disposition.String != "" {
+		w.Header().Set("Content-Disposition", disposition.String)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size.Int64, 10))
+	w.WriteHeader(int(resultStatus.Int64))
+
+	rc := http.NewResponseController(w)
+	var chunk []byte
+	for rows.Next() {
+		if err = rc.SetWriteDeadline(time.Now().Add(cfg.Server.WriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			break
+		}
+		if err = rows.Scan(&chunk); err != nil {
+			break
+		}
+		if _, err = w.Write(chunk); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		logger.Error("Error sending result of job %d: %v", id, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+const jobColumns = "id, kind, status, query, attempts, max_attempts, progress_done, progress_total, cancel_requested, error, result_status, result_size, actor, run_at, created_at, started_at, finished_at"
+
+func scanJob(row rowScanner) (models.Job, error) {
+	var (
+		job                   models.Job
+		total, resultStatus   sql.NullInt64
+		resultSize            sql.NullInt64
+		jobErr                sql.NullString
+		startedAt, finishedAt sql.NullTime
+	)
+	err := row.Scan(&job.ID, &job.Kind, &job.Status, &job.Query, &job.Attempts, &job.MaxAttempts, &job.Progress.Done, &total, &job.CancelRequested,
+		&jobErr, &resultStatus, &resultSize, &job.Actor, &job.RunAt, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return job, err
+	}
+	if total.Valid {
+		job.Progress.Total = &total.Int64
+	}
+	job.Error = jobErr.String
+	if resultStatus.Valid {
+		job.ResultURL = fmt.Sprintf("/jobs/%d/result", job.ID)
+		job.ResultSize = &resultSize.Int64
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
@@ -2,10 +2,10 @@ package controllers
 
 import (
 	"fmt"
-	"github.com/joho/godotenv"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"test-project/logger"
 	"test-project/models"
@@ -17,12 +17,23 @@ var (
 	filePathTaskMigration = "migrations/20230707120000_insert_initial_tasks.sql"
 )
 
+func setMigrationsPath(migrationsPath string) {
+	filePathUserMigration = filepath.Join(migrationsPath, "20230707120000_insert_initial_users.sql")
+	filePathTaskMigration = filepath.Join(migrationsPath, "20230707120000_insert_initial_tasks.sql")
+}
+
 func addTaskToMigrationFile(task models.Task) {
 	filePath := filePathTaskMigration
 	migrationLine := fmt.Sprintf(
 		"INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time) VALUES (%d, %d, '%s', '%s', '%s', '%s');\n",
 		task.ID, task.UserID, task.Name, task.CreatedAt.Format(time.RFC3339), task.UpdatedAt.Format(time.RFC3339), task.StartTime.Format(time.RFC3339),
 	)
+	if !task.EndTime.IsZero() {
+		migrationLine = fmt.Sprintf(
+			"INSERT INTO tasks (id, user_id, name, hours, minutes, created_at, updated_at, start_time, end_time) VALUES (%d, %d, '%s', %d, %d, '%s', '%s', '%s', '%s');\n",
+			task.ID, task.UserID, task.Name, task.Hours, task.Minutes, task.CreatedAt.Format(time.RFC3339), task.UpdatedAt.Format(time.RFC3339), task.StartTime.Format(time.RFC3339), task.EndTime.Format(time.RFC3339),
+		)
+	}
 
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -41,8 +52,8 @@ func addTaskToMigrationFile(task models.Task) {
 func addUserToMigrationFile(user models.User) {
 	filePath := filePathUserMigration
 	migrationLine := fmt.Sprintf(
-		"INSERT INTO users (id, passport_number, surname, name, patronymic, address, created_at, updated_at) VALUES (%d, '%s', '%s', '%s', '%s', '%s', NOW(), NOW());\n",
-		user.ID, user.PassportNumber, user.Surname, user.Name, user.Patronymic, user.Address,
+		"INSERT INTO users (id, organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at) VALUES (%d, %d, '%s', '%s', '%s', '%s', '%s', NOW(), NOW());\n",
+		user.ID, user.OrganizationID, user.PassportNumber, user.Surname, user.Name, user.Patronymic, user.Address,
 	)
 
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -69,13 +80,13 @@ func updateUserInMigrationFile(updatedUser models.User, id int) {
 	lines := strings.Split(string(fileContent), "\n")
 
 	newMigrationLine := fmt.Sprintf(
-		"INSERT INTO users (id, passport_number, surname, name, patronymic, address, created_at, updated_at) VALUES (%d, '%s', '%s', '%s', '%s', '%s', NOW(), NOW());",
-		id, updatedUser.PassportNumber, updatedUser.Surname, updatedUser.Name, updatedUser.Patronymic, updatedUser.Address,
+		"INSERT INTO users (id, organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at) VALUES (%d, %d, '%s', '%s', '%s', '%s', '%s', NOW(), NOW());",
+		id, updatedUser.OrganizationID, updatedUser.PassportNumber, updatedUser.Surname, updatedUser.Name, updatedUser.Patronymic, updatedUser.Address,
 	)
 
 	updated := false
 	for i, line := range lines {
-		if strings.Contains(line, fmt.Sprintf("(%d,", id)) {
+		if seedColumn(line, "id") == strconv.Itoa(id) {
 			lines[i] = newMigrationLine
 			updated = true
 			break
@@ -97,11 +108,6 @@ func updateUserInMigrationFile(updatedUser models.User, id int) {
 }
 
 func removeUserFromMigrationFile(userID int) error {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
 	filePath := filePathUserMigration
 
 	fileContent, err := ioutil.ReadFile(filePath)
@@ -115,7 +121,7 @@ func removeUserFromMigrationFile(userID int) error {
 	found := false
 
 	for _, line := range lines {
-		if strings.Contains(line, fmt.Sprintf("(%d,", userID)) {
+		if seedColumn(line, "id") == strconv.Itoa(userID) {
 			logger.Info("Removing migration line: %s", line)
 			found = true
 			continue
@@ -138,6 +144,7 @@ func removeUserFromMigrationFile(userID int) error {
 	return nil
 }
 
+// removeTaskFromMigrationFile removes the seed lines of the user's tasks.
 func removeTaskFromMigrationFile(userID int) error {
 	filePath := filePathTaskMigration
 
@@ -150,7 +157,7 @@ func removeTaskFromMigrationFile(userID int) error {
 
 	var updatedLines []string
 	for _, line := range lines {
-		if strings.Contains(line, "INSERT INTO tasks") || strings.Contains(line, fmt.Sprintf("(%d,", userID)) {
+		if seedColumn(line, "user_id") == strconv.Itoa(userID) {
 			logger.Info("Removing line: %s", line)
 		} else {
 			updatedLines = append(updatedLines, line)
@@ -166,3 +173,129 @@ func removeTaskFromMigrationFile(userID int) error {
 	logger.Info("Migration file updated successfully")
 	return nil
 }
+
+// replaceUserInMigrationFile rewrites the seed line for user, carrying
+// deleted_at so that a soft-deleted user stays deleted when the seed file
+// loads a new database.
+func replaceUserInMigrationFile(user models.User) {
+	filePath := filePathUserMigration
+
+	fileContent, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		logger.Warning("Failed to read migration file: %v", err)
+		return
+	}
+
+	lines := strings.Split(string(fileContent), "\n")
+
+	deletedAt := "NULL"
+	if user.DeletedAt != nil {
+		deletedAt = fmt.Sprintf("'%s'", user.DeletedAt.Format(time.RFC3339))
+	}
+	newMigrationLine := fmt.Sprintf(
+		"INSERT INTO users (id, organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at, deleted_at) VALUES (%d, %d, '%s', '%s', '%s', '%s', '%s', NOW(), NOW(), %s);",
+		user.ID, user.OrganizationID, user.PassportNumber, user.Surname, user.Name, user.Patronymic, user.Address, deletedAt,
+	)
+
+	updated := false
+	for i, line := range lines {
+		if seedColumn(line, "id") == strconv.Itoa(user.ID) {
+			lines[i] = newMigrationLine
+			updated = true
+			break
+		}
+	}
+
+	if !updated {
+		logger.Warning("User with ID %d not found in migration file.", user.ID)
+		return
+	}
+
+	if err = ioutil.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		logger.Error("Failed to write to migration file: %v", err)
+	}
+}
+
+// replaceTaskInMigrationFile rewrites the seed line of an edited task.
+func replaceTaskInMigrationFile(task models.Task) {
+	if err := removeSingleTaskFromMigrationFile(task.ID); err != nil {
+		logger.Warning("Failed to update migration file: %v", err)
+		return
+	}
+	addTaskToMigrationFile(task)
+}
+
+func removeSingleTaskFromMigrationFile(taskID int) error {
+	filePath := filePathTaskMigration
+
+	fileContent, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("could not read SQL file: %v", err)
+	}
+
+	lines := strings.Split(string(fileContent), "\n")
+
+	var updatedLines []string
+	for _, line := range lines {
+		if seedColumn(line, "id") == strconv.Itoa(taskID) {
+			logger.Info("Removing line: %s", line)
+			continue
+		}
+		updatedLines = append(updatedLines, line)
+	}
+
+	err = ioutil.WriteFile(filePath, []byte(strings.Join(updatedLines, "\n")), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write SQL file: %v", err)
+	}
+	return nil
+}
+
+// seedColumn returns the value a seed line inserts into column, with the
+// quotes of a string value left in place, or an empty string when the line
+// is not an INSERT naming the column.
+func seedColumn(line, column string) string {
+	open := strings.Index(line, "(")
+	values := strings.Index(line, ") VALUES (")
+	if !strings.HasPrefix(strings.TrimSpace(line), "INSERT INTO ") || open < 0 || values < open {
+		return ""
+	}
+	columns := strings.Split(line[open+1:values], ",")
+	tuple := splitSeedValues(strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(line[values+len(") VALUES ("):]), ";"), ")"))
+	if len(columns) != len(tuple) {
+		return ""
+	}
+	for i, name := range columns {
+		if strings.TrimSpace(name) == column {
+			return tuple[i]
+		}
+	}
+	return ""
+}
+
+// splitSeedValues splits a VALUES tuple on the commas outside quoted strings
+// and parentheses.
+func splitSeedValues(tuple string) []string {
+	var (
+		values []string
+		quoted bool
+		depth  int
+		start  int
+	)
+	for i, c := range tuple {
+		switch {
+		case c == '\'':
+			// A doubled quote inside a string toggles twice and stays quoted.
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			values = append(values, strings.TrimSpace(tuple[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, strings.TrimSpace(tuple[start:]))
+}
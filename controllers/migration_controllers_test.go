@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeedColumn(t *testing.T) {
+	tests := []struct {
+		line, column, want string
+	}{
+		{"INSERT INTO tasks (id, user_id, name) VALUES (7, 12, 'Write');", "id", "7"},
+		{"INSERT INTO tasks (id, user_id, name) VALUES (7, 12, 'Write');", "user_id", "12"},
+		{"INSERT INTO tasks (id, user_id, name) VALUES (7, 12, 'a, (b)');", "name", "'a, (b)'"},
+		{"INSERT INTO tasks (id, name, user_id) VALUES (7, 'it''s (3, 4)', 3);", "user_id", "3"},
+		{"INSERT INTO users (id, name, created_at, updated_at) VALUES (1, 'x', NOW(), NOW());", "updated_at", "NOW()"},
+		{"INSERT INTO tasks (id, user_id) VALUES (7, 12);", "end_time", ""},
+		{"", "id", ""},
+		{"-- (1, 2)", "id", ""},
+	}
+	for _, tt := range tests {
+		if got := seedColumn(tt.line, tt.column); got != tt.want {
+			t.Errorf("seedColumn(%q, %q) = %q, want %q", tt.line, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveTaskFromMigrationFileKeepsOtherUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.sql")
+	seed := "INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time) VALUES (1, 3, 'a', 'x', 'x', 'x');\n" +
+		"INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time) VALUES (3, 1, 'b', 'x', 'x', 'x');\n" +
+		"INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time) VALUES (4, 3, 'c', 'x', 'x', 'x');\n" +
+		"INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time) VALUES (5, 13, 'd', 'x', 'x', 'x');\n"
+	if err := os.WriteFile(path, []byte(seed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := filePathTaskMigration
+	filePathTaskMigration = path
+	defer func() { filePathTaskMigration = saved }()
+
+	if err := removeTaskFromMigrationFile(3); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time) VALUES (3, 1, 'b', 'x', 'x', 'x');\n" +
+		"INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time) VALUES (5, 13, 'd', 'x', 'x', 'x');\n"
+	if string(data) != want {
+		t.Errorf("seed file after removing user 3:\n%s\nwant:\n%s", data, want)
+	}
+}
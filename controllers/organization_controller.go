@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"regexp"
+	"strconv"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+const organizationColumns = "id, slug, name, created_at, updated_at"
+
+var organizationSlug = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,48}[a-z0-9])?$`)
+
+// @Summary Get organizations
+// @Description Get all organizations. Requires the admin token.
+// @Tags organizations
+// @Produce json
+// @Success 200 {array} models.Organization
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organizations [get]
+func GetOrganizations(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetOrganizations called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Listing organizations requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	rows, err := database.DB.QueryContext(ctx, "SELECT "+organizationColumns+" FROM organizations ORDER BY id")
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	orgs := make([]models.Organization, 0)
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		orgs = append(orgs, org)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(orgs); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Create an organization
+// @Description Create an organization and its API token. The token is only returned once. Requires the admin token.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param organization body models.Organization true "Slug and name"
+// @Success 201 {object} models.Organization
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organizations [post]
+func CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateOrganization called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Creating organizations requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var org models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&org); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if !organizationSlug.MatchString(org.Slug) {
+		http.Error(w, "slug must be 1-50 lower-case letters, digits or dashes", http.StatusBadRequest)
+		return
+	}
+	if org.Name == "" || len(org.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	token := newToken("org_")
+	created, err := scanOrganization(database.DB.QueryRowContext(ctx, `
+		INSERT INTO organizations (slug, name, token_hash)
+		VALUES ($1, $2, $3)
+		RETURNING `+organizationColumns, org.Slug, org.Name, hashToken(token)))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			http.Error(w, "Organization already exists", http.StatusConflict)
+		} else {
+			logger.Error("Error inserting organization: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	created.Token = token
+	logger.Info("Organization %d (%s) created", created.ID, created.Slug)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(created); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Rename an organization
+// @Description Change an organization's name. The slug cannot change. Requires the admin token.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param organization body models.Organization true "Name"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organizations/{id} [patch]
+func UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	logger.Info("UpdateOrganization called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Changing organizations requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	var org models.Organization
+	if err = json.NewDecoder(r.Body).Decode(&org); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if org.Name == "" || len(org.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	org, err = scanOrganization(database.DB.QueryRowContext(ctx,
+		"UPDATE organizations SET name = $1, updated_at = $2 WHERE id = $3 RETURNING "+organizationColumns,
+		org.Name, time.Now().UTC(), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Organization not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error updating organization: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(org); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Rotate an organization token
+// @Description Replace an organization's API token. The old token stops working immediately. Requires the admin token.
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {object} models.Organization
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organizations/{id}/token [post]
+func RotateOrganizationToken(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RotateOrganizationToken called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Rotating tokens requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	token := newToken("org_")
+	org, err := scanOrganization(database.DB.QueryRowContext(ctx,
+		"UPDATE organizations SET token_hash = $1, updated_at = $2 WHERE id = $3 RETURNING "+organizationColumns,
+		hashToken(token), time.Now().UTC(), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Organization not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error rotating organization token: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	org.Token = token
+	logger.Info("Token of organization %d rotated", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(org); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete an organization
+// @Description Delete an organization that owns no users, clients, projects, tags or teams. Requires the admin token.
+// @Tags organizations
+// @Param id path int true "Organization ID"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /organizations/{id} [delete]
+func DeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteOrganization called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Deleting organizations requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.DB.ExecContext(ctx, "DELETE FROM organizations WHERE id = $1 AND slug <> $2", id, cfg.Tenancy.DefaultOrganization)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		http.Error(w, "Organization still owns data", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Error("Error deleting organization: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Organization not found or is the default organization", http.StatusNotFound)
+		return
+	}
+	logger.Info("Organization %d deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func scanOrganization(row rowScanner) (models.Organization, error) {
+	var org models.Organization
+	err := row.Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	return org, err
+}
+
+// newToken returns a random API token with the given prefix.
+func newToken(prefix string) string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
@@ -1,36 +1,46 @@
 package controllers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"test-project/logger"
 )
 
+var (
+	errPassportFormat = errors.New("Invalid passport format")
+	errPassportSeries = errors.New("Invalid passport series format")
+	errPassportNumber = errors.New("Invalid passport number format")
+)
+
 func ValidatePassportNumber(passportNumber string, w http.ResponseWriter) (string, string, error) {
+	passportSerieStr, passportNumberStr, err := parsePassportNumber(passportNumber)
+	if err != nil {
+		logger.Warning("%v: %q", err, passportNumber)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", "", err
+	}
+	logger.Info("Parsed passport number: series=%s, number=%s", passportSerieStr, passportNumberStr)
+
+	return passportSerieStr, passportNumberStr, nil
+}
+
+// parsePassportNumber splits a passport number into its four-digit series and
+// six-digit number.
+func parsePassportNumber(passportNumber string) (string, string, error) {
 	passportParts := strings.Split(passportNumber, " ")
 	if len(passportParts) != 2 {
-		logger.Warning("Invalid passport format")
-		http.Error(w, "Invalid passport format", http.StatusBadRequest)
-		return "", "", fmt.Errorf("invalid passport format")
+		return "", "", errPassportFormat
 	}
 	passportSerieStr := passportParts[0]
 	passportNumberStr := passportParts[1]
-	logger.Info("Parsed passport number: series=%s, number=%s", passportSerieStr, passportNumberStr)
 
-	_, err := strconv.Atoi(passportSerieStr)
-	if err != nil || len(passportSerieStr) != 4 {
-		logger.Error("Invalid passport series format: %v", passportSerieStr)
-		http.Error(w, "Invalid passport series format", http.StatusBadRequest)
-		return "", "", fmt.Errorf("invalid passport series format")
+	if _, err := strconv.Atoi(passportSerieStr); err != nil || len(passportSerieStr) != 4 {
+		return "", "", errPassportSeries
 	}
-
-	_, err = strconv.Atoi(passportNumberStr)
-	if err != nil || len(passportNumberStr) != 6 {
-		logger.Error("Invalid passport number format: %v", passportNumberStr)
-		http.Error(w, "Invalid passport number format", http.StatusBadRequest)
-		return "", "", fmt.Errorf("invalid passport number format")
+	if _, err := strconv.Atoi(passportNumberStr); err != nil || len(passportNumberStr) != 6 {
+		return "", "", errPassportNumber
 	}
 
 	return passportSerieStr, passportNumberStr, nil
@@ -0,0 +1,497 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+var (
+	errProjectNotFound  = errors.New("project not found")
+	errProjectArchived  = errors.New("project is archived")
+	errNotProjectMember = errors.New("user is not a member of the project")
+)
+
+const projectColumns = "id, client_id, name, archived, created_at, updated_at"
+
+// @Summary Get projects
+// @Description Get projects, optionally for one client. Archived projects are included with includeArchived=true.
+// @Tags projects
+// @Produce json
+// @Param clientId query int false "Client ID"
+// @Param includeArchived query bool false "Include archived projects"
+// @Success 200 {array} models.Project
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects [get]
+func GetProjects(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetProjects called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	query := "SELECT " + projectColumns + " FROM projects WHERE organization_id = $2 AND ($1 = 0 OR client_id = $1)"
+	if r.URL.Query().Get("includeArchived") != "true" {
+		query += " AND NOT archived"
+	}
+	query += " ORDER BY id"
+
+	clientID, _ := strconv.Atoi(r.URL.Query().Get("clientId"))
+	rows, err := database.From(ctx).QueryContext(ctx, query, clientID, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	projects := make([]models.Project, 0)
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		projects = append(projects, project)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(projects); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get a project
+// @Description Get a project by ID
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id} [get]
+func GetProject(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetProject called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	project, err := scanProject(database.From(ctx).QueryRowContext(ctx, "SELECT "+projectColumns+" FROM projects WHERE id = $1 AND organization_id = $2", id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying project: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(project); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Create a project
+// @Description Create a new project, optionally for a client
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param project body models.Project true "Project"
+// @Success 201 {object} models.Project
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects [post]
+func CreateProject(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateProject called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var project models.Project
+	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if !validateProject(ctx, w, project) {
+		return
+	}
+
+	project.CreatedAt = time.Now().UTC()
+	project.UpdatedAt = project.CreatedAt
+	err := database.From(ctx).QueryRowContext(ctx, "INSERT INTO projects (organization_id, client_id, name, archived, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		tenant(ctx), project.ClientID, project.Name, project.Archived, project.CreatedAt, project.UpdatedAt).Scan(&project.ID)
+	if err != nil {
+		logger.Error("Error inserting project: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Project created with ID %d", project.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(project); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Update a project
+// @Description Change a project's name, client or archived flag
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param project body models.Project true "Project"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id} [patch]
+func UpdateProject(w http.ResponseWriter, r *http.Request) {
+	logger.Info("UpdateProject called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var project models.Project
+	if err = json.NewDecoder(r.Body).Decode(&project); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if !validateProject(ctx, w, project) {
+		return
+	}
+
+	project, err = scanProject(database.From(ctx).QueryRowContext(ctx, `
+		UPDATE projects SET client_id = $1, name = $2, archived = $3, updated_at = $4
+		WHERE id = $5 AND organization_id = $6
+		RETURNING `+projectColumns,
+		project.ClientID, project.Name, project.Archived, time.Now().UTC(), id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error updating project: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(project); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a project
+// @Description Delete a project that has no tracked time. Projects with tasks should be archived instead.
+// @Tags projects
+// @Param id path int true "Project ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id} [delete]
+func DeleteProject(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteProject called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	if err = projectInTenant(ctx, database.From(ctx), id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying project: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var tasks int
+	if err = database.From(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE project_id = $1", id).Scan(&tasks); err != nil {
+		logger.Error("Error counting tasks: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tasks > 0 {
+		http.Error(w, "Project has tracked time, archive it instead", http.StatusConflict)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "DELETE FROM projects WHERE id = $1 AND organization_id = $2", id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error deleting project: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("Project %d deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Get project members
+// @Description List the users allowed to log time to a project
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.ProjectMember
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id}/members [get]
+func GetProjectMembers(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetProjectMembers called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT m.project_id, m.user_id, m.created_at
+		FROM project_members m
+		JOIN projects p ON p.id = m.project_id
+		WHERE m.project_id = $1 AND p.organization_id = $2
+		ORDER BY m.user_id`, id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	members := make([]models.ProjectMember, 0)
+	for rows.Next() {
+		var member models.ProjectMember
+		if err = rows.Scan(&member.ProjectID, &member.UserID, &member.CreatedAt); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(members); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Add a project member
+// @Description Allow a user to log time to a project
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param member body models.ProjectMember true "Member (only userId is read)"
+// @Success 201 {object} models.ProjectMember
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id}/members [post]
+func AddProjectMember(w http.ResponseWriter, r *http.Request) {
+	logger.Info("AddProjectMember called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var member models.ProjectMember
+	if err = json.NewDecoder(r.Body).Decode(&member); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	member.ProjectID = id
+
+	err = database.From(ctx).QueryRowContext(ctx, `
+		INSERT INTO project_members (project_id, user_id)
+		SELECT p.id, u.id FROM projects p, users u
+		WHERE p.id = $1 AND u.id = $2 AND u.deleted_at IS NULL
+		AND p.organization_id = $3 AND u.organization_id = $3
+		ON CONFLICT (project_id, user_id) DO UPDATE SET project_id = EXCLUDED.project_id
+		RETURNING created_at`, member.ProjectID, member.UserID, tenant(ctx)).Scan(&member.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project or user not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error adding project member: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Info("User %d added to project %d", member.UserID, member.ProjectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(member); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Remove a project member
+// @Description Stop a user from logging time to a project. Existing tasks are kept.
+// @Tags projects
+// @Param id path int true "Project ID"
+// @Param userId path int true "User ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /projects/{id}/members/{userId} [delete]
+func RemoveProjectMember(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RemoveProjectMember called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	params := mux.Vars(r)
+	projectID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.Atoi(params["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, `
+		DELETE FROM project_members
+		WHERE project_id = $1 AND user_id = $2
+		AND project_id IN (SELECT id FROM projects WHERE organization_id = $3)`, projectID, userID, tenant(ctx))
+	if err != nil {
+		logger.Error("Error removing project member: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("User %d removed from project %d", userID, projectID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateProject(ctx context.Context, w http.ResponseWriter, project models.Project) bool {
+	if project.Name == "" || len(project.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return false
+	}
+	if project.ClientID == nil {
+		return true
+	}
+
+	var exists bool
+	if err := database.From(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM clients WHERE id = $1 AND organization_id = $2)", *project.ClientID, tenant(ctx)).Scan(&exists); err != nil {
+		logger.Error("Error querying client: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, "Client not found", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func scanProject(row rowScanner) (models.Project, error) {
+	var (
+		project  models.Project
+		clientID sql.NullInt64
+	)
+	err := row.Scan(&project.ID, &clientID, &project.Name, &project.Archived, &project.CreatedAt, &project.UpdatedAt)
+	if clientID.Valid {
+		id := int(clientID.Int64)
+		project.ClientID = &id
+	}
+	return project, err
+}
+
+// checkProjectAccess verifies that userID may log time to projectID. Projects
+// of other organizations are not found.
+func checkProjectAccess(ctx context.Context, tx *sql.Tx, projectID, userID int) error {
+	var archived, member bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT p.archived, EXISTS (SELECT 1 FROM project_members m WHERE m.project_id = p.id AND m.user_id = $2)
+		FROM projects p
+		WHERE p.id = $1 AND p.organization_id = $3`, projectID, userID, tenant(ctx)).Scan(&archived, &member)
+	if err == sql.ErrNoRows {
+		return errProjectNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if archived {
+		return errProjectArchived
+	}
+	if !member {
+		return errNotProjectMember
+	}
+	return nil
+}
+
+// writeProjectAccessError maps checkProjectAccess errors to HTTP responses.
+func writeProjectAccessError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errProjectNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errProjectArchived), errors.Is(err, errNotProjectMember):
+		logger.Warning("Project access refused: %v", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		logger.Error("Error checking project access: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
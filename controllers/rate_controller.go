@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+const rateColumns = "id, user_id, project_id, amount, currency, effective_from, created_at"
+
+// rateOrganization is the organization a row of rates belongs to, through its
+// user or project.
+const rateOrganization = `COALESCE(
+	(SELECT organization_id FROM users WHERE id = rates.user_id),
+	(SELECT organization_id FROM projects WHERE id = rates.project_id))`
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// @Summary Get rates
+// @Description Get the rate history, optionally for one user or project, newest first
+// @Tags rates
+// @Produce json
+// @Param userId query int false "User ID"
+// @Param projectId query int false "Project ID"
+// @Success 200 {array} models.Rate
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates [get]
+func GetRates(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetRates called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userId"))
+	projectID, _ := strconv.Atoi(r.URL.Query().Get("projectId"))
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT `+rateColumns+` FROM rates
+		WHERE ($1 = 0 OR user_id = $1) AND ($2 = 0 OR project_id = $2)
+		AND `+rateOrganization+` = $3
+		ORDER BY effective_from DESC, id DESC`, userID, projectID, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	rates := make([]models.Rate, 0)
+	for rows.Next() {
+		rate, err := scanRate(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rates = append(rates, rate)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(rates); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Create a rate
+// @Description Set an hourly rate in minor units for a user, a project or a user on a project, effective from effectiveFrom (default now). Earlier rates stay in the history. Requires the admin token.
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param rate body models.Rate true "Rate"
+// @Success 201 {object} models.Rate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates [post]
+func CreateRate(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateRate called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Setting rates requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var rate models.Rate
+	if err := json.NewDecoder(r.Body).Decode(&rate); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if rate.UserID == nil && rate.ProjectID == nil {
+		http.Error(w, "userId or projectId is required", http.StatusBadRequest)
+		return
+	}
+	if rate.Amount < 0 {
+		http.Error(w, "amount must not be negative", http.StatusBadRequest)
+		return
+	}
+	rate.Currency = strings.ToUpper(strings.TrimSpace(rate.Currency))
+	if rate.Currency == "" {
+		rate.Currency = cfg.Billing.Currency
+	}
+	if !currencyCode.MatchString(rate.Currency) {
+		http.Error(w, "currency must be a three-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+	if rate.EffectiveFrom.IsZero() {
+		rate.EffectiveFrom = time.Now().UTC()
+	}
+
+	if err := rateScopeInTenant(ctx, rate); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User or project not found", http.StatusBadRequest)
+		} else {
+			logger.Error("Error checking rate scope: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rate, err := scanRate(database.From(ctx).QueryRowContext(ctx, `
+		INSERT INTO rates (user_id, project_id, amount, currency, effective_from)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+rateColumns,
+		rate.UserID, rate.ProjectID, rate.Amount, rate.Currency, rate.EffectiveFrom.UTC()))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			http.Error(w, "User or project not found", http.StatusBadRequest)
+		} else if ok && pqErr.Code == "23505" {
+			http.Error(w, "A rate for this scope already starts at effectiveFrom", http.StatusConflict)
+		} else {
+			logger.Error("Error inserting rate: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Info("Rate %d created", rate.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(rate); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a rate
+// @Description Remove a rate from the history. Requires the admin token.
+// @Tags rates
+// @Param id path int true "Rate ID"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /rates/{id} [delete]
+func DeleteRate(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteRate called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Deleting rates requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rate ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "DELETE FROM rates WHERE id = $1 AND "+rateOrganization+" = $2", id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error deleting rate: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Rate not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func scanRate(row rowScanner) (models.Rate, error) {
+	var (
+		rate              models.Rate
+		userID, projectID sql.NullInt64
+	)
+	err := row.Scan(&rate.ID, &userID, &projectID, &rate.Amount, &rate.Currency, &rate.EffectiveFrom, &rate.CreatedAt)
+	if err != nil {
+		return rate, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		rate.UserID = &id
+	}
+	if projectID.Valid {
+		id := int(projectID.Int64)
+		rate.ProjectID = &id
+	}
+	return rate, nil
+}
+
+// rateScopeInTenant returns sql.ErrNoRows unless the rate's user and project
+// belong to the request's organization.
+func rateScopeInTenant(ctx context.Context, rate models.Rate) error {
+	if rate.UserID != nil {
+		if err := userInTenant(ctx, database.From(ctx), *rate.UserID); err != nil {
+			return err
+		}
+	}
+	if rate.ProjectID != nil {
+		return projectInTenant(ctx, database.From(ctx), *rate.ProjectID)
+	}
+	return nil
+}
+
+// rateLateral picks the rate in force at the start of task t. A user's rate on
+// the project wins over the project's rate, which wins over the user's rate.
+const rateLateral = `
+	LEFT JOIN LATERAL (
+		SELECT r.amount, r.currency FROM rates r
+		WHERE r.effective_from <= t.start_time
+		AND ((r.user_id = t.user_id AND r.project_id = t.project_id)
+			OR (r.user_id IS NULL AND r.project_id = t.project_id)
+			OR (r.user_id = t.user_id AND r.project_id IS NULL))
+		ORDER BY (r.user_id IS NOT NULL AND r.project_id IS NOT NULL) DESC, (r.project_id IS NOT NULL) DESC, r.effective_from DESC
+		LIMIT 1
+	) rate ON TRUE`
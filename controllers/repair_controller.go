@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/repair"
+	"time"
+)
+
+const defaultStaleHours = 12
+
+// @Summary Detect task anomalies
+// @Description List overlapping tasks, tasks left running longer than staleHours and stored durations that disagree with the interval, along with the fixes that would resolve them (admin only)
+// @Tags admin
+// @Produce json
+// @Param staleHours query int false "Hours after which a running task is stale (default 12)"
+// @Param userId query int false "Restrict to one user"
+// @Success 200 {object} repair.Report
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/tasks/anomalies [get]
+func GetTaskAnomalies(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTaskAnomalies called")
+	runTaskRepair(w, r, false)
+}
+
+// @Summary Repair task anomalies
+// @Description Truncate or split overlapping tasks, close stale running tasks and recompute durations. mode=commit applies the fixes, otherwise they are only reported (admin only)
+// @Tags admin
+// @Produce json
+// @Param mode query string false "dry-run (default) or commit"
+// @Param staleHours query int false "Hours after which a running task is stale (default 12)"
+// @Param userId query int false "Restrict to one user"
+// @Success 200 {object} repair.Report
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/tasks/repair [post]
+func RepairTasks(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RepairTasks called")
+
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "dry-run" && mode != "commit" {
+		http.Error(w, "mode must be dry-run or commit", http.StatusBadRequest)
+		return
+	}
+	runTaskRepair(w, r, mode == "commit")
+}
+
+func runTaskRepair(w http.ResponseWriter, r *http.Request, commit bool) {
+	if !isAdmin(r) {
+		logger.Warning("Task repair refused: not an admin")
+		http.Error(w, "Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	staleHours := defaultStaleHours
+	if v := r.URL.Query().Get("staleHours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "staleHours must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		staleHours = n
+	}
+	var userID int
+	if v := r.URL.Query().Get("userId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		userID = n
+	}
+
+	opts := repair.Options{StaleAfter: time.Duration(staleHours) * time.Hour, UserID: userID, OrganizationID: tenant(r.Context())}
+	report, err := repair.Run(r.Context(), database.From(r.Context()), opts, commit)
+	if err != nil {
+		logger.Error("Task repair failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Task repair found %d issues, %d fixes (committed=%t)", len(report.Issues), len(report.Fixes), report.Committed)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,501 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"net/http"
+	"sort"
+	"strconv"
+	"test-project/billing"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+// @Summary Time report
+// @Description Sum completed task time grouped by project or client, optionally for one user and a date range. Dates are days in each user's timezone.
+// @Tags reports
+// @Produce json
+// @Param groupBy query string false "project (default) or client"
+// @Param userId query int false "Restrict to one user"
+// @Param startTime query string false "Start date (YYYY-MM-DD)"
+// @Param endTime query string false "End date (YYYY-MM-DD)"
+// @Success 200 {array} models.TimeReportRow
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/time [get]
+func GetTimeReport(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTimeReport called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy == "" {
+		groupBy = "project"
+	}
+	if groupBy != "project" && groupBy != "client" {
+		http.Error(w, "groupBy must be project or client", http.StatusBadRequest)
+		return
+	}
+
+	userID := 0
+	if v := r.URL.Query().Get("userId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		userID = n
+	}
+
+	startDate, endDate, err := reportDates(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	selectCols := "p.id, COALESCE(p.name, ''), c.id, COALESCE(c.name, '')"
+	groupCols := "p.id, p.name, c.id, c.name"
+	if groupBy == "client" {
+		selectCols = "NULL::INTEGER, '', c.id, COALESCE(c.name, '')"
+		groupCols = "c.id, c.name"
+	}
+
+	query := `
+		SELECT ` + selectCols + `, COUNT(*), COALESCE(SUM(COALESCE(t.hours, 0) * 60 + COALESCE(t.minutes, 0)), 0)
+		FROM tasks t
+		JOIN users u ON u.id = t.user_id AND u.deleted_at IS NULL AND u.organization_id = $4
+		LEFT JOIN projects p ON p.id = t.project_id
+		LEFT JOIN clients c ON c.id = p.client_id
+		WHERE t.end_time IS NOT NULL
+		AND ($1 = 0 OR t.user_id = $1)
+		AND ($2::date IS NULL OR t.start_time >= ($2::date::timestamp AT TIME ZONE u.timezone))
+		AND ($3::date IS NULL OR t.start_time < (($3::date + 1)::timestamp AT TIME ZONE u.timezone))
+		GROUP BY ` + groupCols + `
+		ORDER BY 6 DESC`
+
+	rows, err := database.From(ctx).QueryContext(ctx, query, userID, startDate, endDate, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report := make([]models.TimeReportRow, 0)
+	for rows.Next() {
+		var (
+			row                 models.TimeReportRow
+			projectID, clientID sql.NullInt64
+		)
+		if err = rows.Scan(&projectID, &row.ProjectName, &clientID, &row.ClientName, &row.Tasks, &row.TotalMinutes); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if projectID.Valid {
+			id := int(projectID.Int64)
+			row.ProjectID = &id
+		}
+		if clientID.Valid {
+			id := int(clientID.Int64)
+			row.ClientID = &id
+		}
+		row.Hours = row.TotalMinutes / 60
+		row.Minutes = row.TotalMinutes % 60
+		report = append(report, row)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Cost report
+// @Description Price completed billable tasks at the rate in force at each task's start, after rounding each task's duration. Results are grouped by user, project or client and by currency; time without a rate has an empty currency. Dates are days in each user's timezone.
+// @Tags reports
+// @Produce json
+// @Param groupBy query string false "project (default), client or user"
+// @Param userId query int false "Restrict to one user"
+// @Param startTime query string false "Start date (YYYY-MM-DD)"
+// @Param endTime query string false "End date (YYYY-MM-DD)"
+// @Success 200 {array} models.CostReportRow
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/cost [get]
+func GetCostReport(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetCostReport called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy == "" {
+		groupBy = "project"
+	}
+	if groupBy != "project" && groupBy != "client" && groupBy != "user" {
+		http.Error(w, "groupBy must be project, client or user", http.StatusBadRequest)
+		return
+	}
+
+	userID := 0
+	if v := r.URL.Query().Get("userId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		userID = n
+	}
+
+	startDate, endDate, err := reportDates(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT t.user_id, u.name || ' ' || u.surname, p.id, COALESCE(p.name, ''), c.id, COALESCE(c.name, ''),
+			FLOOR(EXTRACT(EPOCH FROM t.end_time - t.start_time) / 60)::INTEGER,
+			rate.amount, COALESCE(rate.currency, '')
+		FROM tasks t
+		JOIN users u ON u.id = t.user_id AND u.deleted_at IS NULL AND u.organization_id = $4
+		LEFT JOIN projects p ON p.id = t.project_id
+		LEFT JOIN clients c ON c.id = p.client_id`+rateLateral+`
+		WHERE t.end_time IS NOT NULL AND t.billable
+		AND ($1 = 0 OR t.user_id = $1)
+		AND ($2::date IS NULL OR t.start_time >= ($2::date::timestamp AT TIME ZONE u.timezone))
+		AND ($3::date IS NULL OR t.start_time < (($3::date + 1)::timestamp AT TIME ZONE u.timezone))`,
+		userID, startDate, endDate, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type groupKey struct {
+		id       int64
+		currency string
+	}
+	groups := make(map[groupKey]*models.CostReportRow)
+	report := make([]*models.CostReportRow, 0)
+	for rows.Next() {
+		var (
+			taskUserID          int
+			userName            string
+			projectID, clientID sql.NullInt64
+			projectName         string
+			clientName          string
+			minutes             int
+			amount              sql.NullInt64
+			currency            string
+		)
+		if err = rows.Scan(&taskUserID, &userName, &projectID, &projectName, &clientID, &clientName, &minutes, &amount, &currency); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		key := groupKey{id: projectID.Int64, currency: currency}
+		switch groupBy {
+		case "client":
+			key.id = clientID.Int64
+		case "user":
+			key.id = int64(taskUserID)
+		}
+		row, ok := groups[key]
+		if !ok {
+			row = &models.CostReportRow{Currency: currency}
+			switch groupBy {
+			case "user":
+				id := taskUserID
+				row.UserID = &id
+				row.UserName = userName
+			case "client":
+				if clientID.Valid {
+					id := int(clientID.Int64)
+					row.ClientID = &id
+					row.ClientName = clientName
+				}
+			default:
+				if projectID.Valid {
+					id := int(projectID.Int64)
+					row.ProjectID = &id
+					row.ProjectName = projectName
+				}
+				if clientID.Valid {
+					id := int(clientID.Int64)
+					row.ClientID = &id
+					row.ClientName = clientName
+				}
+			}
+			groups[key] = row
+			report = append(report, row)
+		}
+
+		billable := billing.RoundMinutes(minutes, cfg.Billing)
+		row.Tasks++
+		row.TrackedMinutes += minutes
+		row.BillableMinutes += billable
+		if amount.Valid {
+			row.Amount += billing.Cost(billable, amount.Int64)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].Currency != report[j].Currency {
+			return report[i].Currency < report[j].Currency
+		}
+		return report[i].Amount > report[j].Amount
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// maxAttendanceDays bounds the date range of an attendance report.
+const maxAttendanceDays = 366
+
+// @Summary Attendance report
+// @Description Compare each user's completed task time with their working hours, day by day in the user's timezone. Days in the user's holiday calendar expect no work. Overtime and undertime are summed per day.
+// @Tags reports
+// @Produce json
+// @Param userId query int false "Restrict to one user"
+// @Param startTime query string true "Start date (YYYY-MM-DD)"
+// @Param endTime query string true "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {array} models.AttendanceReportRow
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /reports/attendance [get]
+func GetAttendanceReport(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetAttendanceReport called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID := 0
+	if v := r.URL.Query().Get("userId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		userID = n
+	}
+
+	startDate, err := time.Parse("2006-01-02", r.URL.Query().Get("startTime"))
+	if err != nil {
+		http.Error(w, "Invalid start_time format, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", r.URL.Query().Get("endTime"))
+	if err != nil {
+		http.Error(w, "Invalid end_time format, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if endDate.Before(startDate) || endDate.Sub(startDate) >= maxAttendanceDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("endTime must be on or after startTime and within %d days", maxAttendanceDays), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT id, name || ' ' || surname
+		FROM users
+		WHERE organization_id = $1 AND deleted_at IS NULL AND ($2 = 0 OR id = $2)
+		ORDER BY id`, tenant(ctx), userID)
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report := make([]*models.AttendanceReportRow, 0)
+	var ids []int64
+	for rows.Next() {
+		var row models.AttendanceReportRow
+		if err = rows.Scan(&row.UserID, &row.UserName); err != nil {
+			rows.Close()
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report = append(report, &row)
+		ids = append(ids, int64(row.UserID))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	schedules, err := loadWorkSchedules(ctx, database.From(ctx), ids)
+	if err != nil {
+		logger.Error("Error loading work schedules: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var calendarIDs []int64
+	for _, schedule := range schedules {
+		if schedule.HolidayCalendarID != nil {
+			calendarIDs = append(calendarIDs, int64(*schedule.HolidayCalendarID))
+		}
+	}
+	holidays, err := loadHolidays(ctx, database.From(ctx), calendarIDs, startDate, endDate)
+	if err != nil {
+		logger.Error("Error loading holidays: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	actual, err := loadDailyMinutes(ctx, database.From(ctx), ids, startDate, endDate)
+	if err != nil {
+		logger.Error("Error loading tracked time: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, row := range report {
+		schedule, ok := schedules[row.UserID]
+		if !ok {
+			continue
+		}
+		row.Timezone = schedule.Timezone
+		var calendar map[string]string
+		if schedule.HolidayCalendarID != nil {
+			calendar = holidays[*schedule.HolidayCalendarID]
+		}
+
+		row.Days = make([]models.AttendanceDay, 0)
+		for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+			day := models.AttendanceDay{Date: d.Format("2006-01-02")}
+			day.ActualMinutes = actual[row.UserID][day.Date]
+			if name, ok := calendar[day.Date]; ok {
+				day.Holiday = name
+				row.Holidays++
+			} else {
+				day.ExpectedMinutes = expectedMinutes(schedule, d)
+			}
+
+			row.ExpectedMinutes += day.ExpectedMinutes
+			row.ActualMinutes += day.ActualMinutes
+			if diff := day.ActualMinutes - day.ExpectedMinutes; diff > 0 {
+				row.OvertimeMinutes += diff
+			} else {
+				row.UndertimeMinutes -= diff
+			}
+			row.Days = append(row.Days, day)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// reportDates parses the optional startTime and endTime query parameters of
+// a report. Both are calendar days, compared against each user's own
+// timezone; a missing bound is returned as NULL.
+func reportDates(r *http.Request) (sql.NullString, sql.NullString, error) {
+	var start, end sql.NullString
+	if v := r.URL.Query().Get("startTime"); v != "" {
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return start, end, fmt.Errorf("Invalid start_time format, expected YYYY-MM-DD")
+		}
+		start = sql.NullString{String: v, Valid: true}
+	}
+	if v := r.URL.Query().Get("endTime"); v != "" {
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return start, end, fmt.Errorf("Invalid end_time format, expected YYYY-MM-DD")
+		}
+		end = sql.NullString{String: v, Valid: true}
+	}
+	return start, end, nil
+}
+
+// loadHolidays returns the holidays between start and end, inclusive, keyed
+// by calendar ID and then by date.
+func loadHolidays(ctx context.Context, q dbQuerier, calendarIDs []int64, start, end time.Time) (map[int]map[string]string, error) {
+	holidays := make(map[int]map[string]string)
+	if len(calendarIDs) == 0 {
+		return holidays, nil
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT calendar_id, to_char(day, 'YYYY-MM-DD'), name
+		FROM holidays
+		WHERE calendar_id = ANY($1) AND day BETWEEN $2::date AND $3::date`,
+		pq.Array(calendarIDs), start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			calendarID int
+			day, name  string
+		)
+		if err = rows.Scan(&calendarID, &day, &name); err != nil {
+			return nil, err
+		}
+		if holidays[calendarID] == nil {
+			holidays[calendarID] = make(map[string]string)
+		}
+		holidays[calendarID][day] = name
+	}
+	return holidays, rows.Err()
+}
+
+// loadDailyMinutes returns the completed task time of the users per day in
+// each user's timezone, keyed by user ID and then by date.
+func loadDailyMinutes(ctx context.Context, q dbQuerier, userIDs []int64, start, end time.Time) (map[int]map[string]int, error) {
+	minutes := make(map[int]map[string]int)
+	if len(userIDs) == 0 {
+		return minutes, nil
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT t.user_id, to_char(t.start_time AT TIME ZONE u.timezone, 'YYYY-MM-DD'),
+			SUM(COALESCE(t.hours, 0) * 60 + COALESCE(t.minutes, 0))
+		FROM tasks t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.end_time IS NOT NULL AND t.user_id = ANY($1)
+		AND t.start_time >= ($2::date::timestamp AT TIME ZONE u.timezone)
+		AND t.start_time < (($3::date + 1)::timestamp AT TIME ZONE u.timezone)
+		GROUP BY 1, 2`,
+		pq.Array(userIDs), start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			userID, total int
+			day           string
+		)
+		if err = rows.Scan(&userID, &day, &total); err != nil {
+			return nil, err
+		}
+		if minutes[userID] == nil {
+			minutes[userID] = make(map[string]int)
+		}
+		minutes[userID][day] = total
+	}
+	return minutes, rows.Err()
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/middleware"
+	"time"
+)
+
+// PurgeDeletedUsers permanently removes users that were soft-deleted more than
+// retention ago, together with their tasks, and returns how many were removed.
+func PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int, error) {
+	cutoff := time.Now().UTC().Add(-retention)
+
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT id, organization_id FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("error selecting users to purge: %w", err)
+	}
+	// Users are looked up within an organization, so each one is purged in its own.
+	orgs := make(map[int]int)
+	var ids []int
+	for rows.Next() {
+		var id, orgID int
+		if err = rows.Scan(&id, &orgID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning user id: %w", err)
+		}
+		ids = append(ids, id)
+		orgs[id] = orgID
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating users to purge: %w", err)
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err = hardDeleteUser(middleware.WithOrganization(ctx, orgs[id]), id); err != nil {
+			return purged, err
+		}
+		if err = removeUserFromMigrationFile(id); err != nil {
+			logger.Error("Error removing user from migration file: %v", err)
+		}
+		if err = removeTaskFromMigrationFile(id); err != nil {
+			logger.Error("Error removing task from migration file: %v", err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// PurgeOldEvents removes outbox events dispatched more than retention ago,
+// together with their webhook deliveries, unless a delivery is still pending.
+func PurgeOldEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-retention)
+	res, err := database.From(ctx).ExecContext(ctx, `
+		DELETE FROM outbox_events e
+		WHERE e.dispatched_at < $1
+			AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id AND d.status = 'pending')`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("error purging old events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PurgeFinishedJobs removes jobs that finished more than retention ago,
+// together with their results, and returns how many were removed.
+func PurgeFinishedJobs(ctx context.Context, retention time.Duration) (int64, error) {
+	cutoff := time.Now().UTC().Add(-retention)
+	res, err := database.From(ctx).ExecContext(ctx, "DELETE FROM jobs WHERE status IN ('succeeded', 'failed', 'cancelled') AND finished_at < $1", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("error purging finished jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
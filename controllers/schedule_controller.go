@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+// defaultWorkingDays is the schedule of users without their own working hours.
+var defaultWorkingDays = []models.WorkingDay{
+	{Weekday: 1, Start: "09:00", End: "17:00"},
+	{Weekday: 2, Start: "09:00", End: "17:00"},
+	{Weekday: 3, Start: "09:00", End: "17:00"},
+	{Weekday: 4, Start: "09:00", End: "17:00"},
+	{Weekday: 5, Start: "09:00", End: "17:00"},
+}
+
+// @Summary Get a user's work schedule
+// @Description Get the user's weekly working hours, timezone and holiday calendar
+// @Tags schedules
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.WorkSchedule
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/schedule [get]
+func GetWorkSchedule(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetWorkSchedule called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	writeWorkSchedule(ctx, w, id)
+}
+
+// @Summary Set a user's work schedule
+// @Description Replace the user's weekly working hours and holiday calendar. Omitting days restores the default schedule; an empty list means no working days. The timezone is changed on the user.
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param schedule body models.WorkSchedule true "Working hours and holiday calendar"
+// @Success 200 {object} models.WorkSchedule
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/schedule [put]
+func SetWorkSchedule(w http.ResponseWriter, r *http.Request) {
+	logger.Info("SetWorkSchedule called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.WorkSchedule
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if err = validateWorkingDays(req.Days); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err = userInTenant(ctx, tx, id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying user: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if req.HolidayCalendarID != nil {
+		var exists bool
+		if err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM holiday_calendars WHERE id = $1 AND organization_id = $2)", *req.HolidayCalendarID, tenant(ctx)).Scan(&exists); err != nil {
+			logger.Error("Error querying calendar: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Holiday calendar not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET holiday_calendar_id = $1, custom_working_hours = $2 WHERE id = $3",
+		req.HolidayCalendarID, req.Days != nil, id); err != nil {
+		logger.Error("Error updating user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM working_hours WHERE user_id = $1", id); err != nil {
+		logger.Error("Error clearing working hours: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, day := range req.Days {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO working_hours (user_id, weekday, start_time, end_time) VALUES ($1, $2, $3, $4)",
+			id, day.Weekday, day.Start, day.End); err != nil {
+			logger.Error("Error inserting working hours: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		logger.Error("Error committing transaction: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Work schedule of user %d updated", id)
+
+	writeWorkSchedule(ctx, w, id)
+}
+
+func writeWorkSchedule(ctx context.Context, w http.ResponseWriter, userID int) {
+	schedules, err := loadWorkSchedules(ctx, database.From(ctx), []int64{int64(userID)})
+	if err != nil {
+		logger.Error("Error loading work schedule: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	schedule, ok := schedules[userID]
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(schedule); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// loadWorkSchedules returns the schedules of the users, keyed by user ID.
+// Users that do not exist in the request's organization are left out.
+func loadWorkSchedules(ctx context.Context, q dbQuerier, userIDs []int64) (map[int]*models.WorkSchedule, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, timezone, holiday_calendar_id, custom_working_hours
+		FROM users
+		WHERE id = ANY($1) AND organization_id = $2 AND deleted_at IS NULL`, pq.Array(userIDs), tenant(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("error loading users: %w", err)
+	}
+	schedules := make(map[int]*models.WorkSchedule, len(userIDs))
+	for rows.Next() {
+		var (
+			schedule   models.WorkSchedule
+			calendarID sql.NullInt64
+			custom     bool
+		)
+		if err = rows.Scan(&schedule.UserID, &schedule.Timezone, &calendarID, &custom); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		if calendarID.Valid {
+			id := int(calendarID.Int64)
+			schedule.HolidayCalendarID = &id
+		}
+		schedule.Days = make([]models.WorkingDay, 0)
+		if !custom {
+			schedule.Default = true
+			schedule.Days = append(schedule.Days, defaultWorkingDays...)
+		}
+		schedules[schedule.UserID] = &schedule
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+
+	rows, err = q.QueryContext(ctx, `
+		SELECT user_id, weekday, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM working_hours
+		WHERE user_id = ANY($1)
+		ORDER BY user_id, weekday`, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error loading working hours: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			userID int
+			day    models.WorkingDay
+		)
+		if err = rows.Scan(&userID, &day.Weekday, &day.Start, &day.End); err != nil {
+			return nil, fmt.Errorf("error scanning working hours: %w", err)
+		}
+		if schedule, ok := schedules[userID]; ok && !schedule.Default {
+			schedule.Days = append(schedule.Days, day)
+		}
+	}
+	return schedules, rows.Err()
+}
+
+// validateWorkingDays checks that each weekday appears at most once and ends
+// after it starts.
+func validateWorkingDays(days []models.WorkingDay) error {
+	seen := make(map[int]bool, len(days))
+	for _, day := range days {
+		if day.Weekday < 1 || day.Weekday > 7 {
+			return fmt.Errorf("weekday must be between 1 (Monday) and 7 (Sunday)")
+		}
+		if seen[day.Weekday] {
+			return fmt.Errorf("weekday %d is listed twice", day.Weekday)
+		}
+		seen[day.Weekday] = true
+		start, err := time.Parse("15:04", day.Start)
+		if err != nil {
+			return fmt.Errorf("invalid start %q, expected HH:MM", day.Start)
+		}
+		end, err := time.Parse("15:04", day.End)
+		if err != nil {
+			return fmt.Errorf("invalid end %q, expected HH:MM", day.End)
+		}
+		if !end.After(start) {
+			return fmt.Errorf("working hours of weekday %d must end after they start", day.Weekday)
+		}
+	}
+	return nil
+}
+
+// expectedMinutes returns the working minutes the schedule plans for day,
+// which is a calendar day in the user's timezone.
+func expectedMinutes(schedule *models.WorkSchedule, day time.Time) int {
+	weekday := int(day.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+	for _, d := range schedule.Days {
+		if d.Weekday != weekday {
+			continue
+		}
+		start, _ := time.Parse("15:04", d.Start)
+		end, _ := time.Parse("15:04", d.End)
+		return int(end.Sub(start) / time.Minute)
+	}
+	return 0
+}
+
+// userLocation returns the timezone of the user, or UTC if the user does not
+// exist in the request's organization.
+func userLocation(ctx context.Context, userID int) (*time.Location, error) {
+	var timezone string
+	err := database.From(ctx).QueryRowContext(ctx, "SELECT timezone FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL", userID, tenant(ctx)).Scan(&timezone)
+	if err == sql.ErrNoRows {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"test-project/broker"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"test-project/outbox"
+	"time"
+)
+
+const (
+	// LastEventIDHeader is sent by EventSource clients when they reconnect.
+	LastEventIDHeader = "Last-Event-ID"
+	// maxReplayedEvents bounds the events replayed to a reconnecting client.
+	// The timers event that follows the replay is complete either way.
+	maxReplayedEvents = 1000
+)
+
+var timerEventTypes = []string{outbox.EventTaskStarted, outbox.EventTaskStopped}
+
+// @Summary Stream timer events
+// @Description Server-Sent Events stream of the organization's timers. task.started and task.stopped events carry the event ID as their id, and a reconnecting client that sends Last-Event-ID (or the lastEventId query parameter) first receives the events it missed. A timers event with every running timer and its elapsed time is sent on connect and every streams.tick_interval, and a heartbeat comment every streams.heartbeat_interval. The stream ends after streams.max_duration.
+// @Tags events
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "ID of the last event received"
+// @Param lastEventId query int false "ID of the last event received, for clients that cannot set headers"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /events/timers [get]
+func StreamTimers(w http.ResponseWriter, r *http.Request) {
+	logger.Info("StreamTimers called")
+
+	streamTimers(w, r, 0)
+}
+
+// @Summary Stream a user's timer events
+// @Description Like /events/timers, limited to one user's timers.
+// @Tags events
+// @Produce text/event-stream
+// @Param id path int true "User ID"
+// @Param Last-Event-ID header int false "ID of the last event received"
+// @Param lastEventId query int false "ID of the last event received, for clients that cannot set headers"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/events/timers [get]
+func StreamUserTimers(w http.ResponseWriter, r *http.Request) {
+	logger.Info("StreamUserTimers called")
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.Warning("Invalid user ID: %v", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = withTenantScope(r, func(ctx context.Context) error {
+		return database.From(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL)", userID, tenant(ctx)).Scan(&exists)
+	})
+	if err != nil {
+		logger.Error("Error checking user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	streamTimers(w, r, userID)
+}
+
+// streamTimers serves the timer stream of the request's organization, or of
+// one user when userID is not 0. The stream is fed by the broker rather than
+// by polling, and only borrows a database connection to catch up.
+func streamTimers(w http.ResponseWriter, r *http.Request, userID int) {
+	ctx := r.Context()
+	orgID := tenant(ctx)
+
+	lastID, err := parseLastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before catching up, so nothing committed in between is lost.
+	sub := broker.Subscribe(orgID, userID, timerEventTypes...)
+	defer sub.Close()
+
+	var (
+		missed  []broker.Event
+		running map[int]models.RunningTimer
+	)
+	err = withTenantScope(r, func(ctx context.Context) error {
+		var err error
+		if lastID > 0 {
+			if missed, err = loadTimerEvents(ctx, userID, lastID); err != nil {
+				return err
+			}
+		}
+		running, err = loadRunningTimers(ctx, userID)
+		return err
+	})
+	if err != nil {
+		logger.Error("Error loading timers: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	// send writes one message and flushes it. The server's write timeout
+	// would otherwise end the stream, so each write gets its own deadline.
+	send := func(message string) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(cfg.Server.WriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := fmt.Fprint(w, message); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	replayed := make(map[int64]bool, len(missed))
+	for _, event := range missed {
+		if err = send(formatTimerEvent(event)); err != nil {
+			return
+		}
+		replayed[event.ID] = true
+	}
+	if err = send(formatTimerTick(running, time.Now().UTC())); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(cfg.Streams.HeartbeatInterval)
+	defer heartbeat.Stop()
+	tick := time.NewTicker(cfg.Streams.TickInterval)
+	defer tick.Stop()
+	expired := time.NewTimer(cfg.Streams.MaxDuration)
+	defer expired.Stop()
+
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired.C:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// The subscriber fell behind or the server is shutting down.
+				// The client reconnects and catches up from its last event.
+				return
+			}
+			applyTimerEvent(running, event)
+			if !replayed[event.ID] {
+				err = send(formatTimerEvent(event))
+			}
+		case now := <-tick.C:
+			err = send(formatTimerTick(running, now.UTC()))
+		case <-heartbeat.C:
+			err = send(": heartbeat\n\n")
+		}
+	}
+}
+
+// withTenantScope runs fn on a connection scoped to the request's
+// organization, bounded by the query timeout. Streams are not wrapped in
+// middleware.ScopeDB, which would hold a connection for as long as they last.
+func withTenantScope(r *http.Request, fn func(ctx context.Context) error) error {
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	return database.WithScope(ctx, strconv.Itoa(tenant(ctx)), fn)
+}
+
+func parseLastEventID(r *http.Request) (int64, error) {
+	value := r.Header.Get(LastEventIDHeader)
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errors.New("Last-Event-ID must be an event ID")
+	}
+	return id, nil
+}
+
+// loadTimerEvents returns the timer events after lastID, oldest first.
+func loadTimerEvents(ctx context.Context, userID int, lastID int64) ([]broker.Event, error) {
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT id, type, organization_id, COALESCE(user_id, 0), actor, created_at, data
+		FROM outbox_events
+		WHERE organization_id = $1 AND id > $2 AND type IN ($3, $4) AND ($5 = 0 OR user_id = $5)
+		ORDER BY id
+		LIMIT $6`, tenant(ctx), lastID, outbox.EventTaskStarted, outbox.EventTaskStopped, userID, maxReplayedEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []broker.Event
+	for rows.Next() {
+		var event broker.Event
+		if err = rows.Scan(&event.ID, &event.Type, &event.OrganizationID, &event.UserID, &event.Actor, &event.OccurredAt, &event.Data); err != nil {
+			return nil, err
+		}
+		event.OccurredAt = event.OccurredAt.UTC()
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// loadRunningTimers returns the running timers by task ID.
+func loadRunningTimers(ctx context.Context, userID int) (map[int]models.RunningTimer, error) {
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT `+taskColumns+` FROM tasks
+		WHERE end_time IS NULL AND start_time IS NOT NULL
+		AND user_id IN (SELECT id FROM users WHERE organization_id = $1 AND deleted_at IS NULL)
+		AND ($2 = 0 OR user_id = $2)`, tenant(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	running := make(map[int]models.RunningTimer)
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		running[task.ID] = runningTimer(task)
+	}
+	return running, rows.Err()
+}
+
+// applyTimerEvent updates the running timers with a live event.
+func applyTimerEvent(running map[int]models.RunningTimer, event broker.Event) {
+	var task models.Task
+	if err := json.Unmarshal(event.Data, &task); err != nil {
+		logger.Error("Error decoding %s event %d: %v", event.Type, event.ID, err)
+		return
+	}
+	switch event.Type {
+	case outbox.EventTaskStarted:
+		running[task.ID] = runningTimer(task)
+	case outbox.EventTaskStopped:
+		delete(running, task.ID)
+	}
+}
+
+func runningTimer(task models.Task) models.RunningTimer {
+	return models.RunningTimer{TaskID: task.ID, UserID: task.UserID, ProjectID: task.ProjectID, Name: task.Name, StartTime: task.StartTime.UTC()}
+}
+
+// formatTimerEvent renders a task event as an SSE message whose id is the
+// event ID, so clients can resume after it.
+func formatTimerEvent(event broker.Event) string {
+	data, _ := json.Marshal(models.WebhookEvent{
+		ID: event.ID, Type: event.Type, OrganizationID: event.OrganizationID, UserID: event.UserID,
+		Actor: event.Actor, OccurredAt: event.OccurredAt, Data: event.Data,
+	})
+	return fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// formatTimerTick renders the running timers as of now as a timers message.
+// It has no id, so it does not move the client's resume point.
+func formatTimerTick(running map[int]models.RunningTimer, now time.Time) string {
+	tick := models.TimerTick{At: now, Timers: make([]models.RunningTimer, 0, len(running))}
+	for _, timer := range running {
+		timer.ElapsedSeconds = int64(now.Sub(timer.StartTime).Seconds())
+		tick.Timers = append(tick.Timers, timer)
+	}
+	sort.Slice(tick.Timers, func(i, j int) bool {
+		if !tick.Timers[i].StartTime.Equal(tick.Timers[j].StartTime) {
+			return tick.Timers[i].StartTime.Before(tick.Timers[j].StartTime)
+		}
+		return tick.Timers[i].TaskID < tick.Timers[j].TaskID
+	})
+	data, _ := json.Marshal(tick)
+	return fmt.Sprintf("event: timers\ndata: %s\n\n", data)
+}
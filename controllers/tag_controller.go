@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+)
+
+const (
+	maxTagLength     = 50
+	maxTagsPerTask   = 20
+	suggestionWindow = 50
+)
+
+// @Summary Get tags
+// @Description Get all tags
+// @Tags tags
+// @Produce json
+// @Success 200 {array} models.Tag
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags [get]
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTags called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT id, name, created_at FROM tags WHERE organization_id = $1 ORDER BY name", tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := make([]models.Tag, 0)
+	for rows.Next() {
+		var tag models.Tag
+		if err = rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(tags); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Create a tag
+// @Description Create a new tag. Names are trimmed and lower-cased.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tag body models.Tag true "Tag"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags [post]
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateTag called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var tag models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	name, err := normalizeTag(tag.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.From(ctx).QueryRowContext(ctx, `
+		INSERT INTO tags (organization_id, name) VALUES ($1, $2)
+		ON CONFLICT (organization_id, name) DO NOTHING
+		RETURNING id, name, created_at`, tenant(ctx), name).
+		Scan(&tag.ID, &tag.Name, &tag.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Tag already exists", http.StatusConflict)
+		} else {
+			logger.Error("Error inserting tag: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(tag); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Rename a tag
+// @Description Rename a tag; tasks keep it under the new name
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param tag body models.Tag true "Tag"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags/{id} [patch]
+func UpdateTag(w http.ResponseWriter, r *http.Request) {
+	logger.Info("UpdateTag called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var tag models.Tag
+	if err = json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	name, err := normalizeTag(tag.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.From(ctx).QueryRowContext(ctx, "UPDATE tags SET name = $1 WHERE id = $2 AND organization_id = $3 RETURNING id, name, created_at", name, id, tenant(ctx)).
+		Scan(&tag.ID, &tag.Name, &tag.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+		} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			http.Error(w, "Tag already exists", http.StatusConflict)
+		} else {
+			logger.Error("Error updating tag: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(tag); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a tag
+// @Description Delete a tag and remove it from all tasks
+// @Tags tags
+// @Param id path int true "Tag ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags/{id} [delete]
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteTag called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "DELETE FROM tags WHERE id = $1 AND organization_id = $2", id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error deleting tag: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Suggest tags
+// @Description Suggest tags from the user's most recent tasks, most used first
+// @Tags tags
+// @Produce json
+// @Param id path int true "User ID"
+// @Param limit query int false "Maximum number of suggestions (default 10)"
+// @Success 200 {array} models.TagSuggestion
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/tags/suggestions [get]
+func GetTagSuggestions(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTagSuggestions called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT g.name, COUNT(*)
+		FROM (
+			SELECT t.id FROM tasks t
+			JOIN users u ON u.id = t.user_id AND u.organization_id = $4
+			WHERE t.user_id = $1
+			ORDER BY t.start_time DESC
+			LIMIT $2
+		) recent
+		JOIN task_tags tt ON tt.task_id = recent.id
+		JOIN tags g ON g.id = tt.tag_id
+		GROUP BY g.name
+		ORDER BY COUNT(*) DESC, g.name
+		LIMIT $3`, userID, suggestionWindow, limit, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suggestions := make([]models.TagSuggestion, 0)
+	for rows.Next() {
+		var suggestion models.TagSuggestion
+		if err = rows.Scan(&suggestion.Name, &suggestion.Count); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(suggestions); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || len(name) > maxTagLength || strings.Contains(name, ",") {
+		return "", fmt.Errorf("tag names must be 1-%d characters without commas", maxTagLength)
+	}
+	return name, nil
+}
+
+// normalizeTags normalizes and de-duplicates names, keeping their order.
+func normalizeTags(names []string) ([]string, error) {
+	if len(names) > maxTagsPerTask {
+		return nil, fmt.Errorf("a task can have at most %d tags", maxTagsPerTask)
+	}
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(names))
+	for _, n := range names {
+		name, err := normalizeTag(n)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// setTaskTags replaces the task's tags with names, creating missing tags in
+// the request's organization.
+func setTaskTags(ctx context.Context, tx *sql.Tx, taskID int, names []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM task_tags WHERE task_id = $1", taskID); err != nil {
+		return fmt.Errorf("error clearing task tags: %w", err)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO tags (organization_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (organization_id, name) DO NOTHING`, tenant(ctx), pq.Array(names)); err != nil {
+		return fmt.Errorf("error creating tags: %w", err)
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO task_tags (task_id, tag_id)
+		SELECT $1, id FROM tags WHERE organization_id = $2 AND name = ANY($3)`, taskID, tenant(ctx), pq.Array(names))
+	if err != nil {
+		return fmt.Errorf("error linking task tags: %w", err)
+	}
+	return nil
+}
+
+// loadTaskTags fills in the Tags of each task.
+func loadTaskTags(ctx context.Context, q dbQuerier, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(tasks))
+	index := make(map[int]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = int64(task.ID)
+		index[task.ID] = i
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT tt.task_id, g.name
+		FROM task_tags tt
+		JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.task_id = ANY($1)
+		ORDER BY g.name`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error loading task tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			taskID int
+			name   string
+		)
+		if err = rows.Scan(&taskID, &name); err != nil {
+			return fmt.Errorf("error scanning task tag: %w", err)
+		}
+		i := index[taskID]
+		tasks[i].Tags = append(tasks[i].Tags, name)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,558 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"test-project/audit"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+// TaskEntryRequest is the body for creating or editing a time entry. An entry
+// is bounded either by EndTime or by DurationMinutes counted from StartTime.
+// Tags, when present, replace the task's tags; an empty list clears them. A
+// null projectId takes the task out of its project.
+type TaskEntryRequest struct {
+	ProjectID       optionalID `json:"projectId" swaggertype:"integer"`
+	Name            *string    `json:"name"`
+	Notes           *string    `json:"notes"`
+	Tags            *[]string  `json:"tags"`
+	Billable        *bool      `json:"billable"`
+	StartTime       *time.Time `json:"startTime"`
+	EndTime         *time.Time `json:"endTime"`
+	DurationMinutes *int       `json:"durationMinutes"`
+}
+
+// optionalID is a JSON ID that tells an explicit null apart from a missing
+// field. Set is true when the field was present, and Value is nil for null.
+type optionalID struct {
+	Set   bool
+	Value *int
+}
+
+func (o *optionalID) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+const maxNotesLength = 2000
+
+var (
+	errTaskInvalid = errors.New("invalid task")
+	errTaskOverlap = errors.New("task overlaps another task of the user")
+)
+
+// @Summary Create a manual time entry
+// @Description Create a completed task with explicit start and end times, or a start time and a duration
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param task body controllers.TaskEntryRequest true "Time entry"
+// @Success 201 {object} models.Task
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/tasks [post]
+func CreateTaskEntry(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateTaskEntry called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	params := mux.Vars(r)
+	userID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		logger.Warning("Invalid user ID: %v", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req TaskEntryRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Error decoding request payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.StartTime == nil {
+		http.Error(w, "startTime is required", http.StatusBadRequest)
+		return
+	}
+	if req.EndTime == nil && req.DurationMinutes == nil {
+		http.Error(w, "endTime or durationMinutes is required", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	task := models.Task{UserID: userID, CreatedAt: now, UpdatedAt: now}
+	if err = applyTaskEntry(&task, req); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	deleted, err := lockTaskOwner(ctx, tx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("Error querying user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == sql.ErrNoRows || deleted {
+		logger.Warning("User not found: %d", userID)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if task.ProjectID != nil {
+		if err = checkProjectAccess(ctx, tx, *task.ProjectID, userID); err != nil {
+			writeProjectAccessError(w, err)
+			return
+		}
+	}
+
+	if err = checkTimesheetOpen(ctx, tx, userID, task.StartTime); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
+	if err = checkTaskOverlap(ctx, tx, task); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
+	query := `
+		INSERT INTO tasks (user_id, project_id, name, notes, billable, hours, minutes, created_at, updated_at, start_time, end_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`
+	err = tx.QueryRowContext(ctx, query, task.UserID, task.ProjectID, task.Name, nullIfEmpty(task.Notes), task.Billable, task.Hours, task.Minutes, task.CreatedAt, task.UpdatedAt, task.StartTime, task.EndTime).Scan(&task.ID)
+	if err != nil {
+		logger.Error("Error inserting task: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = setTaskTags(ctx, tx, task.ID, task.Tags); err != nil {
+		logger.Error("Error setting task tags: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: task.ID, UserID: userID, Action: audit.ActionCreate, After: task})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error committing task: %v", err)
+		http.Error(w, "Error creating task", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Manual task %d created for user %d", task.ID, userID)
+
+	addTaskToMigrationFile(task)
+	checkBudgetAlerts(ctx, userID, task.ProjectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(task); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Edit a task
+// @Description Change the project, name, notes, tags, billable flag, start time, end time or duration of a task. A null projectId removes the task from its project. Hours and minutes are recomputed.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param taskId path int true "Task ID"
+// @Param task body controllers.TaskEntryRequest true "Fields to change"
+// @Success 200 {object} models.Task
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/tasks/{taskId} [patch]
+func UpdateTask(w http.ResponseWriter, r *http.Request) {
+	logger.Info("UpdateTask called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, taskID, ok := parseTaskPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req TaskEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Error decoding request payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	deleted, err := lockTaskOwner(ctx, tx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("Error querying user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == sql.ErrNoRows || deleted {
+		logger.Warning("User not found: %d", userID)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	before, err := selectTaskForUpdate(ctx, tx, userID, taskID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warning("Task %d not found for user %d", taskID, userID)
+			http.Error(w, "Task not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying task: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if before.InvoiceID != nil {
+		logger.Warning("Task %d is locked by invoice %d", taskID, *before.InvoiceID)
+		http.Error(w, "Task is invoiced; void the invoice to change it", http.StatusConflict)
+		return
+	}
+
+	task := before
+	task.UpdatedAt = time.Now().UTC()
+	if err = applyTaskEntry(&task, req); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+	if req.ProjectID.Value != nil {
+		if err = checkProjectAccess(ctx, tx, *req.ProjectID.Value, userID); err != nil {
+			writeProjectAccessError(w, err)
+			return
+		}
+	}
+
+	if err = checkTimesheetOpen(ctx, tx, userID, before.StartTime, task.StartTime); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
+	if err = checkTaskOverlap(ctx, tx, task); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
+	var endTime interface{}
+	if !task.EndTime.IsZero() {
+		endTime = task.EndTime
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tasks
+		SET name = $1, hours = $2, minutes = $3, start_time = $4, end_time = $5, updated_at = $6, project_id = $7, notes = $8, billable = $9
+		WHERE id = $10`,
+		task.Name, task.Hours, task.Minutes, task.StartTime, endTime, task.UpdatedAt, task.ProjectID, nullIfEmpty(task.Notes), task.Billable, task.ID)
+	if err != nil {
+		logger.Error("Error updating task: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Tags != nil {
+		if err = setTaskTags(ctx, tx, task.ID, task.Tags); err != nil {
+			logger.Error("Error setting task tags: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: task.ID, UserID: userID, Action: audit.ActionUpdate, Before: before, After: task})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error committing task update: %v", err)
+		http.Error(w, "Error updating task", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Task %d updated", task.ID)
+
+	replaceTaskInMigrationFile(task)
+	checkBudgetAlerts(ctx, userID, task.ProjectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(task); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a task
+// @Description Delete a single task of a user
+// @Tags tasks
+// @Param id path int true "User ID"
+// @Param taskId path int true "Task ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/tasks/{taskId} [delete]
+func DeleteTask(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteTask called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, taskID, ok := parseTaskPath(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := selectTaskForUpdate(ctx, tx, userID, taskID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warning("Task %d not found for user %d", taskID, userID)
+			http.Error(w, "Task not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying task: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if before.InvoiceID != nil {
+		logger.Warning("Task %d is locked by invoice %d", taskID, *before.InvoiceID)
+		http.Error(w, "Task is invoiced; void the invoice to change it", http.StatusConflict)
+		return
+	}
+
+	if err = checkTimesheetOpen(ctx, tx, userID, before.StartTime); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = $1", taskID); err != nil {
+		logger.Error("Error deleting task: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: taskID, UserID: userID, Action: audit.ActionDelete, Before: before})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error committing task delete: %v", err)
+		http.Error(w, "Error deleting task", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Task %d deleted", taskID)
+
+	if err = removeSingleTaskFromMigrationFile(taskID); err != nil {
+		logger.Error("Error removing task from migration file: %v", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseTaskPath(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	params := mux.Vars(r)
+	userID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		logger.Warning("Invalid user ID: %v", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	taskID, err := strconv.Atoi(params["taskId"])
+	if err != nil {
+		logger.Warning("Invalid task ID: %v", err)
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return userID, taskID, true
+}
+
+// applyTaskEntry merges req into task, validates the resulting interval and
+// recomputes hours and minutes.
+func applyTaskEntry(task *models.Task, req TaskEntryRequest) error {
+	if req.ProjectID.Set {
+		task.ProjectID = req.ProjectID.Value
+	}
+	if req.Name != nil {
+		if len(*req.Name) > 100 {
+			return fmt.Errorf("%w: name must be at most 100 characters", errTaskInvalid)
+		}
+		task.Name = *req.Name
+	}
+	if req.Notes != nil {
+		task.Notes = *req.Notes
+	}
+	if req.Tags != nil {
+		task.Tags = *req.Tags
+	}
+	if req.Billable != nil {
+		task.Billable = *req.Billable
+	}
+	if err := validateTaskTagsAndNotes(task); err != nil {
+		return err
+	}
+	if req.StartTime != nil {
+		task.StartTime = req.StartTime.UTC()
+	}
+	if req.EndTime != nil && req.DurationMinutes != nil {
+		return fmt.Errorf("%w: endTime and durationMinutes are mutually exclusive", errTaskInvalid)
+	}
+	if req.EndTime != nil {
+		task.EndTime = req.EndTime.UTC()
+	}
+	if req.DurationMinutes != nil {
+		if *req.DurationMinutes <= 0 {
+			return fmt.Errorf("%w: durationMinutes must be positive", errTaskInvalid)
+		}
+		task.EndTime = task.StartTime.Add(time.Duration(*req.DurationMinutes) * time.Minute)
+	}
+
+	if task.EndTime.IsZero() {
+		if task.StartTime.After(time.Now().UTC()) {
+			return fmt.Errorf("%w: startTime must not be in the future", errTaskInvalid)
+		}
+		return nil
+	}
+	if !task.EndTime.After(task.StartTime) {
+		return fmt.Errorf("%w: endTime must be after startTime", errTaskInvalid)
+	}
+	if task.EndTime.After(time.Now().UTC()) {
+		return fmt.Errorf("%w: endTime must not be in the future", errTaskInvalid)
+	}
+
+	setTaskDuration(task)
+	return nil
+}
+
+// setTaskDuration derives hours and minutes from the task's start and end times.
+func setTaskDuration(task *models.Task) {
+	duration := task.EndTime.Sub(task.StartTime)
+	task.Hours = int(duration.Hours())
+	task.Minutes = int(duration.Minutes()) % 60
+}
+
+// lockTaskOwner locks the row of a user in the request's organization and
+// reports whether the user is deleted. Edits of the same user's tasks take it
+// before locking any task, so they run one after another and each overlap
+// check sees the tasks the previous one committed.
+func lockTaskOwner(ctx context.Context, tx *sql.Tx, userID int) (bool, error) {
+	var deleted bool
+	err := tx.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM users WHERE id = $1 AND organization_id = $2 FOR UPDATE",
+		userID, tenant(ctx)).Scan(&deleted)
+	return deleted, err
+}
+
+// checkTaskOverlap rejects task if it intersects another task of the same
+// user. Running tasks are treated as lasting until now. The caller must hold
+// lockTaskOwner, or a concurrent edit could commit an overlapping task.
+func checkTaskOverlap(ctx context.Context, tx *sql.Tx, task models.Task) error {
+	end := task.EndTime
+	if end.IsZero() {
+		end = time.Now().UTC()
+	}
+
+	var overlapID int
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM tasks
+		WHERE user_id = $1 AND id <> $2
+		AND start_time < $4
+		AND COALESCE(end_time, NOW()) > $3
+		LIMIT 1`,
+		task.UserID, task.ID, task.StartTime, end).Scan(&overlapID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w (task %d)", errTaskOverlap, overlapID)
+}
+
+func writeTaskEntryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTaskInvalid):
+		logger.Warning("Rejected task entry: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errTaskOverlap), errors.Is(err, errTimesheetLocked):
+		logger.Warning("Rejected task entry: %v", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.Error("Error validating task entry: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// validateTaskTagsAndNotes normalizes the task's tags and checks the notes length.
+func validateTaskTagsAndNotes(task *models.Task) error {
+	if len(task.Notes) > maxNotesLength {
+		return fmt.Errorf("%w: notes must be at most %d characters", errTaskInvalid, maxNotesLength)
+	}
+	tags, err := normalizeTags(task.Tags)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errTaskInvalid, err)
+	}
+	task.Tags = tags
+	return nil
+}
+
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// selectTaskForUpdate locks a task of the user and loads its tags. Tasks of
+// users outside the request's organization are not found.
+func selectTaskForUpdate(ctx context.Context, tx *sql.Tx, userID, taskID int) (models.Task, error) {
+	row := tx.QueryRowContext(ctx, `
+		SELECT `+taskColumns+` FROM tasks
+		WHERE id = $1 AND user_id = $2
+		AND user_id IN (SELECT id FROM users WHERE organization_id = $3)
+		FOR UPDATE`, taskID, userID, tenant(ctx))
+	task, err := scanTask(row)
+	if err != nil {
+		return task, err
+	}
+	tasks := []models.Task{task}
+	if err = loadTaskTags(ctx, tx, tasks); err != nil {
+		return task, err
+	}
+	return tasks[0], nil
+}
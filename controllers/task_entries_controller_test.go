@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"test-project/models"
+	"testing"
+	"time"
+)
+
+func TestApplyTaskEntry(t *testing.T) {
+	project := 4
+	start := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Minute)
+	tests := []struct {
+		name        string
+		task        models.Task
+		body        string
+		wantErr     bool
+		wantProject *int
+	}{
+		{name: "missing project is kept", task: models.Task{ProjectID: &project, StartTime: start}, body: `{"name":"Renamed"}`, wantProject: &project},
+		{name: "null project is cleared", task: models.Task{ProjectID: &project, StartTime: start}, body: `{"projectId":null}`},
+		{name: "project is set", task: models.Task{StartTime: start}, body: `{"projectId":4}`, wantProject: &project},
+		{name: "running task starts in the future", task: models.Task{StartTime: start}, body: `{"startTime":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, wantErr: true},
+		{name: "running task moves earlier", task: models.Task{StartTime: start}, body: `{"startTime":"` + start.Add(-time.Hour).Format(time.RFC3339) + `"}`},
+		{name: "end before start", task: models.Task{StartTime: start}, body: `{"endTime":"` + start.Add(-time.Minute).Format(time.RFC3339) + `"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req TaskEntryRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			task := tt.task
+			err := applyTaskEntry(&task, req)
+			if tt.wantErr {
+				if !errors.Is(err, errTaskInvalid) {
+					t.Fatalf("error %v, want errTaskInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (task.ProjectID == nil) != (tt.wantProject == nil) || task.ProjectID != nil && *task.ProjectID != *tt.wantProject {
+				t.Errorf("project %v, want %v", task.ProjectID, tt.wantProject)
+			}
+		})
+	}
+}
@@ -1,15 +1,22 @@
 package controllers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"test-project/audit"
 	"test-project/database"
 	"test-project/logger"
 	"test-project/models"
+	"test-project/outbox"
 	"time"
 )
 
@@ -21,12 +28,18 @@ import (
 // @Param id path int true "User ID"
 // @Param startTime query string false "Start date (YYYY-MM-DD)"
 // @Param endTime query string false "End date (YYYY-MM-DD)"
+// @Param tags query string false "Comma-separated tag names to filter by"
+// @Param match query string false "Tag match mode: any (default) or all"
 // @Success 200 {array} models.Task
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users/{id}/tasks [get]
 func GetUserTasks(w http.ResponseWriter, r *http.Request) {
 	logger.Info("GetUserTasks called")
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	params := mux.Vars(r)
 	userID, err := strconv.Atoi(params["id"])
 	if err != nil {
@@ -36,71 +49,39 @@ func GetUserTasks(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.Info("User ID: %d", userID)
 
-	startDateStr := r.URL.Query().Get("startTime")
-	endDateStr := r.URL.Query().Get("endTime")
-
-	var startDate, endDate time.Time
-	if startDateStr == "" || endDateStr == "" {
-		startDate = time.Time{}
-		endDate = time.Now().UTC()
-	} else {
-		startDate, err = time.Parse("2006-01-02", startDateStr)
-		if err != nil {
-			logger.Warning("Invalid start_time format: %v", err)
-			http.Error(w, "Invalid start_time format, expected YYYY-MM-DD", http.StatusBadRequest)
-			return
-		}
-
-		endDate, err = time.Parse("2006-01-02", endDateStr)
-		if err != nil {
-			logger.Warning("Invalid end_time format: %v", err)
-			http.Error(w, "Invalid end_time format, expected YYYY-MM-DD", http.StatusBadRequest)
-			return
+	if err = userInTenant(ctx, database.From(ctx), userID); err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warning("User not found: %d", userID)
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying user: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		return
 	}
 
-	var tasks []models.Task
-	query := `
-		SELECT id, user_id, name, hours, minutes, created_at, updated_at, start_time, end_time
-		FROM tasks
-		WHERE user_id = $1`
-
-	if !startDate.IsZero() && !endDate.IsZero() {
-		query += ` AND start_time >= $2 AND end_time <= $3`
-	}
-
-	query += ` ORDER BY hours DESC, minutes DESC`
-
-	paramsList := []interface{}{userID}
-	if !startDate.IsZero() && !endDate.IsZero() {
-		paramsList = append(paramsList, startDate, endDate)
-	}
-
-	rows, err := database.DB.Query(query, paramsList...)
+	// Dates are days in the user's timezone, and task times are shown in it.
+	loc, err := userLocation(ctx, userID)
 	if err != nil {
-		logger.Error("Error executing query: %v", err)
+		logger.Error("Error querying user timezone: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	logger.Info("SQL query executed successfully")
 
-	for rows.Next() {
-		var task models.Task
-		if err = rows.Scan(&task.ID, &task.UserID, &task.Name, &task.Hours, &task.Minutes, &task.CreatedAt, &task.UpdatedAt, &task.StartTime, &task.EndTime); err != nil {
-			logger.Error("Error scanning row: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		tasks = append(tasks, task)
+	filter, err := parseUserTaskFilter(r, loc)
+	if err != nil {
+		logger.Warning("Invalid task filter: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	logger.Info("Retrieved %d tasks", len(tasks))
 
-	if err = rows.Err(); err != nil {
-		logger.Error("Error iterating over rows: %v", err)
+	tasks, err := selectUserTasks(ctx, userID, filter, loc)
+	if err != nil {
+		logger.Error("Error selecting tasks: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	logger.Info("Retrieved %d tasks", len(tasks))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err = json.NewEncoder(w).Encode(tasks); err != nil {
@@ -118,11 +99,16 @@ func GetUserTasks(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param task body models.Task true "Task information"
 // @Success 201 {object} models.Task
+// @Header 201 {string} X-Budget-Warning "A soft budget or weekly limit that is exhausted"
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /tasks/start [post]
 func StartTask(w http.ResponseWriter, r *http.Request) {
 	logger.Info("StartTask called")
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
 	if err != nil {
@@ -141,8 +127,13 @@ func StartTask(w http.ResponseWriter, r *http.Request) {
 
 	logger.Info("Decoded task: %+v", task)
 
+	if err = validateTaskTagsAndNotes(&task); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
 	var userID int
-	err = database.DB.QueryRow("SELECT id FROM users WHERE id = $1", id).Scan(&userID)
+	err = database.From(ctx).QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL", id, tenant(ctx)).Scan(&userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Warning("User not found: %d", id)
@@ -164,33 +155,77 @@ func StartTask(w http.ResponseWriter, r *http.Request) {
 
 	logger.Info("Task timestamps: StartTime=%v, CreatedAt=%v, UpdatedAt=%v", task.StartTime, task.CreatedAt, task.UpdatedAt)
 
-	// Get the next free task ID
-	var nextFreeTaskID int
-	err = database.DB.QueryRow("SELECT get_next_free_task_id()").Scan(&nextFreeTaskID)
+	query := `
+		INSERT INTO tasks (user_id, project_id, name, notes, billable, created_at, updated_at, start_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
 	if err != nil {
-		logger.Error("Failed to get next free task ID: %v", err)
-		http.Error(w, "Failed to get next free task ID", http.StatusInternalServerError)
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	task.ID = nextFreeTaskID
+	if task.ProjectID != nil {
+		if err = checkProjectAccess(ctx, tx, *task.ProjectID, task.UserID); err != nil {
+			writeProjectAccessError(w, err)
+			return
+		}
+	}
 
-	query := `
-		INSERT INTO tasks (id, user_id, name, created_at, updated_at, start_time)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id
-	`
-	err = database.DB.QueryRow(query, task.ID, task.UserID, task.Name, task.CreatedAt, task.UpdatedAt, task.StartTime).Scan(&task.ID)
+	if err = checkTimesheetOpen(ctx, tx, task.UserID, task.StartTime); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+
+	warnings, err := checkStartBudget(ctx, tx, task.UserID, task.ProjectID)
+	if err != nil {
+		if errors.Is(err, errBudgetExhausted) {
+			logger.Warning("Refused to start task for user %d: %v", task.UserID, err)
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			logger.Error("Error checking budgets: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, query, task.UserID, task.ProjectID, task.Name, nullIfEmpty(task.Notes), task.Billable, task.CreatedAt, task.UpdatedAt, task.StartTime).Scan(&task.ID)
 	if err != nil {
 		logger.Error("Error inserting task: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err = setTaskTags(ctx, tx, task.ID, task.Tags); err != nil {
+		logger.Error("Error setting task tags: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: task.ID, UserID: task.UserID, Action: audit.ActionStart, After: task})
+	if err == nil {
+		err = outbox.Publish(ctx, tx, outbox.Event{Type: outbox.EventTaskStarted, UserID: task.UserID, Data: task})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error committing task: %v", err)
+		http.Error(w, "Error starting task", http.StatusInternalServerError)
+		return
+	}
+
 	log.Printf("Task created with ID: %d", task.ID)
 
 	addTaskToMigrationFile(task)
+	checkBudgetAlerts(ctx, task.UserID, task.ProjectID)
 
+	for _, warning := range warnings {
+		w.Header().Add("X-Budget-Warning", warning)
+	}
 	w.WriteHeader(http.StatusCreated)
 	if err = json.NewEncoder(w).Encode(task); err != nil {
 		logger.Error("Error encoding response: %v", err)
@@ -199,17 +234,22 @@ func StartTask(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Stop a task
-// @Description Stop a task and calculate duration
+// @Description Stop the user's newest running task and calculate its duration. A task in a submitted or approved week cannot be stopped.
 // @Tags tasks
 // @Accept json
 // @Produce json
 // @Param task body models.Task true "Task information"
 // @Success 200
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /tasks/stop [post]
 func StopTask(w http.ResponseWriter, r *http.Request) {
 	logger.Info("StopTask called")
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	params := mux.Vars(r)
 	userID, err := strconv.Atoi(params["id"])
 	if err != nil {
@@ -224,19 +264,40 @@ func StopTask(w http.ResponseWriter, r *http.Request) {
 	task.EndTime = time.Now().UTC()
 	logger.Info("EndTime set to: %v", task.EndTime)
 
-	var startTime time.Time
-	err = database.DB.QueryRow("SELECT start_time FROM tasks WHERE user_id = $1 AND end_time IS NULL ORDER BY start_time DESC LIMIT 1", userID).Scan(&startTime)
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			logger.Error("No active task found for user: %d", userID)
-			http.Error(w, "No active task found for user", http.StatusNotFound)
-		} else {
-			logger.Error("Error querying task start_time: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	openTasks, err := selectOpenTasksForUpdate(ctx, tx, userID)
+	if err != nil {
+		logger.Error("Error querying open tasks: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(openTasks) == 0 {
+		logger.Error("No active task found for user: %d", userID)
+		http.Error(w, "No active task found for user", http.StatusNotFound)
 		return
 	}
 
+	// Only the newest running task is stopped; it is the one the user is
+	// working on.
+	if err = checkTimesheetOpen(ctx, tx, userID, openTasks[0].StartTime); err != nil {
+		writeTaskEntryError(w, err)
+		return
+	}
+	if err = loadTaskTags(ctx, tx, openTasks[:1]); err != nil {
+		logger.Error("Error loading task tags: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	before := openTasks[0]
+
+	startTime := before.StartTime
 	logger.Info("Task start_time: %v", startTime)
 
 	duration := task.EndTime.Sub(startTime)
@@ -245,18 +306,222 @@ func StopTask(w http.ResponseWriter, r *http.Request) {
 
 	logger.Info("Task duration calculated: %d hours, %d minutes", task.Hours, task.Minutes)
 
-	_, err = database.DB.Exec(`
+	updatedAt := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, `
 		UPDATE tasks 
 		SET end_time = $1, hours = $2, minutes = $3, updated_at = $4 
-		WHERE user_id = $5 AND end_time IS NULL`,
-		task.EndTime, task.Hours, task.Minutes, time.Now().UTC(), userID)
+		WHERE id = $5`,
+		task.EndTime, task.Hours, task.Minutes, updatedAt, before.ID)
 	if err != nil {
 		logger.Error("Error updating task: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("Task for user %d updated successfully", userID)
+	after := before
+	after.EndTime = task.EndTime
+	after.Hours = task.Hours
+	after.Minutes = task.Minutes
+	after.UpdatedAt = updatedAt
+	err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: before.ID, UserID: userID, Action: audit.ActionStop, Before: before, After: after})
+	if err == nil {
+		err = outbox.Publish(ctx, tx, outbox.Event{Type: outbox.EventTaskStopped, UserID: userID, Data: after})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error committing task stop: %v", err)
+		http.Error(w, "Error stopping task", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Task %d for user %d stopped successfully", before.ID, userID)
+
+	checkBudgetAlerts(ctx, userID, nil)
+	if before.ProjectID != nil {
+		checkBudgetAlerts(ctx, 0, before.ProjectID)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// userTaskFilter selects tasks of a user's task list. A zero startDate means
+// no date range.
+type userTaskFilter struct {
+	startDate, endDate time.Time
+	tags               []string
+	matchAll           bool
+}
+
+// parseUserTaskFilter reads the startTime, endTime, tags and match query
+// parameters. Dates are midnight in loc.
+func parseUserTaskFilter(r *http.Request, loc *time.Location) (userTaskFilter, error) {
+	var (
+		filter userTaskFilter
+		err    error
+	)
+	startDateStr := r.URL.Query().Get("startTime")
+	endDateStr := r.URL.Query().Get("endTime")
+	if startDateStr != "" && endDateStr != "" {
+		if filter.startDate, err = time.ParseInLocation("2006-01-02", startDateStr, loc); err != nil {
+			return filter, errors.New("Invalid start_time format, expected YYYY-MM-DD")
+		}
+		if filter.endDate, err = time.ParseInLocation("2006-01-02", endDateStr, loc); err != nil {
+			return filter, errors.New("Invalid end_time format, expected YYYY-MM-DD")
+		}
+	}
+
+	if tagsStr := r.URL.Query().Get("tags"); tagsStr != "" {
+		if filter.tags, err = normalizeTags(strings.Split(tagsStr, ",")); err != nil {
+			return filter, err
+		}
+	}
+	switch r.URL.Query().Get("match") {
+	case "", "any":
+	case "all":
+		filter.matchAll = true
+	default:
+		return filter, errors.New("Invalid match, expected any or all")
+	}
+	return filter, nil
+}
+
+// selectUserTasks returns the user's tasks matching filter, longest first,
+// with their tags and with times in loc.
+func selectUserTasks(ctx context.Context, userID int, filter userTaskFilter, loc *time.Location) ([]models.Task, error) {
+	var tasks []models.Task
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE user_id = $1
+		AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL AND organization_id = $2)`
+
+	paramsList := []interface{}{userID, tenant(ctx)}
+	if !filter.startDate.IsZero() {
+		query += ` AND start_time >= $3 AND end_time <= $4`
+		paramsList = append(paramsList, filter.startDate, filter.endDate)
+	}
+
+	if len(filter.tags) > 0 {
+		paramsList = append(paramsList, pq.Array(filter.tags))
+		tagFilter := fmt.Sprintf(`
+		SELECT tt.task_id FROM task_tags tt
+		JOIN tags g ON g.id = tt.tag_id
+		WHERE g.name = ANY($%d)`, len(paramsList))
+		if filter.matchAll {
+			paramsList = append(paramsList, len(filter.tags))
+			tagFilter += fmt.Sprintf(`
+		GROUP BY tt.task_id
+		HAVING COUNT(DISTINCT g.id) = $%d`, len(paramsList))
+		}
+		query += ` AND id IN (` + tagFilter + `)`
+	}
+
+	query += ` ORDER BY hours DESC, minutes DESC`
+
+	rows, err := database.From(ctx).QueryContext(ctx, query, paramsList...)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		task.StartTime = task.StartTime.In(loc)
+		if !task.EndTime.IsZero() {
+			task.EndTime = task.EndTime.In(loc)
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	rows.Close()
+
+	if err = loadTaskTags(ctx, database.From(ctx), tasks); err != nil {
+		return nil, fmt.Errorf("error loading task tags: %w", err)
+	}
+	return tasks, nil
+}
+
+const taskColumns = "id, user_id, project_id, name, hours, minutes, created_at, updated_at, start_time, end_time, auto_stopped, notes, billable, invoice_id"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask reads a row selected with taskColumns. Running tasks have no
+// end_time, hours or minutes yet, so those columns are read as nullable.
+func scanTask(row rowScanner) (models.Task, error) {
+	var (
+		task           models.Task
+		projectID      sql.NullInt64
+		name           sql.NullString
+		hours, minutes sql.NullInt64
+		endTime        sql.NullTime
+		notes          sql.NullString
+		invoiceID      sql.NullInt64
+	)
+	err := row.Scan(&task.ID, &task.UserID, &projectID, &name, &hours, &minutes, &task.CreatedAt, &task.UpdatedAt, &task.StartTime, &endTime, &task.AutoStopped, &notes, &task.Billable, &invoiceID)
+	if err != nil {
+		return task, err
+	}
+	if projectID.Valid {
+		id := int(projectID.Int64)
+		task.ProjectID = &id
+	}
+	task.Name = name.String
+	task.Hours = int(hours.Int64)
+	task.Minutes = int(minutes.Int64)
+	task.EndTime = endTime.Time
+	task.Notes = notes.String
+	if invoiceID.Valid {
+		id := int(invoiceID.Int64)
+		task.InvoiceID = &id
+	}
+	return task, nil
+}
+
+// selectOpenTasksForUpdate locks the user's running tasks, newest first. It
+// finds none for users outside the request's organization.
+func selectOpenTasksForUpdate(ctx context.Context, tx *sql.Tx, userID int) ([]models.Task, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+taskColumns+` FROM tasks
+		WHERE user_id = $1 AND end_time IS NULL
+		AND user_id IN (SELECT id FROM users WHERE organization_id = $2)
+		ORDER BY start_time DESC
+		FOR UPDATE`, userID, tenant(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// LockTask locks a task of any organization and loads its tags, for
+// background jobs that change tasks. It returns sql.ErrNoRows when the task
+// does not exist.
+func LockTask(ctx context.Context, tx *sql.Tx, taskID int) (models.Task, error) {
+	task, err := scanTask(tx.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = $1 FOR UPDATE", taskID))
+	if err != nil {
+		return task, err
+	}
+	tasks := []models.Task{task}
+	if err = loadTaskTags(ctx, tx, tasks); err != nil {
+		return task, err
+	}
+	return tasks[0], nil
+}
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+const teamColumns = "id, name, created_at, updated_at"
+
+// @Summary Get teams
+// @Description Get the teams of the organization
+// @Tags teams
+// @Produce json
+// @Success 200 {array} models.Team
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams [get]
+func GetTeams(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTeams called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT "+teamColumns+" FROM teams WHERE organization_id = $1 ORDER BY name", tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	teams := make([]models.Team, 0)
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		teams = append(teams, team)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(teams); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Create a team
+// @Description Create a team in the organization
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param team body models.Team true "Team"
+// @Success 201 {object} models.Team
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams [post]
+func CreateTeam(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateTeam called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var team models.Team
+	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if team.Name == "" || len(team.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	team, err := scanTeam(database.From(ctx).QueryRowContext(ctx,
+		"INSERT INTO teams (organization_id, name) VALUES ($1, $2) RETURNING "+teamColumns, tenant(ctx), team.Name))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			http.Error(w, "Team already exists", http.StatusConflict)
+		} else {
+			logger.Error("Error inserting team: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Info("Team created with ID %d", team.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(team); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Rename a team
+// @Description Change a team's name
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path int true "Team ID"
+// @Param team body models.Team true "Team"
+// @Success 200 {object} models.Team
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id} [patch]
+func UpdateTeam(w http.ResponseWriter, r *http.Request) {
+	logger.Info("UpdateTeam called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	var team models.Team
+	if err = json.NewDecoder(r.Body).Decode(&team); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if team.Name == "" || len(team.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	team, err = scanTeam(database.From(ctx).QueryRowContext(ctx,
+		"UPDATE teams SET name = $1, updated_at = $2 WHERE id = $3 AND organization_id = $4 RETURNING "+teamColumns,
+		team.Name, time.Now().UTC(), id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Team not found", http.StatusNotFound)
+		} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			http.Error(w, "Team already exists", http.StatusConflict)
+		} else {
+			logger.Error("Error updating team: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(team); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a team
+// @Description Delete a team. Its members are not affected.
+// @Tags teams
+// @Param id path int true "Team ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id} [delete]
+func DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteTeam called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "DELETE FROM teams WHERE id = $1 AND organization_id = $2", id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error deleting team: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("Team %d deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Get team members
+// @Description List the users in a team
+// @Tags teams
+// @Produce json
+// @Param id path int true "Team ID"
+// @Success 200 {array} models.TeamMember
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/members [get]
+func GetTeamMembers(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTeamMembers called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT m.team_id, m.user_id, m.manager, m.created_at
+		FROM team_members m
+		JOIN teams t ON t.id = m.team_id
+		WHERE m.team_id = $1 AND t.organization_id = $2
+		ORDER BY m.user_id`, id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	members := make([]models.TeamMember, 0)
+	for rows.Next() {
+		var member models.TeamMember
+		if err = rows.Scan(&member.TeamID, &member.UserID, &member.Manager, &member.CreatedAt); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(members); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Add a team member
+// @Description Add a user of the organization to a team, or change whether an existing member is one of its managers. Managers approve and reject the timesheets of the team's other members.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path int true "Team ID"
+// @Param member body models.TeamMember true "Member (only userId and manager are read)"
+// @Success 201 {object} models.TeamMember
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/members [post]
+func AddTeamMember(w http.ResponseWriter, r *http.Request) {
+	logger.Info("AddTeamMember called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	var member models.TeamMember
+	if err = json.NewDecoder(r.Body).Decode(&member); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	member.TeamID = id
+
+	err = database.From(ctx).QueryRowContext(ctx, `
+		INSERT INTO team_members (team_id, user_id, manager)
+		SELECT t.id, u.id, $4 FROM teams t, users u
+		WHERE t.id = $1 AND u.id = $2 AND u.deleted_at IS NULL
+		AND t.organization_id = $3 AND u.organization_id = $3
+		ON CONFLICT (team_id, user_id) DO UPDATE SET manager = EXCLUDED.manager
+		RETURNING created_at`, member.TeamID, member.UserID, tenant(ctx), member.Manager).Scan(&member.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Team or user not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error adding team member: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Info("User %d added to team %d", member.UserID, member.TeamID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(member); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Remove a team member
+// @Description Remove a user from a team
+// @Tags teams
+// @Param id path int true "Team ID"
+// @Param userId path int true "User ID"
+// @Success 204
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/members/{userId} [delete]
+func RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RemoveTeamMember called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	params := mux.Vars(r)
+	teamID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.Atoi(params["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, `
+		DELETE FROM team_members
+		WHERE team_id = $1 AND user_id = $2
+		AND team_id IN (SELECT id FROM teams WHERE organization_id = $3)`, teamID, userID, tenant(ctx))
+	if err != nil {
+		logger.Error("Error removing team member: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("User %d removed from team %d", userID, teamID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func scanTeam(row rowScanner) (models.Team, error) {
+	var team models.Team
+	err := row.Scan(&team.ID, &team.Name, &team.CreatedAt, &team.UpdatedAt)
+	return team, err
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"test-project/database"
+	"test-project/middleware"
+)
+
+// tenant returns the organization the request was resolved to.
+func tenant(ctx context.Context) int {
+	return middleware.OrganizationFromContext(ctx)
+}
+
+// userInTenant returns sql.ErrNoRows unless the user exists, is not deleted
+// and belongs to the request's organization.
+func userInTenant(ctx context.Context, q dbQuerier, userID int) error {
+	var id int
+	return q.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL",
+		userID, tenant(ctx)).Scan(&id)
+}
+
+// projectInTenant returns sql.ErrNoRows unless the project belongs to the
+// request's organization.
+func projectInTenant(ctx context.Context, q dbQuerier, projectID int) error {
+	var id int
+	return q.QueryRowContext(ctx, "SELECT id FROM projects WHERE id = $1 AND organization_id = $2",
+		projectID, tenant(ctx)).Scan(&id)
+}
+
+// OrganizationResolver looks organizations up for middleware.Tenant.
+type OrganizationResolver struct{}
+
+func (OrganizationResolver) OrganizationBySlug(ctx context.Context, slug string) (int, error) {
+	var id int
+	err := database.DB.QueryRowContext(ctx, "SELECT id FROM organizations WHERE slug = $1", slug).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (OrganizationResolver) OrganizationByToken(ctx context.Context, token string) (int, error) {
+	var id int
+	err := database.DB.QueryRowContext(ctx, "SELECT id FROM organizations WHERE token_hash = $1", hashToken(token)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// hashToken returns the hex SHA-256 of an organization API token; only the
+// hash is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
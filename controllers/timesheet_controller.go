@@ -0,0 +1,612 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-project/audit"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/middleware"
+	"test-project/models"
+	"time"
+)
+
+// TimesheetActionRequest is the optional comment sent with a submission or a
+// decision. Rejections require one. Decisions name the manager who makes
+// them; submissions ignore ManagerID.
+type TimesheetActionRequest struct {
+	Comment   string `json:"comment"`
+	ManagerID int    `json:"managerId"`
+}
+
+var (
+	errTimesheetLocked     = errors.New("the task's week is submitted or approved")
+	errTimesheetTransition = errors.New("timesheet is not in a state that allows this")
+	errNotManager          = errors.New("only a manager of one of the user's teams may decide on the timesheet")
+)
+
+const timesheetSummaryQuery = `
+	SELECT ts.id, ts.user_id, ts.week_start, ts.status, ts.submitted_at, ts.decided_at, COALESCE(ts.decided_by, ''),
+		COALESCE((
+			SELECT SUM(FLOOR(EXTRACT(EPOCH FROM COALESCE(t.end_time, NOW()) - t.start_time) / 60))
+			FROM tasks t
+			WHERE t.user_id = ts.user_id
+			AND t.start_time >= (ts.week_start::timestamp AT TIME ZONE u.timezone)
+			AND t.start_time < ((ts.week_start + 7)::timestamp AT TIME ZONE u.timezone)
+		), 0)::INTEGER
+	FROM timesheets ts
+	JOIN users u ON u.id = ts.user_id AND u.deleted_at IS NULL`
+
+// @Summary Get a user's timesheets
+// @Description Get the user's submitted, approved and rejected timesheets, newest week first
+// @Tags timesheets
+// @Produce json
+// @Param id path int true "User ID"
+// @Param status query string false "draft, submitted, approved or rejected"
+// @Success 200 {array} models.Timesheet
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/timesheets [get]
+func GetUserTimesheets(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetUserTimesheets called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	writeTimesheetList(ctx, w, timesheetSummaryQuery+`
+		WHERE ts.user_id = $1 AND ($2 = '' OR ts.status = $2) AND u.organization_id = $3
+		ORDER BY ts.week_start DESC`, userID, r.URL.Query().Get("status"), tenant(ctx))
+}
+
+// @Summary Timesheet inbox
+// @Description Get the timesheets waiting for approval, oldest submission first. With managerId, only those of the manager's team members. Requires the admin token.
+// @Tags timesheets
+// @Produce json
+// @Param managerId query int false "Manager's user ID"
+// @Success 200 {array} models.Timesheet
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /timesheets/inbox [get]
+func GetTimesheetInbox(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTimesheetInbox called")
+
+	if !isAdmin(r) {
+		http.Error(w, "The timesheet inbox requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	managerID := 0
+	if s := r.URL.Query().Get("managerId"); s != "" {
+		var err error
+		if managerID, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid managerId", http.StatusBadRequest)
+			return
+		}
+	}
+
+	writeTimesheetList(ctx, w, timesheetSummaryQuery+`
+		WHERE ($1 = 0 OR ts.user_id IN (`+managedUsersQuery+`))
+		AND ts.status = $2 AND u.organization_id = $3
+		ORDER BY ts.submitted_at, ts.id`, managerID, models.TimesheetSubmitted, tenant(ctx))
+}
+
+// @Summary Get a timesheet
+// @Description Get the user's timesheet for the week containing the given day, with its tasks, daily totals and comments
+// @Tags timesheets
+// @Produce json
+// @Param id path int true "User ID"
+// @Param week path string true "Any day of the week (YYYY-MM-DD)"
+// @Success 200 {object} models.Timesheet
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/timesheets/{week} [get]
+func GetTimesheet(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetTimesheet called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, week, ok := parseTimesheetPath(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	sheet, err := loadTimesheet(ctx, database.From(ctx), userID, week)
+	if err != nil {
+		logger.Error("Error loading timesheet: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(sheet); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Submit a timesheet
+// @Description Submit the user's week for approval. The week must have started and no task started before its end may still be running. Its tasks are locked until the timesheet is rejected.
+// @Tags timesheets
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param week path string true "Any day of the week (YYYY-MM-DD)"
+// @Param body body controllers.TimesheetActionRequest false "Comment"
+// @Success 200 {object} models.Timesheet
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/timesheets/{week}/submit [post]
+func SubmitTimesheet(w http.ResponseWriter, r *http.Request) {
+	logger.Info("SubmitTimesheet called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	userID, week, ok := parseTimesheetPath(ctx, w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeTimesheetAction(w, r)
+	if !ok {
+		return
+	}
+	if week.After(time.Now()) {
+		http.Error(w, "Cannot submit a week that has not started", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// A task started in an earlier week and still running reaches into this
+	// one, and could not be stopped once the week is locked.
+	var running bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM tasks WHERE user_id = $1 AND end_time IS NULL AND start_time < $2)`,
+		userID, week.AddDate(0, 0, 7)).Scan(&running)
+	if err != nil {
+		logger.Error("Error checking running tasks: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if running {
+		http.Error(w, "Stop the running task before submitting the week", http.StatusConflict)
+		return
+	}
+
+	var (
+		id     int
+		status string
+	)
+	weekDate := week.Format("2006-01-02")
+	err = tx.QueryRowContext(ctx, "SELECT id, status FROM timesheets WHERE user_id = $1 AND week_start = $2 FOR UPDATE", userID, weekDate).Scan(&id, &status)
+	switch {
+	case err == sql.ErrNoRows:
+		status = models.TimesheetDraft
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO timesheets (user_id, week_start, status, submitted_at)
+			VALUES ($1, $2, $3, NOW())
+			RETURNING id`, userID, weekDate, models.TimesheetSubmitted).Scan(&id)
+	case err == nil && status != models.TimesheetDraft && status != models.TimesheetRejected:
+		err = fmt.Errorf("%w: it is %s", errTimesheetTransition, status)
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE timesheets SET status = $1, submitted_at = NOW(), decided_at = NULL, decided_by = NULL, updated_at = NOW()
+			WHERE id = $2`, models.TimesheetSubmitted, id)
+	}
+	if err == nil {
+		err = finishTimesheetAction(ctx, tx, id, userID, status, models.TimesheetSubmitted, audit.ActionSubmit, req.Comment)
+	}
+	if err != nil {
+		writeTimesheetError(w, err)
+		return
+	}
+	logger.Info("Timesheet %d of user %d submitted", id, userID)
+
+	writeTimesheet(ctx, w, userID, week)
+}
+
+// @Summary Approve a timesheet
+// @Description Approve a submitted timesheet. Its tasks stay locked. managerId must name a manager of one of the user's teams other than the user. Requires the admin token, which vouches for the manager.
+// @Tags timesheets
+// @Accept json
+// @Produce json
+// @Param id path int true "Timesheet ID"
+// @Param body body controllers.TimesheetActionRequest true "Manager and comment"
+// @Success 200 {object} models.Timesheet
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /timesheets/{id}/approve [post]
+func ApproveTimesheet(w http.ResponseWriter, r *http.Request) {
+	logger.Info("ApproveTimesheet called")
+	decideTimesheet(w, r, models.TimesheetApproved, audit.ActionApprove)
+}
+
+// @Summary Reject a timesheet
+// @Description Reject a submitted timesheet with a comment, unlocking its tasks for corrections. managerId must name a manager of one of the user's teams other than the user. Requires the admin token, which vouches for the manager.
+// @Tags timesheets
+// @Accept json
+// @Produce json
+// @Param id path int true "Timesheet ID"
+// @Param body body controllers.TimesheetActionRequest true "Manager and comment"
+// @Success 200 {object} models.Timesheet
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /timesheets/{id}/reject [post]
+func RejectTimesheet(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RejectTimesheet called")
+	decideTimesheet(w, r, models.TimesheetRejected, audit.ActionReject)
+}
+
+func decideTimesheet(w http.ResponseWriter, r *http.Request, status, action string) {
+	if !isAdmin(r) {
+		http.Error(w, "Deciding on timesheets requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid timesheet ID", http.StatusBadRequest)
+		return
+	}
+	req, ok := decodeTimesheetAction(w, r)
+	if !ok {
+		return
+	}
+	if status == models.TimesheetRejected && req.Comment == "" {
+		http.Error(w, "A comment is required to reject a timesheet", http.StatusBadRequest)
+		return
+	}
+	if req.ManagerID == 0 {
+		http.Error(w, "managerId is required to decide on a timesheet", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		userID    int
+		weekStart time.Time
+		timezone  string
+		before    string
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT ts.user_id, ts.week_start, u.timezone, ts.status
+		FROM timesheets ts JOIN users u ON u.id = ts.user_id
+		WHERE ts.id = $1 AND u.organization_id = $2
+		FOR UPDATE OF ts`, id, tenant(ctx)).Scan(&userID, &weekStart, &timezone, &before)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Timesheet not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = checkTimesheetManager(ctx, tx, req.ManagerID, userID)
+	}
+	if err == nil && before != models.TimesheetSubmitted {
+		err = fmt.Errorf("%w: it is %s", errTimesheetTransition, before)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE timesheets SET status = $1, decided_at = NOW(), decided_by = $2, updated_at = NOW()
+			WHERE id = $3`, status, middleware.ActorFromContext(ctx), id)
+	}
+	if err == nil {
+		err = finishTimesheetAction(ctx, tx, id, userID, before, status, action, req.Comment)
+	}
+	if err != nil {
+		writeTimesheetError(w, err)
+		return
+	}
+	logger.Info("Timesheet %d %s by manager %d (%s)", id, status, req.ManagerID, middleware.ActorFromContext(ctx))
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	writeTimesheet(ctx, w, userID, time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day(), 0, 0, 0, 0, loc))
+}
+
+// finishTimesheetAction stores the comment and the audit entry of a status
+// change and commits tx.
+func finishTimesheetAction(ctx context.Context, tx *sql.Tx, id, userID int, before, after, action, comment string) error {
+	if comment = strings.TrimSpace(comment); comment != "" {
+		_, err := tx.ExecContext(ctx, "INSERT INTO timesheet_comments (timesheet_id, author, body) VALUES ($1, $2, $3)",
+			id, middleware.ActorFromContext(ctx), comment)
+		if err != nil {
+			return fmt.Errorf("error saving comment: %w", err)
+		}
+	}
+	err := audit.Record(ctx, tx, audit.Entry{
+		Entity:   audit.EntityTimesheet,
+		EntityID: id,
+		UserID:   userID,
+		Action:   action,
+		Before:   map[string]string{"status": before},
+		After:    map[string]string{"status": after, "comment": comment},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// managedUsersQuery selects the users that the user $1 manages: the other
+// members of the teams $1 is a manager of.
+const managedUsersQuery = `
+	SELECT r.user_id FROM team_members m
+	JOIN team_members r ON r.team_id = m.team_id AND r.user_id <> m.user_id
+	JOIN users mu ON mu.id = m.user_id AND mu.deleted_at IS NULL
+	WHERE m.user_id = $1 AND m.manager`
+
+// checkTimesheetManager returns errNotManager unless managerID is a manager
+// of one of userID's teams and not userID itself.
+func checkTimesheetManager(ctx context.Context, tx *sql.Tx, managerID, userID int) error {
+	var manages bool
+	err := tx.QueryRowContext(ctx, "SELECT $2 IN ("+managedUsersQuery+")", managerID, userID).Scan(&manages)
+	if err != nil {
+		return err
+	}
+	if !manages {
+		return errNotManager
+	}
+	return nil
+}
+
+// checkTimesheetOpen returns errTimesheetLocked if any of starts falls in a
+// submitted or approved week of the user.
+func checkTimesheetOpen(ctx context.Context, tx *sql.Tx, userID int, starts ...time.Time) error {
+	for _, start := range starts {
+		var locked bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM timesheets ts JOIN users u ON u.id = ts.user_id
+				WHERE ts.user_id = $1 AND ts.status IN ('submitted', 'approved')
+				AND ts.week_start = date_trunc('week', $2::timestamptz AT TIME ZONE u.timezone)::date
+			)`, userID, start).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return errTimesheetLocked
+		}
+	}
+	return nil
+}
+
+// loadTimesheet builds the timesheet of the week starting at weekStart, which
+// is midnight of a Monday in the user's timezone.
+func loadTimesheet(ctx context.Context, q dbQuerier, userID int, weekStart time.Time) (models.Timesheet, error) {
+	sheet := models.Timesheet{UserID: userID, WeekStart: weekStart.Format("2006-01-02"), Status: models.TimesheetDraft}
+
+	var (
+		submittedAt, decidedAt sql.NullTime
+		decidedBy              sql.NullString
+	)
+	err := q.QueryRowContext(ctx, `
+		SELECT id, status, submitted_at, decided_at, decided_by
+		FROM timesheets WHERE user_id = $1 AND week_start = $2`, userID, sheet.WeekStart).
+		Scan(&sheet.ID, &sheet.Status, &submittedAt, &decidedAt, &decidedBy)
+	if err != nil && err != sql.ErrNoRows {
+		return sheet, err
+	}
+	if submittedAt.Valid {
+		sheet.SubmittedAt = &submittedAt.Time
+	}
+	if decidedAt.Valid {
+		sheet.DecidedAt = &decidedAt.Time
+	}
+	sheet.DecidedBy = decidedBy.String
+
+	rows, err := q.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE user_id = $1 AND start_time >= $2 AND start_time < $3 ORDER BY start_time, id",
+		userID, weekStart, weekStart.AddDate(0, 0, 7))
+	if err != nil {
+		return sheet, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return sheet, err
+		}
+		sheet.Tasks = append(sheet.Tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		return sheet, err
+	}
+	if err = loadTaskTags(ctx, q, sheet.Tasks); err != nil {
+		return sheet, err
+	}
+
+	for i := 0; i < 7; i++ {
+		sheet.Days = append(sheet.Days, models.TimesheetDay{Date: weekStart.AddDate(0, 0, i).Format("2006-01-02")})
+	}
+	now := time.Now().UTC()
+	for _, task := range sheet.Tasks {
+		end := task.EndTime
+		if end.IsZero() {
+			end = now
+		}
+		minutes := int(end.Sub(task.StartTime).Minutes())
+		day := int(task.StartTime.In(weekStart.Location()).Sub(weekStart).Hours() / 24)
+		if day >= 0 && day < 7 {
+			sheet.Days[day].Minutes += minutes
+		}
+		sheet.TotalMinutes += minutes
+	}
+
+	if sheet.ID == 0 {
+		return sheet, nil
+	}
+	comments, err := q.QueryContext(ctx, "SELECT id, author, body, created_at FROM timesheet_comments WHERE timesheet_id = $1 ORDER BY id", sheet.ID)
+	if err != nil {
+		return sheet, err
+	}
+	defer comments.Close()
+	for comments.Next() {
+		var comment models.TimesheetComment
+		if err = comments.Scan(&comment.ID, &comment.Author, &comment.Body, &comment.CreatedAt); err != nil {
+			return sheet, err
+		}
+		sheet.Comments = append(sheet.Comments, comment)
+	}
+	return sheet, comments.Err()
+}
+
+// parseTimesheetPath resolves the user and the Monday, in the user's
+// timezone, of the week named in the path.
+func parseTimesheetPath(ctx context.Context, w http.ResponseWriter, r *http.Request) (int, time.Time, bool) {
+	params := mux.Vars(r)
+	userID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, time.Time{}, false
+	}
+
+	var timezone string
+	err = database.From(ctx).QueryRowContext(ctx, "SELECT timezone FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL", userID, tenant(ctx)).Scan(&timezone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error querying user: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return 0, time.Time{}, false
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", params["week"], loc)
+	if err != nil {
+		http.Error(w, "Invalid week, expected YYYY-MM-DD", http.StatusBadRequest)
+		return 0, time.Time{}, false
+	}
+	return userID, weekStart(day.Add(12*time.Hour), timezone), true
+}
+
+func decodeTimesheetAction(w http.ResponseWriter, r *http.Request) (TimesheetActionRequest, bool) {
+	var req TimesheetActionRequest
+	if r.ContentLength == 0 {
+		return req, true
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return req, false
+	}
+	if len(req.Comment) > maxNotesLength {
+		http.Error(w, fmt.Sprintf("comment must be at most %d characters", maxNotesLength), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+func writeTimesheet(ctx context.Context, w http.ResponseWriter, userID int, week time.Time) {
+	sheet, err := loadTimesheet(ctx, database.From(ctx), userID, week)
+	if err != nil {
+		logger.Error("Error loading timesheet: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(sheet); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+func writeTimesheetList(ctx context.Context, w http.ResponseWriter, query string, args ...interface{}) {
+	rows, err := database.From(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sheets := make([]models.Timesheet, 0)
+	for rows.Next() {
+		var (
+			sheet                  models.Timesheet
+			weekStart              time.Time
+			submittedAt, decidedAt sql.NullTime
+		)
+		if err = rows.Scan(&sheet.ID, &sheet.UserID, &weekStart, &sheet.Status, &submittedAt, &decidedAt, &sheet.DecidedBy, &sheet.TotalMinutes); err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sheet.WeekStart = weekStart.Format("2006-01-02")
+		if submittedAt.Valid {
+			sheet.SubmittedAt = &submittedAt.Time
+		}
+		if decidedAt.Valid {
+			sheet.DecidedAt = &decidedAt.Time
+		}
+		sheets = append(sheets, sheet)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(sheets); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+func writeTimesheetError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTimesheetTransition) {
+		logger.Warning("Rejected timesheet action: %v", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, errNotManager) {
+		logger.Warning("Rejected timesheet action: %v", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	logger.Error("Error updating timesheet: %v", err)
+	http.Error(w, "Error updating timesheet", http.StatusInternalServerError)
+}
@@ -1,14 +1,21 @@
 package controllers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"test-project/audit"
 	"test-project/database"
 	"test-project/logger"
 	"test-project/models"
+	"test-project/outbox"
 	"time"
 )
 
@@ -32,9 +39,12 @@ type People struct {
 func GetUsers(w http.ResponseWriter, r *http.Request) {
 	logger.Info("GetUsers called")
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
-	logger.Info("Received query params - page:", pageStr, ", limit:", limitStr)
+	logger.Info("Received query params - page: %s, limit: %s", pageStr, limitStr)
 
 	page, err := strconv.Atoi(pageStr)
 	if err != nil {
@@ -52,13 +62,14 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Computed pagination values - page: %d, limit: %d, offset: %d", page, limit, offset)
 
 	query := `
-		SELECT id, passport_number, surname, name, patronymic, address, created_at, updated_at
+		SELECT id, organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at, timezone, max_task_minutes
 		FROM users
+		WHERE deleted_at IS NULL AND organization_id = $3
 		ORDER BY id
 		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := database.DB.Query(query, limit, offset)
+	rows, err := database.From(ctx).QueryContext(ctx, query, limit, offset, tenant(ctx))
 	if err != nil {
 		logger.Error("Error executing query: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -71,7 +82,7 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 	users := make([]models.User, 0)
 	for rows.Next() {
 		var user models.User
-		if err = rows.Scan(&user.ID, &user.PassportNumber, &user.Surname, &user.Name, &user.Patronymic, &user.Address, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		if err = rows.Scan(&user.ID, &user.OrganizationID, &user.PassportNumber, &user.Surname, &user.Name, &user.Patronymic, &user.Address, &user.CreatedAt, &user.UpdatedAt, &user.Timezone, &user.MaxTaskMinutes); err != nil {
 			logger.Error("Error scanning row: %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -107,6 +118,9 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 func CreateUser(w http.ResponseWriter, r *http.Request) {
 	logger.Info("CreateUser called")
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	var newUser models.User
 	err := json.NewDecoder(r.Body).Decode(&newUser)
 	if err != nil {
@@ -126,31 +140,53 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := database.DB // Подключение к базе данных
-
-	var nextFreeID int
-	err = db.QueryRow("SELECT get_next_free_user_id()").Scan(&nextFreeID)
-	if err != nil {
-		logger.Error("Failed to get next free user ID: %v", err)
-		http.Error(w, "Failed to get next free user ID", http.StatusInternalServerError)
+	if err = validateUserSettings(&newUser); err != nil {
+		logger.Warning("Invalid user settings: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	newUser.ID = nextFreeID
+	newUser.OrganizationID = tenant(ctx)
 	newUser.CreatedAt = time.Now().UTC()
 	newUser.UpdatedAt = newUser.CreatedAt
 
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	query := `
-        INSERT INTO users (id, passport_number, surname, name, patronymic, address, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        INSERT INTO users (organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at, timezone, max_task_minutes)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        RETURNING id
     `
-	_, err = db.ExecContext(r.Context(), query, newUser.ID, newUser.PassportNumber, newUser.Surname, newUser.Name, newUser.Patronymic, newUser.Address, newUser.CreatedAt, newUser.UpdatedAt)
+	err = tx.QueryRowContext(ctx, query, newUser.OrganizationID, newUser.PassportNumber, newUser.Surname, newUser.Name, newUser.Patronymic, newUser.Address, newUser.CreatedAt, newUser.UpdatedAt, newUser.Timezone, newUser.MaxTaskMinutes).Scan(&newUser.ID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A user with this passport number already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		logger.Error("Error inserting user: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityUser, EntityID: newUser.ID, UserID: newUser.ID, Action: audit.ActionCreate, After: newUser})
+	if err == nil {
+		err = outbox.Publish(ctx, tx, outbox.Event{Type: outbox.EventUserCreated, UserID: newUser.ID, Data: newUser})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error committing user: %v", err)
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+
 	logger.Info("User created successfully with ID %d", newUser.ID)
 
 	addUserToMigrationFile(newUser) // Ваш метод для миграций
@@ -163,7 +199,7 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Update a user
-// @Description Update user information
+// @Description Update user information. A timezone or maxTaskMinutes left out of the body keeps its current value; a null maxTaskMinutes removes the limit.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -175,6 +211,9 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	logger.Info("UpdateUser called")
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
 	if err != nil {
@@ -184,8 +223,17 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.Info("User ID: %d", id)
 
-	var updatedUser models.User
-	err = json.NewDecoder(r.Body).Decode(&updatedUser)
+	var (
+		updatedUser models.User
+		fields      map[string]json.RawMessage
+	)
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &updatedUser)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &fields)
+	}
 	if err != nil {
 		logger.Error("Failed to decode request body: %v", err)
 		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
@@ -204,30 +252,67 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := database.DB
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := selectUserForUpdate(ctx, tx, id)
+	if err == nil && before.DeletedAt != nil {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warning("No rows updated for user ID %d", id)
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error loading user: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	keepUserSettings(&updatedUser, before, fields)
+	if err = validateUserSettings(&updatedUser); err != nil {
+		logger.Warning("Invalid user settings: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updatedUser.ID = id
+	updatedUser.OrganizationID = before.OrganizationID
+	updatedUser.CreatedAt = before.CreatedAt
+	updatedUser.UpdatedAt = time.Now().UTC()
 
 	query := `
         UPDATE users
-        SET passport_number = $1, surname = $2, name = $3, patronymic = $4, address = $5, updated_at = $6
-        WHERE id = $7
+        SET passport_number = $1, surname = $2, name = $3, patronymic = $4, address = $5, updated_at = $6, timezone = $7, max_task_minutes = $8
+        WHERE id = $9
     `
-	result, err := db.ExecContext(r.Context(), query, updatedUser.PassportNumber, updatedUser.Surname, updatedUser.Name, updatedUser.Patronymic, updatedUser.Address, time.Now(), id)
-	if err != nil {
-		logger.Error("Error executing update query: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	_, err = tx.ExecContext(ctx, query, updatedUser.PassportNumber, updatedUser.Surname, updatedUser.Name, updatedUser.Patronymic, updatedUser.Address, updatedUser.UpdatedAt, updatedUser.Timezone, updatedUser.MaxTaskMinutes, id)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A user with this passport number already exists", http.StatusConflict)
 		return
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		logger.Error("Error getting rows affected: %v", err)
+		logger.Error("Error executing update query: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if rowsAffected == 0 {
-		logger.Warning("No rows updated for user ID %d", id)
-		http.Error(w, "User not found", http.StatusNotFound)
+	err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityUser, EntityID: id, UserID: id, Action: audit.ActionUpdate, Before: before, After: updatedUser})
+	if err == nil {
+		err = outbox.Publish(ctx, tx, outbox.Event{Type: outbox.EventUserUpdated, UserID: id, Data: updatedUser})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error committing user update: %v", err)
+		http.Error(w, "Error updating user", http.StatusInternalServerError)
 		return
 	}
 
@@ -235,8 +320,6 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	updateUserInMigrationFile(updatedUser, id)
 
-	updatedUser.ID = id
-
 	w.WriteHeader(http.StatusOK)
 	if err = json.NewEncoder(w).Encode(updatedUser); err != nil {
 		logger.Error("Error encoding response: %v", err)
@@ -247,17 +330,23 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Delete a user
-// @Description Delete a user by ID
+// @Description Soft-delete a user by ID. Admins may pass hard=true to remove the user and their tasks permanently.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
+// @Param hard query bool false "Permanently delete (admin only)"
 // @Success 200
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users/{id} [delete]
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	logger.Info("DeleteUser called")
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
 	if err != nil {
@@ -267,37 +356,22 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.Info("User ID: %d", id)
 
-	tx, err := database.DB.Begin()
-	if err != nil {
-		logger.Error("Error starting transaction: %v", err)
-		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+	if r.URL.Query().Get("hard") != "true" {
+		softDeleteUser(ctx, w, id)
 		return
 	}
 
-	_, err = tx.Exec("DELETE FROM tasks WHERE user_id = $1", id)
-	if err != nil {
-		logger.Error("Error deleting tasks: %v", err)
-		tx.Rollback()
-		http.Error(w, "Error deleting tasks", http.StatusInternalServerError)
+	if !isAdmin(r) {
+		logger.Warning("Hard delete of user %d refused: not an admin", id)
+		http.Error(w, "Hard delete requires admin privileges", http.StatusForbidden)
 		return
 	}
-	logger.Info("Tasks for user ID %d deleted successfully", id)
 
-	_, err = tx.Exec("DELETE FROM users WHERE id = $1", id)
-	if err != nil {
+	if err = hardDeleteUser(ctx, id); err != nil {
 		logger.Error("Error deleting user: %v", err)
-		tx.Rollback()
 		http.Error(w, "Error deleting user", http.StatusInternalServerError)
 		return
 	}
-	logger.Info("User with ID %d deleted successfully", id)
-
-	err = tx.Commit()
-	if err != nil {
-		logger.Error("Error committing transaction: %v", err)
-		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
-		return
-	}
 
 	if err = removeUserFromMigrationFile(id); err != nil {
 		logger.Error("Error removing user from migration file: %v", err)
@@ -314,3 +388,198 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	logger.Info("Response sent successfully")
 }
+
+func softDeleteUser(ctx context.Context, w http.ResponseWriter, id int) {
+	user, err := setUserDeleted(ctx, id, true)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warning("User not found: %d", id)
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error soft-deleting user: %v", err)
+			http.Error(w, "Error deleting user", http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Info("User with ID %d soft-deleted", id)
+
+	replaceUserInMigrationFile(user)
+
+	w.WriteHeader(http.StatusOK)
+	logger.Info("Response sent successfully")
+}
+
+// setUserDeleted sets or clears deleted_at, audits the change and publishes
+// it as a user.deleted or user.updated event. It returns
+// sql.ErrNoRows when no user with id is in the opposite state.
+func setUserDeleted(ctx context.Context, id int, deleted bool) (models.User, error) {
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := selectUserForUpdate(ctx, tx, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if (before.DeletedAt != nil) == deleted {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	after := before
+	after.UpdatedAt = time.Now().UTC()
+	action, event := audit.ActionRestore, outbox.EventUserUpdated
+	after.DeletedAt = nil
+	if deleted {
+		action, event = audit.ActionDelete, outbox.EventUserDeleted
+		after.DeletedAt = &after.UpdatedAt
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET deleted_at = $1, updated_at = $2 WHERE id = $3", after.DeletedAt, after.UpdatedAt, id)
+	if err != nil {
+		return models.User{}, fmt.Errorf("error updating user: %w", err)
+	}
+
+	if err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityUser, EntityID: id, UserID: id, Action: action, Before: before, After: after}); err != nil {
+		return models.User{}, err
+	}
+	if err = outbox.Publish(ctx, tx, outbox.Event{Type: event, UserID: id, Data: after}); err != nil {
+		return models.User{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return models.User{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return after, nil
+}
+
+// hardDeleteUser removes the user and all of their tasks in one transaction.
+func hardDeleteUser(ctx context.Context, id int) error {
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+
+	before, err := selectUserForUpdate(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM tasks WHERE user_id = $1", id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting tasks: %w", err)
+	}
+	logger.Info("Tasks for user ID %d deleted successfully", id)
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	logger.Info("User with ID %d deleted successfully", id)
+
+	if err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityUser, EntityID: id, UserID: id, Action: audit.ActionHardDelete, Before: before}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// A soft-deleted user was already announced as deleted.
+	if before.DeletedAt == nil {
+		if err = outbox.Publish(ctx, tx, outbox.Event{Type: outbox.EventUserDeleted, UserID: id, Data: before}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// @Summary Restore a user
+// @Description Restore a soft-deleted user
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /users/{id}/restore [post]
+func RestoreUser(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RestoreUser called")
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		logger.Warning("Invalid user ID: %v", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := setUserDeleted(ctx, id, false)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Warning("Deleted user not found: %d", id)
+			http.Error(w, "Deleted user not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error restoring user: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Info("User with ID %d restored", id)
+
+	replaceUserInMigrationFile(user)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(user); err != nil {
+		logger.Error("Error encoding response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// selectUserForUpdate locks the user, returning sql.ErrNoRows when it does
+// not belong to the request's organization.
+func selectUserForUpdate(ctx context.Context, tx *sql.Tx, id int) (models.User, error) {
+	var user models.User
+	query := `
+        SELECT id, organization_id, passport_number, surname, name, patronymic, address, created_at, updated_at, timezone, max_task_minutes, deleted_at
+        FROM users
+        WHERE id = $1 AND organization_id = $2
+        FOR UPDATE
+    `
+	err := tx.QueryRowContext(ctx, query, id, tenant(ctx)).Scan(&user.ID, &user.OrganizationID, &user.PassportNumber, &user.Surname, &user.Name, &user.Patronymic, &user.Address, &user.CreatedAt, &user.UpdatedAt, &user.Timezone, &user.MaxTaskMinutes, &user.DeletedAt)
+	return user, err
+}
+
+// keepUserSettings copies the scheduling settings of before into user unless
+// fields, the keys of the update body, sets them.
+func keepUserSettings(user *models.User, before models.User, fields map[string]json.RawMessage) {
+	if _, ok := fields["timezone"]; !ok {
+		user.Timezone = before.Timezone
+	}
+	if _, ok := fields["maxTaskMinutes"]; !ok {
+		user.MaxTaskMinutes = before.MaxTaskMinutes
+	}
+}
+
+// validateUserSettings defaults the timezone to UTC and checks the per-user scheduling settings.
+func validateUserSettings(user *models.User) error {
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(user.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", user.Timezone)
+	}
+	if user.MaxTaskMinutes != nil && *user.MaxTaskMinutes < 1 {
+		return fmt.Errorf("maxTaskMinutes must be positive")
+	}
+	return nil
+}
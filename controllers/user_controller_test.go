@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"encoding/json"
+	"test-project/models"
+	"testing"
+)
+
+func TestKeepUserSettings(t *testing.T) {
+	limit, newLimit := 480, 60
+	before := models.User{Name: "Old", Timezone: "Europe/Berlin", MaxTaskMinutes: &limit}
+	tests := []struct {
+		name         string
+		body         string
+		wantTimezone string
+		wantLimit    *int
+	}{
+		{name: "name only", body: `{"name":"New"}`, wantTimezone: "Europe/Berlin", wantLimit: &limit},
+		{name: "new timezone", body: `{"name":"New","timezone":"Asia/Tokyo"}`, wantTimezone: "Asia/Tokyo", wantLimit: &limit},
+		{name: "new limit", body: `{"name":"New","maxTaskMinutes":60}`, wantTimezone: "Europe/Berlin", wantLimit: &newLimit},
+		{name: "limit removed", body: `{"name":"New","maxTaskMinutes":null}`, wantTimezone: "Europe/Berlin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				user   models.User
+				fields map[string]json.RawMessage
+			)
+			if err := json.Unmarshal([]byte(tt.body), &user); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.body), &fields); err != nil {
+				t.Fatal(err)
+			}
+			keepUserSettings(&user, before, fields)
+
+			if user.Name != "New" {
+				t.Errorf("name %q, want New", user.Name)
+			}
+			if user.Timezone != tt.wantTimezone {
+				t.Errorf("timezone %q, want %q", user.Timezone, tt.wantTimezone)
+			}
+			if (user.MaxTaskMinutes == nil) != (tt.wantLimit == nil) || user.MaxTaskMinutes != nil && *user.MaxTaskMinutes != *tt.wantLimit {
+				t.Errorf("maxTaskMinutes %v, want %v", user.MaxTaskMinutes, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"net/http"
+	"net/url"
+	"strconv"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"test-project/outbox"
+	"time"
+)
+
+const (
+	maxWebhookURLLength = 2048
+	// maxDeliveriesListed bounds GET /webhooks/{id}/deliveries, which returns
+	// the most recent deliveries first.
+	maxDeliveriesListed = 100
+)
+
+const webhookColumns = "id, url, events, active, created_at, updated_at"
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, e.type, d.status, d.attempts, d.next_attempt_at,
+	d.response_status, COALESCE(d.error, ''), d.created_at, d.delivered_at`
+
+// resetDelivery queues a delivery to be sent again as if it were new.
+const resetDelivery = `status = 'pending', attempts = 0, next_attempt_at = NOW(), locked_until = NULL,
+	response_status = NULL, error = NULL, delivered_at = NULL, updated_at = NOW()`
+
+// @Summary Get webhooks
+// @Description Get the organization's webhooks. Secrets are not returned. Requires the admin token.
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} models.Webhook
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks [get]
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetWebhooks called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Listing webhooks requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	rows, err := database.From(ctx).QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE organization_id = $1 ORDER BY id", tenant(ctx))
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	webhooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(webhooks); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Register a webhook
+// @Description Register a URL to receive the organization's domain events (user.created, user.updated, user.deleted, task.started, task.stopped) as JSON POSTs. An empty events list subscribes to all of them. Each request carries X-Webhook-Event, X-Webhook-Delivery, X-Webhook-Timestamp and X-Webhook-Signature, which is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret. The secret is only returned once. Requires the admin token.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.Webhook true "URL, events and whether it is active"
+// @Success 201 {object} models.Webhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks [post]
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	logger.Info("CreateWebhook called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Registering webhooks requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	webhook := models.Webhook{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	events, err := validateWebhook(webhook.URL, webhook.Events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret := newToken("whsec_")
+	created, err := scanWebhook(database.From(ctx).QueryRowContext(ctx, `
+		INSERT INTO webhooks (organization_id, url, secret, events, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+webhookColumns, tenant(ctx), webhook.URL, secret, pq.Array(events), webhook.Active))
+	if err != nil {
+		logger.Error("Error inserting webhook: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created.Secret = secret
+	logger.Info("Webhook %d registered for %s", created.ID, created.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(created); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Update a webhook
+// @Description Change a webhook's URL, events or whether it is active. An inactive webhook is not sent events that occur while it is inactive, and its pending deliveries wait until it is active again. Requires the admin token.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param webhook body models.WebhookUpdate true "Fields to change"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id} [patch]
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	logger.Info("UpdateWebhook called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Updating webhooks requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var update models.WebhookUpdate
+	if err = json.NewDecoder(r.Body).Decode(&update); err != nil {
+		logger.Error("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	webhook, err := scanWebhook(tx.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1 AND organization_id = $2 FOR UPDATE", id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error loading webhook: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if update.URL != nil {
+		webhook.URL = *update.URL
+	}
+	if update.Events != nil {
+		webhook.Events = *update.Events
+	}
+	if update.Active != nil {
+		webhook.Active = *update.Active
+	}
+	if webhook.Events, err = validateWebhook(webhook.URL, webhook.Events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	webhook, err = scanWebhook(tx.QueryRowContext(ctx, `
+		UPDATE webhooks
+		SET url = $1, events = $2, active = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING `+webhookColumns, webhook.URL, pq.Array(webhook.Events), webhook.Active, id))
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logger.Error("Error updating webhook: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(webhook); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Delete a webhook
+// @Description Delete a webhook and its delivery history. Requires the admin token.
+// @Tags webhooks
+// @Param id path int true "Webhook ID"
+// @Success 204
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id} [delete]
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	logger.Info("DeleteWebhook called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Deleting webhooks requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := database.From(ctx).ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1 AND organization_id = $2", id, tenant(ctx))
+	if err != nil {
+		logger.Error("Error deleting webhook: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	logger.Info("Webhook %d deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Rotate a webhook's secret
+// @Description Replace a webhook's signing secret. The new secret is only returned once and signs every delivery sent from now on. Requires the admin token.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/secret [post]
+func RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	logger.Info("RotateWebhookSecret called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Rotating webhook secrets requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	secret := newToken("whsec_")
+	webhook, err := scanWebhook(database.From(ctx).QueryRowContext(ctx, `
+		UPDATE webhooks SET secret = $1, updated_at = NOW()
+		WHERE id = $2 AND organization_id = $3
+		RETURNING `+webhookColumns, secret, id, tenant(ctx)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			logger.Error("Error rotating webhook secret: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	webhook.Secret = secret
+	logger.Info("Secret of webhook %d rotated", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(webhook); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Get webhook deliveries
+// @Description Get a webhook's most recent deliveries, optionally only those with a status. Dead deliveries failed every attempt and can be replayed. Requires the admin token.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param status query string false "pending, delivered or dead"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries [get]
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	logger.Info("GetWebhookDeliveries called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Listing webhook deliveries requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	if err = checkWebhookExists(ctx, id); err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN outbox_events e ON e.id = d.event_id
+		WHERE d.webhook_id = $1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT $3`, id, status, maxDeliveriesListed)
+	if err != nil {
+		logger.Error("Error executing query: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			logger.Error("Error scanning row: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Error in rows iteration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(deliveries); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Replay a webhook delivery
+// @Description Send a dead or delivered delivery again, with a fresh set of attempts. Requires the admin token.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param deliveryId path int true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries/{deliveryId}/replay [post]
+func ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	logger.Info("ReplayWebhookDelivery called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Replaying webhook deliveries requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	params := mux.Vars(r)
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(params["deliveryId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	if err = checkWebhookExists(ctx, id); err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+
+	delivery, err := scanDelivery(database.From(ctx).QueryRowContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET `+resetDelivery+`
+		FROM outbox_events e
+		WHERE d.id = $1 AND d.webhook_id = $2 AND d.status <> 'pending' AND e.id = d.event_id
+		RETURNING `+deliveryColumns, deliveryID, id))
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err = database.From(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2)", deliveryID, id).Scan(&exists); err == nil {
+			if exists {
+				http.Error(w, "Delivery is still pending", http.StatusConflict)
+			} else {
+				http.Error(w, "Delivery not found", http.StatusNotFound)
+			}
+			return
+		}
+	}
+	if err != nil {
+		logger.Error("Error replaying delivery: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Delivery %d of webhook %d queued for replay", deliveryID, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(delivery); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// @Summary Replay webhook deliveries
+// @Description Without since, send every dead delivery of the webhook again. With since, send every subscribed event that occurred since then, including ones already delivered and ones that occurred before the webhook was registered or while it was inactive. Events are kept for retention.events. Requires the admin token.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param since query string false "RFC 3339 time"
+// @Success 200 {object} models.WebhookReplay
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/replay [post]
+func ReplayWebhook(w http.ResponseWriter, r *http.Request) {
+	logger.Info("ReplayWebhook called")
+
+	if !isAdmin(r) {
+		http.Error(w, "Replaying webhook deliveries requires the admin token", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err = checkWebhookExists(ctx, id); err != nil {
+		writeWebhookLookupError(w, err)
+		return
+	}
+
+	var result sql.Result
+	if since.IsZero() {
+		result, err = database.From(ctx).ExecContext(ctx, "UPDATE webhook_deliveries SET "+resetDelivery+" WHERE webhook_id = $1 AND status = 'dead'", id)
+	} else {
+		result, err = database.From(ctx).ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (webhook_id, event_id)
+			SELECT w.id, e.id
+			FROM webhooks w
+			JOIN outbox_events e ON e.organization_id = w.organization_id
+			WHERE w.id = $1 AND e.created_at >= $2 AND (cardinality(w.events) = 0 OR e.type = ANY(w.events))
+			ON CONFLICT (webhook_id, event_id) DO UPDATE SET `+resetDelivery+`
+			WHERE webhook_deliveries.status <> 'pending'`, id, since)
+	}
+	if err != nil {
+		logger.Error("Error replaying deliveries: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	replayed, _ := result.RowsAffected()
+	logger.Info("%d deliveries of webhook %d queued for replay", replayed, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(models.WebhookReplay{Replayed: replayed}); err != nil {
+		logger.Error("Error encoding response: %v", err)
+	}
+}
+
+// validateWebhook checks the URL and event types of a webhook and returns the
+// event types without duplicates.
+func validateWebhook(rawURL string, events []string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(rawURL) > maxWebhookURLLength {
+		return nil, fmt.Errorf("url must be an absolute http or https URL of at most %d characters", maxWebhookURLLength)
+	}
+
+	unique := make([]string, 0, len(events))
+	for _, event := range events {
+		if !outbox.IsType(event) {
+			return nil, fmt.Errorf("unknown event type %q", event)
+		}
+		if !contains(unique, event) {
+			unique = append(unique, event)
+		}
+	}
+	return unique, nil
+}
+
+// checkWebhookExists returns sql.ErrNoRows unless the webhook belongs to the
+// request's organization.
+func checkWebhookExists(ctx context.Context, id int) error {
+	var exists bool
+	err := database.From(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1 AND organization_id = $2)", id, tenant(ctx)).Scan(&exists)
+	if err == nil && !exists {
+		err = sql.ErrNoRows
+	}
+	return err
+}
+
+func writeWebhookLookupError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	logger.Error("Error loading webhook: %v", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	err := row.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Active, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if webhook.Events == nil {
+		webhook.Events = make([]string, 0)
+	}
+	return webhook, err
+}
+
+func scanDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var (
+		delivery       models.WebhookDelivery
+		nextAttemptAt  time.Time
+		responseStatus sql.NullInt64
+		deliveredAt    sql.NullTime
+	)
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Status, &delivery.Attempts, &nextAttemptAt,
+		&responseStatus, &delivery.Error, &delivery.CreatedAt, &deliveredAt)
+	if err != nil {
+		return delivery, err
+	}
+	if delivery.Status == models.DeliveryPending {
+		delivery.NextAttemptAt = &nextAttemptAt
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		delivery.ResponseStatus = &status
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return delivery, nil
+}
@@ -1,90 +1,248 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"test-project/config"
 	"test-project/logger"
+	"time"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 var DB *sql.DB
 
-func InitDB() {
-	err := godotenv.Load()
+// migrationsDir is the directory InitDB migrated from. The readiness probe
+// checks that every migration in it was applied.
+var migrationsDir string
+
+func InitDB(cfg config.DatabaseConfig) {
+	Connect(cfg)
+	migrationsDir = cfg.MigrationsPath
+
+	// Migrations and seeds touch every organization's rows.
+	err := WithScope(context.Background(), SystemScope, func(ctx context.Context) error {
+		return runMigrations(ctx, cfg.MigrationsPath)
+	})
 	if err != nil {
-		logger.Fatal("Error loading .env file: %v", err)
+		logger.Fatal("Error running migrations: %v", err)
 	}
 
-	connStr := os.Getenv("DATABASE_URL")
-	DB, err = sql.Open("postgres", connStr)
+	logger.Info("Database initialization complete")
+}
+
+// Connect opens the connection pool without touching the schema. Tools that
+// work on live data use it instead of InitDB, which migrates the schema.
+func Connect(cfg config.DatabaseConfig) {
+	var err error
+	DB, err = sql.Open("postgres", cfg.URL)
 	if err != nil {
 		logger.Fatal("Error opening database connection: %v", err)
 	}
 
-	if err = DB.Ping(); err != nil {
+	DB.SetMaxOpenConns(cfg.MaxOpenConns)
+	DB.SetMaxIdleConns(cfg.MaxIdleConns)
+	DB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	DB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	queryTimeout = cfg.QueryTimeout
+
+	if err = pingWithRetry(cfg); err != nil {
 		logger.Fatal("Error pinging database: %v", err)
 	}
 
-	if err = runMigrations("migrations"); err != nil {
-		logger.Fatal("Error running migrations: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.QueryTimeout)
+	defer cancel()
+	bypass, err := bypassesRowSecurity(ctx, DB)
+	switch {
+	case err != nil:
+		logger.Fatal("Error checking database role: %v", err)
+	case bypass && cfg.RequireRowSecurity:
+		logger.Fatal("The database role is a superuser or has BYPASSRLS, so row-level security would not separate organizations")
+	case bypass:
+		logger.Warning("The database role is a superuser or has BYPASSRLS; row-level security does not apply")
 	}
+}
 
-	logger.Info("Database initialization complete")
+// pingWithRetry pings the database until it answers, doubling the wait between
+// attempts up to cfg.RetryMaxBackoff.
+func pingWithRetry(cfg config.DatabaseConfig) error {
+	backoff := cfg.RetryBackoff
+	var err error
+	for attempt := 1; attempt <= cfg.ConnectRetries; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.QueryTimeout)
+		err = DB.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt == cfg.ConnectRetries {
+			break
+		}
+
+		logger.Warning("Database not ready (attempt %d/%d): %v; retrying in %s", attempt, cfg.ConnectRetries, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > cfg.RetryMaxBackoff {
+			backoff = cfg.RetryMaxBackoff
+		}
+	}
+	return fmt.Errorf("database unreachable after %d attempts: %w", cfg.ConnectRetries, err)
+}
+
+// Close closes the database connection pool.
+func Close() {
+	if DB == nil {
+		return
+	}
+	if err := DB.Close(); err != nil {
+		logger.Error("Error closing database connection: %v", err)
+		return
+	}
+	logger.Info("Database connection closed")
+}
+
+// migrationsLockID keys the advisory lock taken while migrating, so replicas
+// that start together apply each migration once.
+const migrationsLockID = 7243019
+
+// seedFiles are loaded into a freshly created schema, in order.
+var seedFiles = []string{
+	"20230707120000_insert_initial_users.sql",
+	"20230707120000_insert_initial_tasks.sql",
 }
 
-func runMigrations(migrationsPath string) error {
-	if err := executeMigrationFiles(migrationsPath, ".down.sql"); err != nil {
-		return fmt.Errorf("error executing down migrations: %w", err)
+// runMigrations applies every up migration not yet recorded in
+// schema_migrations, in version order, and records each one. Migrations that
+// ran before are never run again, so the data they created survives restarts.
+// The seed files are only loaded when the schema did not exist yet. Everything
+// runs in one transaction, so a failed migration leaves the schema untouched.
+func runMigrations(ctx context.Context, migrationsPath string) error {
+	migrations, err := readMigrations(migrationsPath)
+	if err != nil {
+		return err
 	}
 
-	if err := executeMigrationFiles(migrationsPath, ".up.sql"); err != nil {
-		return fmt.Errorf("error executing up migrations: %w", err)
+	tx, err := From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin migration transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	if err := createGetNextFreeUserIDFunction(DB); err != nil {
-		return fmt.Errorf("error creating get_next_free_user_id function: %w", err)
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLockID); err != nil {
+		return fmt.Errorf("could not lock migrations: %w", err)
 	}
 
-	if err := createGetNextFreeTaskIDFunction(DB); err != nil {
-		return fmt.Errorf("error creating get_next_free_task_id function: %w", err)
+	var fresh bool
+	if err = tx.QueryRowContext(ctx, "SELECT to_regclass('users') IS NULL").Scan(&fresh); err != nil {
+		return fmt.Errorf("could not check for an existing schema: %w", err)
 	}
 
-	if err := runSQLScript("migrations/20230707120000_insert_initial_users.sql"); err != nil {
-		return fmt.Errorf("error running SQL script for users: %w", err)
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		return fmt.Errorf("could not create schema_migrations table: %w", err)
+	}
+	applied, err := appliedMigrations(ctx, tx)
+	if err != nil {
+		return err
 	}
-	if err := runSQLScript("migrations/20230707120000_insert_initial_tasks.sql"); err != nil {
-		return fmt.Errorf("error running SQL script for tasks: %w", err)
+
+	for _, migration := range migrations {
+		if applied[migration.version] {
+			continue
+		}
+		logger.Info("Running migration: %s", migration.path)
+		if err = runSQLScript(ctx, tx, migration.path); err != nil {
+			return fmt.Errorf("error running migration %s: %w", migration.path, err)
+		}
+		if _, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", migration.version); err != nil {
+			return fmt.Errorf("could not record migration %d: %w", migration.version, err)
+		}
 	}
 
+	if fresh {
+		for _, name := range seedFiles {
+			if err = runSQLScript(ctx, tx, filepath.Join(migrationsPath, name)); err != nil {
+				return fmt.Errorf("error running seed %s: %w", name, err)
+			}
+		}
+	}
+
+	if err = realignSequences(ctx, tx); err != nil {
+		return fmt.Errorf("error realigning id sequences: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit migrations: %w", err)
+	}
+	if len(migrations) > 0 {
+		logger.Info("Schema at migration version %d", migrations[len(migrations)-1].version)
+	}
 	return nil
 }
 
-func executeMigrationFiles(migrationsPath string, suffix string) error {
+// migration is an up migration file and the version its name starts with.
+type migration struct {
+	version int64
+	path    string
+}
+
+// readMigrations lists the up migrations in migrationsPath by version. Down
+// migrations are kept for rolling back by hand and never run at startup.
+func readMigrations(migrationsPath string) ([]migration, error) {
 	files, err := ioutil.ReadDir(migrationsPath)
 	if err != nil {
-		return fmt.Errorf("could not read migrations directory: %w", err)
+		return nil, fmt.Errorf("could not read migrations directory: %w", err)
 	}
 
+	var migrations []migration
 	for _, file := range files {
-		if strings.HasSuffix(file.Name(), suffix) {
-			filePath := filepath.Join(migrationsPath, file.Name())
-			logger.Info("Running migration: %s", filePath)
-			if err = runSQLScript(filePath); err != nil {
-				return fmt.Errorf("error running SQL script for %s: %w", filePath, err)
-			}
+		if !strings.HasSuffix(file.Name(), ".up.sql") {
+			continue
 		}
+		prefix := strings.SplitN(file.Name(), "_", 2)[0]
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			logger.Warning("Skipping migration with non-numeric prefix: %s", file.Name())
+			continue
+		}
+		migrations = append(migrations, migration{version: version, path: filepath.Join(migrationsPath, file.Name())})
 	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
 
-	return nil
+// appliedMigrations returns the versions recorded in schema_migrations. q is
+// the pool or the migration transaction.
+func appliedMigrations(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}) (map[int64]bool, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
 }
 
-func runSQLScript(filePath string) error {
+func runSQLScript(ctx context.Context, tx *sql.Tx, filePath string) error {
 	script, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("could not read SQL file: %w", err)
@@ -97,7 +255,7 @@ func runSQLScript(filePath string) error {
 			continue
 		}
 
-		_, err = DB.Exec(query)
+		_, err = tx.ExecContext(ctx, query)
 		if err != nil {
 			return fmt.Errorf("could not execute SQL query: %w", err)
 		}
@@ -106,3 +264,24 @@ func runSQLScript(filePath string) error {
 	logger.Info("SQL script executed successfully: %s", filePath)
 	return nil
 }
+
+// PendingMigrations returns the versions of the up migrations on disk that
+// schema_migrations does not record as applied.
+func PendingMigrations(ctx context.Context) ([]int64, error) {
+	migrations, err := readMigrations(migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []int64
+	for _, migration := range migrations {
+		if !applied[migration.version] {
+			pending = append(pending, migration.version)
+		}
+	}
+	return pending, nil
+}
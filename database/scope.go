@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+const (
+	// CurrentOrgSetting is the session variable read by the row-level
+	// security policies. Rows are only visible when it holds their
+	// organization's ID, so a connection without it sees nothing.
+	CurrentOrgSetting = "app.current_org"
+	// SystemScope makes every organization's rows visible. It is meant for
+	// migrations and background jobs only.
+	SystemScope = "system"
+)
+
+// bypassesRowSecurity reports whether the connected role ignores the
+// row-level security policies. Superusers and roles with BYPASSRLS do, even
+// on tables with FORCE ROW LEVEL SECURITY, so the service must connect as an
+// ordinary role that owns the schema.
+func bypassesRowSecurity(ctx context.Context, q Querier) (bool, error) {
+	var bypass bool
+	err := q.QueryRowContext(ctx, "SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user").Scan(&bypass)
+	return bypass, err
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Conn.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+type connKey struct{}
+
+// queryTimeout bounds the reset of a scoped connection, which runs after the
+// caller's context may already be cancelled.
+var queryTimeout = 5 * time.Second
+
+// WithScope runs fn on a dedicated connection whose CurrentOrgSetting is
+// scope. Inside fn, From returns that connection. The setting is cleared
+// before the connection goes back to the pool.
+func WithScope(ctx context.Context, scope string, fn func(ctx context.Context) error) error {
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer release(conn)
+
+	if _, err = conn.ExecContext(ctx, "SELECT set_config($1, $2, false)", CurrentOrgSetting, scope); err != nil {
+		return fmt.Errorf("error setting %s: %w", CurrentOrgSetting, err)
+	}
+	return fn(context.WithValue(ctx, connKey{}, conn))
+}
+
+// From returns the connection WithScope bound to ctx, or the pool, on which
+// the row-level security policies hide every tenant's rows.
+func From(ctx context.Context) Querier {
+	if conn, ok := ctx.Value(connKey{}).(*sql.Conn); ok {
+		return conn
+	}
+	return DB
+}
+
+func release(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, "SELECT set_config($1, '', false)", CurrentOrgSetting); err != nil {
+		// Never return a connection that may still carry a scope to the pool.
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
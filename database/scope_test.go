@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"test-project/config"
+	"test-project/logger"
+	"testing"
+	"time"
+)
+
+// The tests in this file need the Postgres database named by
+// TEST_DATABASE_URL and are skipped without one. Connect as a role without
+// SUPERUSER or BYPASSRLS; row-level security does not apply to others.
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		return m.Run()
+	}
+
+	os.Setenv("DATABASE_URL", url)
+	cfg, err := config.Load([]string{"-profile", config.ProfileTest})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cfg.Database.MigrationsPath = "../migrations"
+	cfg.Database.RequireRowSecurity = true
+	logger.Init(cfg.Log)
+
+	InitDB(cfg.Database)
+	defer Close()
+	return m.Run()
+}
+
+// TestRowSecurity checks that the policies hide every organization's rows
+// from a connection without CurrentOrgSetting and show a scoped connection
+// only its own organization.
+func TestRowSecurity(t *testing.T) {
+	if DB == nil {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	bypass, err := bypassesRowSecurity(ctx, DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bypass {
+		t.Fatal("the test database role is a superuser or has BYPASSRLS, so row-level security cannot be tested")
+	}
+
+	var orgID, userID int
+	err = WithScope(ctx, SystemScope, func(ctx context.Context) error {
+		slug := "rls-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+		if err := From(ctx).QueryRowContext(ctx, "INSERT INTO organizations (slug, name) VALUES ($1, $1) RETURNING id", slug).Scan(&orgID); err != nil {
+			return err
+		}
+		if err := From(ctx).QueryRowContext(ctx, `
+			INSERT INTO users (organization_id, passport_number, surname, name, address, created_at, updated_at)
+			VALUES ($1, '1234 567890', 'Test', 'User', '', NOW(), NOW())
+			RETURNING id`, orgID).Scan(&userID); err != nil {
+			return err
+		}
+		_, err := From(ctx).ExecContext(ctx, `
+			INSERT INTO tasks (user_id, name, hours, minutes, created_at, updated_at, start_time, end_time)
+			VALUES ($1, 'Task', 1, 0, NOW(), NOW(), NOW() - INTERVAL '1 hour', NOW())`, userID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("creating test data: %v", err)
+	}
+
+	// count returns how many of the test user's rows are visible in users
+	// and tasks, and how many users are visible at all.
+	count := func(t *testing.T, ctx context.Context) (users, tasks, all int) {
+		t.Helper()
+		q := From(ctx)
+		if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = $1", userID).Scan(&users); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE user_id = $1", userID).Scan(&tasks); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&all); err != nil {
+			t.Fatal(err)
+		}
+		return users, tasks, all
+	}
+
+	tests := []struct {
+		name  string
+		scope *string
+		want  int
+	}{
+		{name: "pool without scope", want: 0},
+		{name: "empty scope", scope: new(string), want: 0},
+		{name: "own organization", scope: stringPtr(strconv.Itoa(orgID)), want: 1},
+		{name: "other organization", scope: stringPtr(strconv.Itoa(orgID + 1000000)), want: 0},
+		{name: "system", scope: stringPtr(SystemScope), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var users, tasks, all int
+			if tt.scope == nil {
+				users, tasks, all = count(t, ctx)
+			} else if err := WithScope(ctx, *tt.scope, func(ctx context.Context) error {
+				users, tasks, all = count(t, ctx)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if users != tt.want || tasks != tt.want {
+				t.Errorf("sees %d users and %d tasks of the test user, want %d", users, tasks, tt.want)
+			}
+			if tt.scope == nil || *tt.scope == "" {
+				if all != 0 {
+					t.Errorf("sees %d users without an organization, want 0", all)
+				}
+			}
+		})
+	}
+
+	// The scope is cleared before a connection goes back to the pool.
+	DB.SetMaxOpenConns(1)
+	defer DB.SetMaxOpenConns(0)
+	if err = WithScope(ctx, SystemScope, func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, all := count(t, ctx); all != 0 {
+		t.Errorf("pool sees %d users after a system scope was released, want 0", all)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"test-project/logger"
+)
+
+// sequenceTables lists the tables whose SERIAL id sequences are managed here.
+var sequenceTables = []string{"users", "tasks"}
+
+// realignSequences moves each id sequence past the highest id present in the
+// table. Seed rows are inserted with explicit ids, which leaves the sequences
+// behind the data. A sequence is never moved back, so the ids of deleted rows
+// are not handed out again.
+func realignSequences(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range sequenceTables {
+		query := fmt.Sprintf(`
+			SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), GREATEST(
+				(SELECT COALESCE(MAX(id), 0) FROM %[1]s),
+				(SELECT CASE WHEN is_called THEN last_value ELSE last_value - 1 END FROM %[1]s_id_seq),
+				1))`, table)
+		var value int64
+		if err := tx.QueryRowContext(ctx, query).Scan(&value); err != nil {
+			return fmt.Errorf("could not realign sequence for %s: %w", table, err)
+		}
+		logger.Info("Sequence for %s realigned to %d", table, value)
+	}
+	return nil
+}
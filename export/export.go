@@ -0,0 +1,151 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"test-project/parquet"
+	"time"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Column is a named, typed column of an export. Rows hold nil for NULL in
+// optional columns.
+type Column = parquet.Column
+
+// Writer encodes rows one at a time. Flush pushes what is buffered to the
+// underlying writer; Close finishes the file.
+type Writer interface {
+	Write(row []interface{}) error
+	Flush() error
+	Close() error
+}
+
+// ContentType returns the media type of format, or "" if it is unknown.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return ""
+	}
+}
+
+// NewWriter returns a Writer for format on w. CSV starts with a header row.
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+		for i, col := range columns {
+			cw.record[i] = col.Name
+		}
+		return cw, cw.w.Write(cw.record)
+	case FormatNDJSON:
+		jw := &jsonWriter{w: bufio.NewWriter(w), keys: make([][]byte, len(columns))}
+		for i, col := range columns {
+			key, _ := json.Marshal(col.Name)
+			jw.keys[i] = append(key, ':')
+		}
+		return jw, nil
+	case FormatParquet:
+		return parquetWriter{parquet.NewWriter(w, columns)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (cw *csvWriter) Write(row []interface{}) error {
+	for i, v := range row {
+		cw.record[i] = formatCSV(v)
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	return cw.Flush()
+}
+
+func formatCSV(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonWriter writes one JSON object per line, with keys in column order.
+type jsonWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+}
+
+func (jw *jsonWriter) Write(row []interface{}) error {
+	jw.w.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			jw.w.WriteByte(',')
+		}
+		jw.w.Write(jw.keys[i])
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC()
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		jw.w.Write(value)
+	}
+	jw.w.WriteByte('}')
+	return jw.w.WriteByte('\n')
+}
+
+func (jw *jsonWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+func (jw *jsonWriter) Close() error {
+	return jw.w.Flush()
+}
+
+// parquetWriter writes row groups as they fill up, so there is nothing to
+// flush in between.
+type parquetWriter struct {
+	*parquet.Writer
+}
+
+func (parquetWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,226 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineLength is the longest content line, in octets, before it is folded.
+const maxLineLength = 75
+
+// Event is a VEVENT. All-day events have AllDay set and dates at midnight
+// UTC; End is exclusive, as in RFC 5545.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Modified    time.Time
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Recurring   bool
+}
+
+// Parse reads the VEVENTs of an iCalendar stream. Recurrence rules are not
+// expanded; such events are returned once with Recurring set.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events  []Event
+		current *Event
+	)
+	for n, line := range lines {
+		name, params, value, ok := splitProperty(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = &Event{}
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", n+1)
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event %q has no DTSTART", n+1, current.Summary)
+			}
+			if current.End.IsZero() {
+				current.End = current.Start
+				if current.AllDay {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+		case name == "UID":
+			current.UID = value
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "RRULE" || name == "RDATE":
+			current.Recurring = true
+		case name == "DTSTART" || name == "DTEND":
+			t, allDay, err := parseTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", n+1, name, err)
+			}
+			if name == "DTSTART" {
+				current.Start, current.AllDay = t, allDay
+			} else {
+				current.End = t
+			}
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("unterminated VEVENT %q", current.Summary)
+	}
+	return events, nil
+}
+
+// maxEventDays bounds the days Days returns for one event.
+const maxEventDays = 366
+
+// Days returns the calendar days an event covers, at midnight UTC, up to a
+// year. Timed events cover the day they start on, in the timezone they are
+// given in.
+func (e Event) Days() []time.Time {
+	if !e.AllDay {
+		s := e.Start
+		return []time.Time{time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, time.UTC)}
+	}
+	var days []time.Time
+	for d := e.Start; d.Before(e.End) && len(days) < maxEventDays; d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// unfold joins continuation lines, which start with a space or a tab.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitProperty splits "NAME;PARAM=V:value" into its name, parameters and
+// value.
+func splitProperty(line string) (string, map[string]string, string, bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+func parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown TZID %q", tzid)
+		}
+		loc = l
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// Write renders events as an iCalendar stream named name. Timed events are
+// written in UTC.
+func Write(w io.Writer, name string, events []Event) error {
+	bw := bufio.NewWriter(w)
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:-//test-project//tasks//EN")
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "X-WR-CALNAME:"+escape(name))
+	for _, e := range events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+e.UID)
+		stamp := e.Modified
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+		writeLine(bw, "DTSTAMP:"+formatTime(stamp))
+		if e.AllDay {
+			writeLine(bw, "DTSTART;VALUE=DATE:"+e.Start.Format("20060102"))
+			writeLine(bw, "DTEND;VALUE=DATE:"+e.End.Format("20060102"))
+		} else {
+			writeLine(bw, "DTSTART:"+formatTime(e.Start))
+			writeLine(bw, "DTEND:"+formatTime(e.End))
+		}
+		writeLine(bw, "SUMMARY:"+escape(e.Summary))
+		if e.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escape(e.Description))
+		}
+		writeLine(bw, "END:VEVENT")
+	}
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// writeLine writes a content line, folding it after maxLineLength octets
+// without splitting a UTF-8 sequence.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+var unescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,172 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWrite(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{
+			UID:         "task-1@tracker",
+			Summary:     "Review, plan; ship",
+			Description: "first line\nsecond line",
+			Modified:    modified,
+			Start:       time.Date(2024, 3, 4, 10, 0, 0, 0, time.FixedZone("CET", 3600)),
+			End:         time.Date(2024, 3, 4, 11, 30, 0, 0, time.FixedZone("CET", 3600)),
+		},
+		{
+			UID:      "holiday-2@tracker",
+			Summary:  "Holiday",
+			Modified: modified,
+			Start:    time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC),
+			End:      time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+			AllDay:   true,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "Tasks", events); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//test-project//tasks//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:Tasks",
+		"BEGIN:VEVENT",
+		"UID:task-1@tracker",
+		"DTSTAMP:20240301T120000Z",
+		"DTSTART:20240304T090000Z",
+		"DTEND:20240304T103000Z",
+		`SUMMARY:Review\, plan\; ship`,
+		`DESCRIPTION:first line\nsecond line`,
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:holiday-2@tracker",
+		"DTSTAMP:20240301T120000Z",
+		"DTSTART;VALUE=DATE:20240308",
+		"DTEND;VALUE=DATE:20240309",
+		"SUMMARY:Holiday",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	if got := buf.String(); got != want {
+		t.Errorf("Write produced\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	summary := strings.Repeat("Überstunden für das Quartal ", 10)
+	var buf bytes.Buffer
+	err := Write(&buf, "Tasks", []Event{{UID: "1", Summary: summary, Modified: time.Now(), Start: time.Now(), End: time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a UTF-8 sequence: %q", line)
+		}
+	}
+
+	events, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != summary {
+		t.Errorf("folded summary read back as %+v", events)
+	}
+}
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	events := []Event{
+		{UID: "a", Summary: `Backslash \ and, comma`, Start: time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC)},
+		{UID: "b", Summary: "Two\nlines", Start: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), AllDay: true},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "Tasks", events); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("read back %d events, want %d", len(got), len(events))
+	}
+	for i, want := range events {
+		g := got[i]
+		if g.UID != want.UID || g.Summary != want.Summary || !g.Start.Equal(want.Start) || !g.End.Equal(want.End) || g.AllDay != want.AllDay {
+			t.Errorf("event %d read back as %+v, want %+v", i, g, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	tests := []struct {
+		name    string
+		event   string
+		want    Event
+		wantErr bool
+	}{
+		{
+			name:  "utc",
+			event: "UID:1\nDTSTART:20240304T090000Z\nDTEND:20240304T100000Z",
+			want:  Event{UID: "1", Start: time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "tzid",
+			event: "UID:2\nDTSTART;TZID=Europe/Berlin:20240304T090000",
+			want:  Event{UID: "2", Start: time.Date(2024, 3, 4, 9, 0, 0, 0, berlin), End: time.Date(2024, 3, 4, 9, 0, 0, 0, berlin)},
+		},
+		{
+			name:  "all day without end",
+			event: "UID:3\nDTSTART;VALUE=DATE:20241225",
+			want:  Event{UID: "3", Start: time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 12, 26, 0, 0, 0, 0, time.UTC), AllDay: true},
+		},
+		{
+			name:  "recurring",
+			event: "UID:4\nDTSTART;VALUE=DATE:20240101\nRRULE:FREQ=YEARLY",
+			want:  Event{UID: "4", Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), AllDay: true, Recurring: true},
+		},
+		{name: "no start", event: "UID:5", wantErr: true},
+		{name: "unknown timezone", event: "UID:6\nDTSTART;TZID=Nowhere/City:20240304T090000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "BEGIN:VCALENDAR\nBEGIN:VEVENT\n" + tt.event + "\nEND:VEVENT\nEND:VCALENDAR\n"
+			events, err := Parse(strings.NewReader(input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse succeeded with %+v, want an error", events)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			got := events[0]
+			if got.UID != tt.want.UID || !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) ||
+				got.AllDay != tt.want.AllDay || got.Recurring != tt.want.Recurring {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
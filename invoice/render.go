@@ -0,0 +1,149 @@
+package invoice
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"test-project/billing"
+	"test-project/models"
+	"unicode/utf8"
+)
+
+// WriteCSV writes one row per invoice line followed by a total row.
+func WriteCSV(w io.Writer, inv models.Invoice) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{{"invoice", "line", "description", "tasks", "hours", "amount", "currency"}}
+	for i, line := range inv.Lines {
+		records = append(records, []string{
+			inv.Number,
+			strconv.Itoa(i + 1),
+			line.Description,
+			strconv.Itoa(line.Tasks),
+			formatHours(line.Minutes),
+			billing.FormatAmount(line.Amount, inv.Currency),
+			inv.Currency,
+		})
+	}
+	records = append(records, []string{inv.Number, "", "Total", "", "", billing.FormatAmount(inv.Total, inv.Currency), inv.Currency})
+	if err := cw.WriteAll(records); err != nil {
+		return fmt.Errorf("error writing invoice CSV: %w", err)
+	}
+	return nil
+}
+
+const (
+	pageWidth    = 595 // A4 in points
+	pageHeight   = 842
+	margin       = 50
+	lineHeight   = 16
+	linesPerPage = 40
+)
+
+// WritePDF renders inv with the built-in template: a header with the invoice
+// number, client and period, a table of lines and the total. The standard
+// Courier font only covers Latin-1, so other characters print as "?".
+func WritePDF(w io.Writer, inv models.Invoice) error {
+	var pages [][]string
+	header := []string{
+		fmt.Sprintf("Invoice %s", inv.Number),
+		fmt.Sprintf("Client: %s", inv.ClientName),
+		fmt.Sprintf("Period: %s - %s", inv.PeriodStart.Format("2006-01-02"), inv.PeriodEnd.Format("2006-01-02")),
+		fmt.Sprintf("Issued: %s", inv.CreatedAt.Format("2006-01-02")),
+	}
+	if inv.Status == models.InvoiceVoid {
+		header = append(header, "VOID")
+	}
+	header = append(header, "", tableRow("Description", "Tasks", "Hours", "Amount"))
+
+	current := append([]string(nil), header...)
+	for _, line := range inv.Lines {
+		if len(current) >= linesPerPage {
+			pages = append(pages, current)
+			current = []string{tableRow("Description", "Tasks", "Hours", "Amount")}
+		}
+		current = append(current, tableRow(line.Description, strconv.Itoa(line.Tasks), formatHours(line.Minutes), billing.FormatAmount(line.Amount, inv.Currency)))
+	}
+	current = append(current, "", tableRow("Total", "", "", billing.FormatAmount(inv.Total, inv.Currency)+" "+inv.Currency))
+	pages = append(pages, current)
+
+	return writePDF(w, pages)
+}
+
+// tableRow lays out the columns for the monospaced page text.
+func tableRow(description, tasks, hours, amount string) string {
+	if utf8.RuneCountInString(description) > 48 {
+		description = string([]rune(description)[:47]) + "~"
+	}
+	return fmt.Sprintf("%-48s %6s %8s %14s", description, tasks, hours, amount)
+}
+
+func formatHours(minutes int) string {
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// writePDF writes a minimal PDF 1.4 document with one page per entry of
+// pages, each line set in Courier so that table columns line up.
+func writePDF(w io.Writer, pages [][]string) error {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1-3 are the catalog, the page tree and the font; each page
+	// then takes two objects, the page and its content stream.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 9 Tf %d TL %d %d Td\n", lineHeight, margin, pageHeight-margin)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfString(line))
+		}
+		fmt.Fprintf(&content, "ET\nBT /F1 8 Tf %d %d Td (Page %d of %d) Tj ET\n", pageWidth-margin-80, margin/2, i+1, len(pages))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfString escapes s for a PDF literal string in WinAnsi encoding.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127, r >= 160 && r <= 255:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"test-project/models"
+	"testing"
+	"time"
+)
+
+func testInvoice(lines int) models.Invoice {
+	inv := models.Invoice{
+		Number:      "INV-000042",
+		ClientName:  "Acme (Europe)",
+		Status:      models.InvoiceIssued,
+		PeriodStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		Currency:    "EUR",
+		CreatedAt:   time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC),
+	}
+	for i := 0; i < lines; i++ {
+		inv.Lines = append(inv.Lines, models.InvoiceLine{Description: fmt.Sprintf("Project %d", i+1), Tasks: 2, Minutes: 90, Amount: 15000})
+		inv.Total += 15000
+	}
+	return inv
+}
+
+func TestWriteCSV(t *testing.T) {
+	inv := testInvoice(2)
+	inv.Lines[1].Description = `Support, "urgent"`
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, inv); err != nil {
+		t.Fatal(err)
+	}
+	want := "invoice,line,description,tasks,hours,amount,currency\n" +
+		"INV-000042,1,Project 1,2,1:30,150.00,EUR\n" +
+		"INV-000042,2,\"Support, \"\"urgent\"\"\",2,1:30,150.00,EUR\n" +
+		"INV-000042,,Total,,,300.00,EUR\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteCSV produced\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestWritePDF checks the document structure a reader relies on: the cross
+// reference offsets, the stream lengths and the page count.
+func TestWritePDF(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines int
+		pages int
+	}{
+		{name: "empty", lines: 0, pages: 1},
+		{name: "one page", lines: 30, pages: 1},
+		{name: "two pages", lines: 50, pages: 2},
+		{name: "three pages", lines: 100, pages: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WritePDF(&buf, testInvoice(tt.lines)); err != nil {
+				t.Fatal(err)
+			}
+			checkPDF(t, buf.Bytes(), tt.pages)
+
+			text := buf.String()
+			if !strings.Contains(text, `(Client: Acme \(Europe\)) Tj`) {
+				t.Error("the client name is missing or its parentheses are not escaped")
+			}
+			if !strings.Contains(text, fmt.Sprintf("(Page %d of %d) Tj", tt.pages, tt.pages)) {
+				t.Errorf("the last page is not numbered %d of %d", tt.pages, tt.pages)
+			}
+			if tt.lines > 0 && !strings.Contains(text, fmt.Sprintf("(Project %d ", tt.lines)) {
+				t.Errorf("line %d is missing", tt.lines)
+			}
+		})
+	}
+}
+
+var (
+	objectHeader = regexp.MustCompile(`(?m)^(\d+) 0 obj$`)
+	streamObject = regexp.MustCompile(`<< /Length (\d+) >>\nstream\n`)
+)
+
+func checkPDF(t *testing.T, pdf []byte, pages int) {
+	t.Helper()
+	text := string(pdf)
+	if !strings.HasPrefix(text, "%PDF-1.4\n") || !strings.HasSuffix(text, "%%EOF\n") {
+		t.Fatal("missing PDF header or trailer")
+	}
+
+	start := strings.LastIndex(text, "startxref\n")
+	if start < 0 {
+		t.Fatal("no startxref")
+	}
+	xref, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(text[start+len("startxref\n"):], "%%EOF\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	objects := objectHeader.FindAllStringSubmatchIndex(text, -1)
+	if want := 3 + 2*pages; len(objects) != want {
+		t.Fatalf("%d objects, want %d", len(objects), want)
+	}
+	entries := strings.Split(text[xref:], "\n")[3:]
+	for i, object := range objects {
+		want := fmt.Sprintf("%010d 00000 n ", object[0])
+		if entries[i] != want {
+			t.Errorf("xref entry %d is %q, want %q", i+1, entries[i], want)
+		}
+		if n, _ := strconv.Atoi(text[object[2]:object[3]]); n != i+1 {
+			t.Errorf("object %d is numbered %d", i+1, n)
+		}
+	}
+
+	for _, m := range streamObject.FindAllStringSubmatchIndex(text, -1) {
+		length, _ := strconv.Atoi(text[m[2]:m[3]])
+		if !strings.HasPrefix(text[m[1]+length:], "\nendstream") {
+			t.Errorf("stream at %d is not %d bytes long", m[1], length)
+		}
+	}
+	if !strings.Contains(text, fmt.Sprintf("/Count %d >>", pages)) {
+		t.Errorf("page tree does not count %d pages", pages)
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`a (b) \c`, `a \(b\) \\c`},
+		{"Café", "Caf\xe9"},
+		{"Zürich – 東京", "Z\xfcrich ? ??"},
+		{"tab\tnewline\n", "tab?newline?"},
+	}
+	for _, tt := range tests {
+		if got := pdfString(tt.in); got != tt.want {
+			t.Errorf("pdfString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTableRow(t *testing.T) {
+	long := strings.Repeat("x", 60)
+	row := tableRow(long, "1", "0:30", "10.00")
+	if want := strings.Repeat("x", 47) + "~"; !strings.HasPrefix(row, want+" ") {
+		t.Errorf("long description not cut to 48 characters: %q", row)
+	}
+	if len(tableRow("a", "1", "0:30", "10.00")) != len(row) {
+		t.Error("rows of different descriptions have different widths")
+	}
+}
@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"test-project/audit"
+	"test-project/config"
+	"test-project/controllers"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"test-project/outbox"
+	"time"
+)
+
+type openTask struct {
+	task           models.Task
+	timezone       string
+	maxTaskMinutes sql.NullInt64
+}
+
+// RunAutoStop stops running tasks that exceed their owner's maximum duration
+// or the configured end-of-day cutoff, every cfg.Interval until ctx is cancelled.
+func RunAutoStop(ctx context.Context, cfg config.AutoStopConfig) {
+	if !cfg.Enabled {
+		logger.Info("Auto-stop job disabled")
+		return
+	}
+	runExclusive(ctx, database.DB, "auto-stop", lockAutoStop, cfg.Interval, func(ctx context.Context) error {
+		return database.WithScope(ctx, database.SystemScope, func(ctx context.Context) error {
+			stopped, err := autoStopTasks(ctx, cfg, time.Now().UTC())
+			if stopped > 0 {
+				logger.Info("Auto-stopped %d tasks", stopped)
+			}
+			return err
+		})
+	})
+}
+
+func autoStopTasks(ctx context.Context, cfg config.AutoStopConfig, now time.Time) (int, error) {
+	rows, err := database.From(ctx).QueryContext(ctx, `
+		SELECT t.id, t.user_id, COALESCE(t.name, ''), t.created_at, t.updated_at, t.start_time, u.timezone, u.max_task_minutes
+		FROM tasks t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.end_time IS NULL AND u.deleted_at IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("error selecting running tasks: %w", err)
+	}
+	var candidates []openTask
+	for rows.Next() {
+		var c openTask
+		if err = rows.Scan(&c.task.ID, &c.task.UserID, &c.task.Name, &c.task.CreatedAt, &c.task.UpdatedAt, &c.task.StartTime, &c.timezone, &c.maxTaskMinutes); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning running task: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating running tasks: %w", err)
+	}
+
+	stopped := 0
+	for _, c := range candidates {
+		limit := cfg.MaxTaskDuration
+		if c.maxTaskMinutes.Valid {
+			limit = time.Duration(c.maxTaskMinutes.Int64) * time.Minute
+		}
+		stopAt := autoStopTime(c.task.StartTime, limit, c.timezone, cfg.EndOfDay)
+		if now.Before(stopAt) {
+			continue
+		}
+
+		ok, err := stopTaskAt(ctx, c.task, stopAt, now)
+		if err != nil {
+			return stopped, err
+		}
+		if ok {
+			stopped++
+		}
+	}
+	return stopped, nil
+}
+
+// autoStopTime returns when a task started at start must stop: after limit,
+// or at the first end-of-day cutoff after start in the user's timezone,
+// whichever comes first.
+func autoStopTime(start time.Time, limit time.Duration, timezone, endOfDay string) time.Time {
+	stopAt := start.Add(limit)
+	if endOfDay == "" {
+		return stopAt
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	cutoff, err := time.Parse("15:04", endOfDay)
+	if err != nil {
+		return stopAt
+	}
+
+	local := start.In(loc)
+	eod := time.Date(local.Year(), local.Month(), local.Day(), cutoff.Hour(), cutoff.Minute(), 0, 0, loc)
+	if !eod.After(start) {
+		eod = eod.AddDate(0, 0, 1)
+	}
+	if eod.Before(stopAt) {
+		return eod.UTC()
+	}
+	return stopAt
+}
+
+// stopTaskAt closes the task at stopAt if it is still running as it was when
+// it was selected, and audits the change. It reports whether the task was
+// stopped.
+func stopTaskAt(ctx context.Context, candidate models.Task, stopAt, now time.Time) (bool, error) {
+	tx, err := database.From(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := controllers.LockTask(ctx, tx, candidate.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error loading task %d: %w", candidate.ID, err)
+	}
+	// A task stopped or moved since it was selected is left for the next run.
+	if !before.EndTime.IsZero() || !before.StartTime.Equal(candidate.StartTime) {
+		return false, nil
+	}
+
+	after := before
+	after.EndTime = stopAt
+	duration := stopAt.Sub(before.StartTime)
+	after.Hours = int(duration.Hours())
+	after.Minutes = int(duration.Minutes()) % 60
+	after.UpdatedAt = now
+	after.AutoStopped = true
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tasks
+		SET end_time = $1, hours = $2, minutes = $3, updated_at = $4, auto_stopped = TRUE
+		WHERE id = $5`,
+		after.EndTime, after.Hours, after.Minutes, after.UpdatedAt, after.ID)
+	if err != nil {
+		return false, fmt.Errorf("error stopping task %d: %w", after.ID, err)
+	}
+
+	if err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: after.ID, UserID: after.UserID, Action: audit.ActionAutoStop, Before: before, After: after}); err != nil {
+		return false, err
+	}
+	if err = outbox.Publish(ctx, tx, outbox.Event{Type: outbox.EventTaskStopped, UserID: after.UserID, Data: after}); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing auto-stop: %w", err)
+	}
+	logger.Info("Auto-stopped task %d of user %d at %s", after.ID, after.UserID, stopAt.Format(time.RFC3339))
+	return true, nil
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"test-project/config"
+	"test-project/controllers"
+	"test-project/database"
+	"test-project/logger"
+)
+
+// RunPurge removes soft-deleted users, finished jobs and old events past their
+// retention periods every cfg.PurgeInterval until ctx is cancelled.
+func RunPurge(ctx context.Context, cfg config.RetentionConfig) {
+	runExclusive(ctx, database.DB, "purge", lockPurge, cfg.PurgeInterval, func(ctx context.Context) error {
+		return database.WithScope(ctx, database.SystemScope, func(ctx context.Context) error {
+			purged, err := controllers.PurgeDeletedUsers(ctx, cfg.DeletedUsers)
+			if purged > 0 {
+				logger.Info("Purged %d deleted users", purged)
+			}
+			if err != nil {
+				return err
+			}
+			purgedJobs, err := controllers.PurgeFinishedJobs(ctx, cfg.FinishedJobs)
+			if purgedJobs > 0 {
+				logger.Info("Purged %d finished jobs", purgedJobs)
+			}
+			if err != nil {
+				return err
+			}
+			purgedEvents, err := controllers.PurgeOldEvents(ctx, cfg.Events)
+			if purgedEvents > 0 {
+				logger.Info("Purged %d old events", purgedEvents)
+			}
+			return err
+		})
+	})
+}
@@ -0,0 +1,397 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"test-project/config"
+	"test-project/controllers"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/models"
+	"time"
+)
+
+const (
+	// resultChunkSize is the size of the pieces a job result is stored in.
+	resultChunkSize = 1 << 20
+	// maxErrorLength bounds the response excerpt kept as a failed job's error.
+	maxErrorLength = 512
+	// finishTimeout bounds recording a job's outcome, which happens after its
+	// own context may have been cancelled.
+	finishTimeout = 10 * time.Second
+	// maxHeartbeatInterval bounds how stale a running job's progress can be.
+	maxHeartbeatInterval = 5 * time.Second
+)
+
+var (
+	errCancelled = errors.New("job cancelled")
+	errLeaseLost = errors.New("job lease lost")
+)
+
+// claimedJob is a job a worker has taken from the queue.
+type claimedJob struct {
+	id              int64
+	request         controllers.JobRequest
+	attempts        int
+	maxAttempts     int
+	cancelRequested bool
+}
+
+// RunWorkers runs queued jobs on cfg.Workers workers until ctx is cancelled.
+// Jobs are claimed with FOR UPDATE SKIP LOCKED, so any number of replicas can
+// share the queue. Jobs interrupted by shutdown are put back in the queue.
+func RunWorkers(ctx context.Context, cfg config.JobsConfig) {
+	if cfg.Workers == 0 {
+		logger.Info("Job workers disabled")
+		return
+	}
+	host, _ := os.Hostname()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			runWorker(ctx, cfg, id)
+		}(fmt.Sprintf("%s-%d-%d", host, os.Getpid(), i))
+	}
+	logger.Info("Started %d job workers", cfg.Workers)
+	wg.Wait()
+}
+
+func runWorker(ctx context.Context, cfg config.JobsConfig, workerID string) {
+	for ctx.Err() == nil {
+		job, err := claimJob(ctx, cfg, workerID)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Worker %s could not claim a job: %v", workerID, err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(cfg.PollInterval):
+			}
+			continue
+		}
+		processJob(ctx, cfg, workerID, job)
+	}
+}
+
+// claimJob takes the next due job, or a running one whose worker stopped
+// renewing its lease. It returns nil when there is none.
+func claimJob(ctx context.Context, cfg config.JobsConfig, workerID string) (*claimedJob, error) {
+	var job *claimedJob
+	err := database.WithScope(ctx, database.SystemScope, func(ctx context.Context) error {
+		var (
+			j       claimedJob
+			payload []byte
+		)
+		err := database.From(ctx).QueryRowContext(ctx, `
+			UPDATE jobs
+			SET status = 'running', attempts = attempts + 1, locked_by = $1, locked_until = NOW() + make_interval(secs => $2),
+				started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+			WHERE id = (
+				SELECT id FROM jobs
+				WHERE (status = 'queued' AND run_at <= NOW()) OR (status = 'running' AND locked_until < NOW())
+				ORDER BY run_at, id
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED)
+			RETURNING id, organization_id, actor, kind, query, content_type, payload, attempts, max_attempts, cancel_requested`,
+			workerID, cfg.LeaseDuration.Seconds()).
+			Scan(&j.id, &j.request.OrganizationID, &j.request.Actor, &j.request.Kind, &j.request.Query, &j.request.ContentType, &payload,
+				&j.attempts, &j.maxAttempts, &j.cancelRequested)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		j.request.Payload = payload
+		job = &j
+		return nil
+	})
+	return job, err
+}
+
+// processJob runs a claimed job and records its outcome. Server errors are
+// retried with exponential backoff; client errors fail the job at once, as
+// running it again would not change the answer.
+func processJob(ctx context.Context, cfg config.JobsConfig, workerID string, job *claimedJob) {
+	switch {
+	case job.cancelRequested:
+		finishJob(workerID, job.id, models.JobCancelled, "", nil)
+		return
+	case job.attempts > job.maxAttempts:
+		finishJob(workerID, job.id, models.JobFailed, fmt.Sprintf("worker lost after %d attempts", job.maxAttempts), nil)
+		return
+	}
+	logger.Info("Worker %s running job %d (%s), attempt %d of %d", workerID, job.id, job.request.Kind, job.attempts, job.maxAttempts)
+
+	if err := withSystemScope(ctx, func(ctx context.Context) error {
+		_, err := database.From(ctx).ExecContext(ctx, "DELETE FROM job_result_chunks WHERE job_id = $1", job.id)
+		return err
+	}); err != nil {
+		logger.Error("Error clearing result of job %d: %v", job.id, err)
+		retryJob(cfg, workerID, job, err.Error())
+		return
+	}
+
+	runCtx, cancelRun := context.WithCancelCause(ctx)
+	defer cancelRun(nil)
+	runCtx, cancelTimeout := context.WithTimeout(runCtx, cfg.Timeout)
+	defer cancelTimeout()
+
+	var done, total atomic.Int64
+	progress := func(d, t int64) {
+		done.Store(d)
+		total.Store(t)
+	}
+	heartbeatDone := make(chan struct{})
+	stopHeartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		heartbeat(ctx, cfg, workerID, job.id, &done, &total, stopHeartbeat, cancelRun)
+	}()
+
+	result := &resultWriter{ctx: runCtx, jobID: job.id, header: make(http.Header)}
+	err := runRecovered(runCtx, job.request, result, progress)
+	if err == nil {
+		err = result.close()
+	}
+	close(stopHeartbeat)
+	<-heartbeatDone
+
+	failed := err != nil || result.status >= http.StatusInternalServerError
+	switch cause := context.Cause(runCtx); {
+	case errors.Is(cause, errLeaseLost):
+		logger.Warning("Worker %s lost the lease of job %d", workerID, job.id)
+	case errors.Is(cause, errCancelled):
+		logger.Info("Job %d cancelled", job.id)
+		finishJob(workerID, job.id, models.JobCancelled, "", nil)
+	case failed && ctx.Err() != nil:
+		logger.Info("Job %d interrupted by shutdown, requeueing", job.id)
+		requeueJob(workerID, job.id)
+	case failed && errors.Is(cause, context.DeadlineExceeded):
+		retryJob(cfg, workerID, job, fmt.Sprintf("timed out after %s", cfg.Timeout))
+	case err != nil:
+		logger.Error("Job %d failed: %v", job.id, err)
+		retryJob(cfg, workerID, job, err.Error())
+	case failed:
+		logger.Error("Job %d failed with status %d", job.id, result.status)
+		if job.attempts < job.maxAttempts {
+			retryJob(cfg, workerID, job, result.errorText())
+		} else {
+			finishJob(workerID, job.id, models.JobFailed, result.errorText(), result)
+		}
+	case result.status >= http.StatusBadRequest:
+		logger.Warning("Job %d rejected with status %d", job.id, result.status)
+		finishJob(workerID, job.id, models.JobFailed, result.errorText(), result)
+	default:
+		logger.Info("Job %d succeeded, %d bytes of result", job.id, result.size)
+		finishJob(workerID, job.id, models.JobSucceeded, "", result)
+	}
+}
+
+// runRecovered runs the job, turning a panic of its handler into an error.
+func runRecovered(ctx context.Context, req controllers.JobRequest, w http.ResponseWriter, progress controllers.ProgressFunc) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if p == http.ErrAbortHandler {
+				err = errors.New("response aborted")
+			} else {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}
+	}()
+	return controllers.RunJob(ctx, req, w, progress)
+}
+
+// heartbeat renews the job's lease and stores its progress until stop is
+// closed, and stores the final progress then. It cancels the run when
+// cancellation is requested or the lease was taken over by another worker.
+func heartbeat(ctx context.Context, cfg config.JobsConfig, workerID string, jobID int64, done, total *atomic.Int64, stop <-chan struct{}, cancelRun context.CancelCauseFunc) {
+	interval := cfg.LeaseDuration / 3
+	if interval > maxHeartbeatInterval {
+		interval = maxHeartbeatInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for final := false; !final; {
+		select {
+		case <-stop:
+			final = true
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var cancelRequested bool
+		err := withSystemScope(ctx, func(ctx context.Context) error {
+			return database.From(ctx).QueryRowContext(ctx, `
+				UPDATE jobs
+				SET locked_until = NOW() + make_interval(secs => $1), progress_done = $2, progress_total = NULLIF($3, 0), updated_at = NOW()
+				WHERE id = $4 AND locked_by = $5 AND status = 'running'
+				RETURNING cancel_requested`,
+				cfg.LeaseDuration.Seconds(), done.Load(), total.Load(), jobID, workerID).Scan(&cancelRequested)
+		})
+		switch {
+		case err == sql.ErrNoRows:
+			cancelRun(errLeaseLost)
+			return
+		case err != nil:
+			if ctx.Err() == nil {
+				logger.Warning("Could not renew the lease of job %d: %v", jobID, err)
+			}
+		case cancelRequested:
+			cancelRun(errCancelled)
+			return
+		}
+	}
+}
+
+// finishJob records the final status of a job, and its result if any.
+func finishJob(workerID string, jobID int64, status, message string, result *resultWriter) {
+	var (
+		resultStatus, resultSize      sql.NullInt64
+		resultType, resultDisposition sql.NullString
+	)
+	if result != nil {
+		resultStatus = sql.NullInt64{Int64: int64(result.status), Valid: true}
+		resultSize = sql.NullInt64{Int64: result.size, Valid: true}
+		resultType = sql.NullString{String: result.header.Get("Content-Type"), Valid: true}
+		resultDisposition = sql.NullString{String: result.header.Get("Content-Disposition"), Valid: true}
+	}
+	updateJob(workerID, jobID, `
+		UPDATE jobs
+		SET status = $3, error = NULLIF($4, ''), result_status = $5, result_content_type = $6, result_disposition = $7, result_size = $8,
+			locked_by = NULL, locked_until = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2`,
+		status, message, resultStatus, resultType, resultDisposition, resultSize)
+}
+
+// retryJob puts a failed job back in the queue after a backoff, or fails it
+// for good once it has used all its attempts.
+func retryJob(cfg config.JobsConfig, workerID string, job *claimedJob, message string) {
+	if job.attempts >= job.maxAttempts {
+		finishJob(workerID, job.id, models.JobFailed, message, nil)
+		return
+	}
+	backoff := cfg.RetryBackoff << (job.attempts - 1)
+	if backoff > cfg.RetryMaxBackoff || backoff <= 0 {
+		backoff = cfg.RetryMaxBackoff
+	}
+	logger.Info("Retrying job %d in %s", job.id, backoff)
+	updateJob(workerID, job.id, `
+		UPDATE jobs
+		SET status = 'queued', error = $3, run_at = NOW() + make_interval(secs => $4), locked_by = NULL, locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2`,
+		message, backoff.Seconds())
+}
+
+// requeueJob releases a job interrupted by shutdown without counting the
+// attempt, so another worker picks it up right away.
+func requeueJob(workerID string, jobID int64) {
+	updateJob(workerID, jobID, `
+		UPDATE jobs
+		SET status = 'queued', attempts = attempts - 1, run_at = NOW(), locked_by = NULL, locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2`)
+}
+
+// updateJob runs query with the job ID and worker ID as $1 and $2, followed
+// by args. It outlives the worker's context, so that shutdown still records
+// what happened to the job.
+func updateJob(workerID string, jobID int64, query string, args ...interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+	err := withSystemScope(ctx, func(ctx context.Context) error {
+		_, err := database.From(ctx).ExecContext(ctx, query, append([]interface{}{jobID, workerID}, args...)...)
+		return err
+	})
+	if err != nil {
+		// The lease expires and another worker runs the job again.
+		logger.Error("Error updating job %d: %v", jobID, err)
+	}
+}
+
+func withSystemScope(ctx context.Context, fn func(ctx context.Context) error) error {
+	return database.WithScope(ctx, database.SystemScope, fn)
+}
+
+// resultWriter stores the response of a job in chunks of resultChunkSize, so
+// results of any size can be served by every replica.
+type resultWriter struct {
+	ctx    context.Context
+	jobID  int64
+	header http.Header
+	status int
+	buf    []byte
+	head   []byte
+	seq    int
+	size   int64
+	err    error
+}
+
+func (rw *resultWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *resultWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+func (rw *resultWriter) Write(p []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	if n := maxErrorLength - len(rw.head); n > 0 {
+		rw.head = append(rw.head, p[:min(n, len(p))]...)
+	}
+	rw.buf = append(rw.buf, p...)
+	rw.size += int64(len(p))
+	if len(rw.buf) >= resultChunkSize {
+		rw.store()
+	}
+	return len(p), rw.err
+}
+
+// Flush is a no-op: chunks are stored as they fill up. It lets handlers that
+// flush as they stream run unchanged.
+func (rw *resultWriter) Flush() {}
+
+func (rw *resultWriter) close() error {
+	rw.WriteHeader(http.StatusOK)
+	if len(rw.buf) > 0 && rw.err == nil {
+		rw.store()
+	}
+	return rw.err
+}
+
+func (rw *resultWriter) store() {
+	rw.err = withSystemScope(rw.ctx, func(ctx context.Context) error {
+		_, err := database.From(ctx).ExecContext(ctx, "INSERT INTO job_result_chunks (job_id, seq, data) VALUES ($1, $2, $3)", rw.jobID, rw.seq, rw.buf)
+		return err
+	})
+	if rw.err != nil {
+		rw.err = fmt.Errorf("error storing job result: %w", rw.err)
+	}
+	rw.seq++
+	rw.buf = rw.buf[:0]
+}
+
+// errorText is the start of the response, which for a failed request is
+// its error message.
+func (rw *resultWriter) errorText() string {
+	text := strings.TrimSpace(strings.ToValidUTF8(string(rw.head), ""))
+	if text == "" {
+		text = fmt.Sprintf("request failed with status %d", rw.status)
+	}
+	return text
+}
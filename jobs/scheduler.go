@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"test-project/logger"
+	"time"
+)
+
+// Advisory lock keys, one per job. Only the replica holding a job's lock runs it.
+const (
+	lockPurge    int64 = 7341001
+	lockAutoStop int64 = 7341002
+)
+
+// runExclusive calls fn every interval while this process holds the Postgres
+// advisory lock key. The lock is session-scoped and held on a dedicated
+// connection, so it is released automatically if the replica dies.
+func runExclusive(ctx context.Context, db *sql.DB, name string, key int64, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var conn *sql.Conn
+	defer func() {
+		if conn != nil {
+			releaseLock(conn, name, key)
+		}
+	}()
+
+	for {
+		if conn != nil && conn.PingContext(ctx) != nil {
+			logger.Warning("Lost leader connection for job %s", name)
+			discardConn(conn)
+			conn = nil
+		}
+		if conn == nil {
+			conn = tryAcquireLock(ctx, db, name, key)
+		}
+
+		if conn != nil {
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("Job %s failed: %v", name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func tryAcquireLock(ctx context.Context, db *sql.DB, name string, key int64) *sql.Conn {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warning("Job %s could not get a connection: %v", name, err)
+		}
+		return nil
+	}
+
+	var acquired bool
+	if err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		if ctx.Err() == nil {
+			logger.Warning("Job %s could not try the advisory lock: %v", name, err)
+		}
+		// The lock may have been taken even though the answer was lost.
+		discardConn(conn)
+		return nil
+	}
+	if !acquired {
+		conn.Close()
+		return nil
+	}
+
+	logger.Info("This replica is now leader for job %s", name)
+	return conn
+}
+
+func releaseLock(conn *sql.Conn, name string, key int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+		logger.Warning("Job %s could not release the advisory lock: %v", name, err)
+		discardConn(conn)
+		return
+	}
+	conn.Close()
+}
+
+// discardConn closes conn without returning it to the pool. An idle pooled
+// connection that still held the session advisory lock would keep every
+// replica, this one included, from running the job until the pool recycled
+// it. Closing the session releases the lock.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
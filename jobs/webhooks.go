@@ -0,0 +1,305 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"test-project/config"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/middleware"
+	"test-project/models"
+	"time"
+)
+
+const (
+	// dispatchBatch bounds how many outbox events are fanned out to webhook
+	// deliveries per transaction.
+	dispatchBatch = 500
+	// maxResponseDrain bounds how much of a webhook's response is read, so
+	// the connection can be reused.
+	maxResponseDrain = 64 << 10
+)
+
+// Headers sent with every webhook request.
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// claimedDelivery is a webhook delivery a dispatcher has taken to send.
+type claimedDelivery struct {
+	id        int64
+	attempts  int
+	url       string
+	secret    string
+	requestID string
+	event     models.WebhookEvent
+}
+
+// RunWebhooks delivers outbox events to the webhooks subscribed to them until
+// ctx is cancelled. New events are fanned out to one delivery per webhook,
+// then due deliveries are sent cfg.Workers at a time. Both steps use FOR
+// UPDATE SKIP LOCKED, so every replica can run a dispatcher.
+func RunWebhooks(ctx context.Context, cfg config.WebhooksConfig) {
+	if cfg.Workers == 0 {
+		logger.Info("Webhook delivery disabled")
+		return
+	}
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		// A redirect is reported as a failure rather than followed, since
+		// following it would turn the POST into a GET.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	logger.Info("Started webhook dispatcher with %d workers", cfg.Workers)
+
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := dispatchEvents(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Error dispatching events: %v", err)
+		}
+		if err := sendDueDeliveries(ctx, cfg, client); err != nil && ctx.Err() == nil {
+			logger.Error("Error sending webhook deliveries: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchEvents creates a delivery for every active webhook subscribed to
+// each undispatched event, and marks the events dispatched.
+func dispatchEvents(ctx context.Context) error {
+	for ctx.Err() == nil {
+		var dispatched int64
+		err := withSystemScope(ctx, func(ctx context.Context) error {
+			result, err := database.From(ctx).ExecContext(ctx, `
+				WITH events AS (
+					SELECT id, organization_id, type
+					FROM outbox_events
+					WHERE dispatched_at IS NULL
+					ORDER BY id
+					LIMIT $1
+					FOR UPDATE SKIP LOCKED
+				), deliveries AS (
+					INSERT INTO webhook_deliveries (webhook_id, event_id)
+					SELECT w.id, e.id
+					FROM events e
+					JOIN webhooks w ON w.organization_id = e.organization_id
+					WHERE w.active AND (cardinality(w.events) = 0 OR e.type = ANY(w.events))
+					ON CONFLICT (webhook_id, event_id) DO NOTHING
+				)
+				UPDATE outbox_events SET dispatched_at = NOW() WHERE id IN (SELECT id FROM events)`, dispatchBatch)
+			if err != nil {
+				return err
+			}
+			dispatched, err = result.RowsAffected()
+			return err
+		})
+		if err != nil || dispatched < dispatchBatch {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDueDeliveries sends due deliveries in batches of cfg.Workers until none
+// are left.
+func sendDueDeliveries(ctx context.Context, cfg config.WebhooksConfig, client *http.Client) error {
+	for ctx.Err() == nil {
+		deliveries, err := claimDeliveries(ctx, cfg)
+		if err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery claimedDelivery) {
+				defer wg.Done()
+				sendDelivery(ctx, cfg, client, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < cfg.Workers {
+			return nil
+		}
+	}
+	return nil
+}
+
+// claimDeliveries takes up to cfg.Workers due deliveries of active webhooks
+// and counts the attempt. Each is leased for long enough to send it and
+// record the outcome; a delivery whose dispatcher died is sent again once its
+// lease expires.
+func claimDeliveries(ctx context.Context, cfg config.WebhooksConfig) ([]claimedDelivery, error) {
+	var deliveries []claimedDelivery
+	err := withSystemScope(ctx, func(ctx context.Context) error {
+		rows, err := database.From(ctx).QueryContext(ctx, `
+			UPDATE webhook_deliveries d
+			SET attempts = d.attempts + 1, locked_until = NOW() + make_interval(secs => $2), updated_at = NOW()
+			FROM (
+				SELECT wd.id
+				FROM webhook_deliveries wd
+				JOIN webhooks w ON w.id = wd.webhook_id
+				WHERE wd.status = 'pending' AND wd.next_attempt_at <= NOW() AND (wd.locked_until IS NULL OR wd.locked_until < NOW()) AND w.active
+				ORDER BY wd.next_attempt_at, wd.id
+				LIMIT $1
+				FOR UPDATE OF wd SKIP LOCKED
+			) due, webhooks w, outbox_events e
+			WHERE d.id = due.id AND w.id = d.webhook_id AND e.id = d.event_id
+			RETURNING d.id, d.attempts, w.url, w.secret, COALESCE(e.request_id, ''),
+				e.id, e.type, e.organization_id, COALESCE(e.user_id, 0), e.actor, e.created_at, e.data`,
+			cfg.Workers, (cfg.Timeout + finishTimeout).Seconds())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				d    claimedDelivery
+				data []byte
+			)
+			err = rows.Scan(&d.id, &d.attempts, &d.url, &d.secret, &d.requestID,
+				&d.event.ID, &d.event.Type, &d.event.OrganizationID, &d.event.UserID, &d.event.Actor, &d.event.OccurredAt, &data)
+			if err != nil {
+				return err
+			}
+			d.event.OccurredAt = d.event.OccurredAt.UTC()
+			d.event.Data = data
+			deliveries = append(deliveries, d)
+		}
+		return rows.Err()
+	})
+	return deliveries, err
+}
+
+// sendDelivery POSTs the event to the webhook and records the outcome. Any
+// response other than 2xx is a failure, retried with exponential backoff
+// until the delivery has used cfg.MaxAttempts, when it is marked dead.
+func sendDelivery(ctx context.Context, cfg config.WebhooksConfig, client *http.Client, delivery claimedDelivery) {
+	body, err := json.Marshal(delivery.event)
+	if err != nil {
+		failDelivery(cfg, delivery, 0, fmt.Sprintf("error encoding event: %v", err))
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.url, bytes.NewReader(body))
+	if err != nil {
+		failDelivery(cfg, delivery, 0, fmt.Sprintf("error creating request: %v", err))
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.event.Type)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.id, 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(delivery.secret, timestamp, body))
+	if delivery.requestID != "" {
+		req.Header.Set(middleware.RequestIDHeader, delivery.requestID)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			releaseDelivery(delivery.id)
+			return
+		}
+		failDelivery(cfg, delivery, 0, err.Error())
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseDrain))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		failDelivery(cfg, delivery, resp.StatusCode, fmt.Sprintf("unexpected response status %s", resp.Status))
+		return
+	}
+	updateDelivery(delivery.id, `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', response_status = $2, error = NULL, locked_until = NULL, delivered_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`,
+		resp.StatusCode)
+}
+
+// SignWebhook returns the X-Webhook-Signature of body sent at timestamp:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>". A
+// receiver computes the same with its copy of the secret to verify a request.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// failDelivery schedules the next attempt of a delivery after a backoff, or
+// marks it dead once it has used all its attempts.
+func failDelivery(cfg config.WebhooksConfig, delivery claimedDelivery, responseStatus int, message string) {
+	if len(message) > maxErrorLength {
+		message = message[:maxErrorLength]
+	}
+	if delivery.attempts >= cfg.MaxAttempts {
+		logger.Warning("Webhook delivery %d is dead after %d attempts: %s", delivery.id, delivery.attempts, message)
+		updateDelivery(delivery.id, `
+			UPDATE webhook_deliveries
+			SET status = 'dead', response_status = NULLIF($2, 0), error = $3, locked_until = NULL, updated_at = NOW()
+			WHERE id = $1 AND status = 'pending'`,
+			responseStatus, message)
+		return
+	}
+
+	backoff := cfg.RetryBackoff << (delivery.attempts - 1)
+	if backoff > cfg.RetryMaxBackoff || backoff <= 0 {
+		backoff = cfg.RetryMaxBackoff
+	}
+	logger.Info("Retrying webhook delivery %d in %s: %s", delivery.id, backoff, message)
+	updateDelivery(delivery.id, `
+		UPDATE webhook_deliveries
+		SET response_status = NULLIF($2, 0), error = $3, next_attempt_at = NOW() + make_interval(secs => $4), locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`,
+		responseStatus, message, backoff.Seconds())
+}
+
+// releaseDelivery hands back a delivery interrupted by shutdown without
+// counting the attempt.
+func releaseDelivery(deliveryID int64) {
+	updateDelivery(deliveryID, `
+		UPDATE webhook_deliveries
+		SET attempts = attempts - 1, locked_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`)
+}
+
+// updateDelivery runs query with the delivery ID as $1, followed by args. Like
+// updateJob, it outlives the dispatcher's context.
+func updateDelivery(deliveryID int64, query string, args ...interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+	err := withSystemScope(ctx, func(ctx context.Context) error {
+		_, err := database.From(ctx).ExecContext(ctx, query, append([]interface{}{deliveryID}, args...)...)
+		return err
+	})
+	if err != nil {
+		// The lease expires and the delivery is sent again.
+		logger.Error("Error updating webhook delivery %d: %v", deliveryID, err)
+	}
+}
@@ -0,0 +1,57 @@
+package jobs
+
+import "testing"
+
+// The expected signatures were computed with
+// printf '%s' '<timestamp>.<body>' | openssl dgst -sha256 -hmac '<secret>'.
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{
+			name:      "event",
+			secret:    "whsec_test",
+			timestamp: "1700000000",
+			body:      `{"type":"task.started"}`,
+			want:      "sha256=432fc235bea7c03f5c5481fe66f3f70e18f501d6d4dab5b077359b9d4efc39ed",
+		},
+		{
+			name:      "empty body",
+			secret:    "whsec_test",
+			timestamp: "1700000000",
+			want:      "sha256=5967f3c560522fa40cf2876ebc3c3a08551dd6959aaade3b413460591895bdcc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhook(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSignWebhookCoversEveryPart checks that changing the secret, the
+// timestamp or the body changes the signature, so that a receiver can rely on
+// each of them.
+func TestSignWebhookCoversEveryPart(t *testing.T) {
+	body := []byte(`{"type":"task.started"}`)
+	longer := append([]byte("1"), body...)
+	base := SignWebhook("whsec_test", "1700000000", longer)
+	others := map[string]string{
+		"secret":    SignWebhook("whsec_other", "1700000000", longer),
+		"timestamp": SignWebhook("whsec_test", "1700000001", longer),
+		"body":      SignWebhook("whsec_test", "1700000000", body),
+		// Without the "." these two would sign the same bytes.
+		"separator": SignWebhook("whsec_test", "17000000001", body),
+	}
+	for part, sig := range others {
+		if sig == base {
+			t.Errorf("changing the %s keeps the signature %s", part, sig)
+		}
+	}
+}
@@ -3,6 +3,16 @@ package logger
 import (
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
+	"test-project/config"
+)
+
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelWarning
+	levelError
 )
 
 var (
@@ -10,13 +20,35 @@ var (
 	warningLogger = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime)
 	errorLogger   = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime)
 	fatalLogger   = log.New(os.Stderr, "FATAL: ", log.Ldate|log.Ltime)
+
+	minLevel atomic.Int32
 )
 
+// Init applies the logging configuration.
+func Init(cfg config.LogConfig) {
+	switch strings.ToLower(cfg.Level) {
+	case "info":
+		minLevel.Store(levelInfo)
+	case "warning":
+		minLevel.Store(levelWarning)
+	case "error":
+		minLevel.Store(levelError)
+	default:
+		minLevel.Store(levelDebug)
+	}
+}
+
 func Info(format string, v ...interface{}) {
+	if minLevel.Load() > levelInfo {
+		return
+	}
 	infoLogger.Printf(format, v...)
 }
 
 func Warning(format string, v ...interface{}) {
+	if minLevel.Load() > levelWarning {
+		return
+	}
 	warningLogger.Printf(format, v...)
 }
 
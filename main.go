@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"github.com/joho/godotenv"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"log"
-	"net/http"
 	"os"
+	"sync"
+	"test-project/broker"
+	"test-project/config"
+	"test-project/controllers"
 	"test-project/database"
 	_ "test-project/docs" // Подключаем пакет с автосгенерированными Swagger документами
+	"test-project/jobs"
+	"test-project/logger"
 	"test-project/routers"
+	"test-project/server"
 )
 
 // @title Test Project API
@@ -20,23 +26,52 @@ import (
 // @BasePath /
 
 func main() {
-	err := godotenv.Load()
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatal(err)
 	}
-	apiHost := os.Getenv("API_HOST")
-	apiPort := os.Getenv("API_PORT")
+	logger.Init(cfg.Log)
+	logger.Info("Starting with profile %s", cfg.Profile)
 
-	database.InitDB()
-	router := routers.InitRouter()
+	database.InitDB(cfg.Database)
+	defer database.Close()
 
-	swaggerURL := fmt.Sprintf("http://%s:%s/swagger/doc.json")
+	router := routers.InitRouter(cfg)
+
+	swaggerURL := fmt.Sprintf("http://%s/swagger/doc.json", cfg.Server.Address())
 
 	router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL(swaggerURL), // Путь к вашему swagger.json файлу
 	))
 
-	serverAddress := fmt.Sprintf("%s:%s", apiHost, apiPort)
+	ctx, stopJobs := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	for _, run := range []func(){
+		func() { jobs.RunPurge(ctx, cfg.Retention) },
+		func() { jobs.RunAutoStop(ctx, cfg.AutoStop) },
+		func() { broker.Run(ctx, cfg.Database) },
+		func() { jobs.RunWorkers(ctx, cfg.Jobs) },
+		func() { jobs.RunWebhooks(ctx, cfg.Webhooks) },
+	} {
+		background.Add(1)
+		go func(run func()) {
+			defer background.Done()
+			run()
+		}(run)
+	}
+
+	onShutdown := func() {
+		controllers.SetShuttingDown()
+		stopJobs()
+	}
 
-	log.Fatal(http.ListenAndServe(serverAddress, router))
+	err = server.Run(cfg.Server, router, onShutdown)
+	// Let the scheduled jobs, workers, webhook deliveries and the broker finish
+	// what they are doing before the database is closed.
+	stopJobs()
+	background.Wait()
+	if err != nil {
+		database.Close()
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"test-project/config"
+)
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "requestID"
+	actorKey     contextKey = "actor"
+	adminKey     contextKey = "admin"
+
+	// RequestIDHeader carries the request ID in both directions.
+	RequestIDHeader = "X-Request-ID"
+	// ActorHeader lets a caller holding the admin token, such as a front end
+	// that signs people in itself, name the person it acts for.
+	ActorHeader = "X-Actor"
+
+	// ActorAdmin is recorded for requests authenticated with the admin token.
+	ActorAdmin = "admin"
+	// ActorAnonymous is recorded when the caller presents no credentials.
+	ActorAnonymous = "anonymous"
+	// ActorSystem is recorded for changes made by background jobs.
+	ActorSystem = "system"
+)
+
+// RequestID propagates the caller's X-Request-ID or generates a new one,
+// stores it in the request context and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// Actor resolves who is making the request and stores it in the request
+// context. Only the admin may name someone else with ActorHeader; requests
+// with an organization token are attributed to that organization by Tenant.
+func Actor(cfg config.AuthConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor := ActorAnonymous
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			admin := cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1
+			if admin {
+				actor = ActorAdmin
+				if name := r.Header.Get(ActorHeader); name != "" && len(name) <= 255 && name != ActorSystem {
+					actor = name
+				}
+			}
+			ctx := context.WithValue(r.Context(), actorKey, actor)
+			ctx = context.WithValue(ctx, adminKey, admin)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext returns the request ID, or an empty string outside a request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ActorFromContext returns the actor, or ActorSystem outside a request.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok {
+		return actor
+	}
+	return ActorSystem
+}
+
+// WithActor returns a copy of ctx acting as actor, for background jobs that
+// run on behalf of the caller who enqueued them.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// IsAdmin reports whether the request was authenticated with the admin token.
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey).(bool)
+	return admin
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"test-project/config"
+	"testing"
+)
+
+func TestActor(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		header    string
+		want      string
+		wantAdmin bool
+	}{
+		{name: "anonymous", want: ActorAnonymous},
+		{name: "anonymous naming someone", header: "alice", want: ActorAnonymous},
+		{name: "other token naming someone", token: "acme-token", header: "alice", want: ActorAnonymous},
+		{name: "admin", token: "admin-token", want: ActorAdmin, wantAdmin: true},
+		{name: "admin naming someone", token: "admin-token", header: "alice", want: "alice", wantAdmin: true},
+		{name: "admin naming the system", token: "admin-token", header: ActorSystem, want: ActorAdmin, wantAdmin: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotActor string
+			var gotAdmin bool
+			handler := Actor(config.AuthConfig{AdminToken: "admin-token"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotActor = ActorFromContext(r.Context())
+				gotAdmin = IsAdmin(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/users", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.header != "" {
+				req.Header.Set(ActorHeader, tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotActor != tt.want || gotAdmin != tt.wantAdmin {
+				t.Errorf("actor %q, admin %v, want %q, %v", gotActor, gotAdmin, tt.want, tt.wantAdmin)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"test-project/config"
+	"test-project/database"
+	"test-project/logger"
+)
+
+const (
+	organizationKey contextKey = "organization"
+
+	// OrganizationHeader lets the admin pick an organization by slug.
+	OrganizationHeader = "X-Organization"
+)
+
+// TenantResolver looks up organizations for the Tenant middleware. Both
+// methods return 0 when no organization matches.
+type TenantResolver interface {
+	OrganizationBySlug(ctx context.Context, slug string) (int, error)
+	OrganizationByToken(ctx context.Context, token string) (int, error)
+}
+
+// Tenant resolves the organization a request belongs to and stores it in the
+// request context. An organization API token identifies its organization, and
+// a token that matches none is rejected. The admin names an organization with
+// the X-Organization header or the subdomain of cfg.BaseDomain. For anyone
+// else the subdomain only has to agree with the token; it never grants access
+// on its own. Requests without an Authorization header fall back to
+// cfg.DefaultOrganization unless cfg.Required is set. It must run after Actor.
+func Tenant(cfg config.TenancyConfig, resolver TenantResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			admin := IsAdmin(ctx)
+			authorization := r.Header.Get("Authorization")
+			orgID := 0
+
+			if authorization != "" && !admin {
+				id, err := resolver.OrganizationByToken(ctx, strings.TrimPrefix(authorization, "Bearer "))
+				if err != nil {
+					logger.Error("Error resolving organization token: %v", err)
+					http.Error(w, "Error resolving organization", http.StatusInternalServerError)
+					return
+				}
+				if id == 0 {
+					http.Error(w, "Invalid or revoked token", http.StatusUnauthorized)
+					return
+				}
+				orgID = id
+				ctx = WithActor(ctx, OrganizationActor(id))
+			}
+
+			slugs := make([]string, 0, 2)
+			if slug := subdomain(r.Host, cfg.BaseDomain); slug != "" {
+				if orgID == 0 && !admin {
+					http.Error(w, "Organization token required", http.StatusUnauthorized)
+					return
+				}
+				slugs = append(slugs, slug)
+			}
+			if slug := strings.ToLower(r.Header.Get(OrganizationHeader)); slug != "" {
+				if !admin {
+					http.Error(w, "Only the admin may choose an organization", http.StatusForbidden)
+					return
+				}
+				slugs = append(slugs, slug)
+			}
+			for _, slug := range slugs {
+				id, err := resolver.OrganizationBySlug(ctx, slug)
+				if err != nil {
+					logger.Error("Error resolving organization %q: %v", slug, err)
+					http.Error(w, "Error resolving organization", http.StatusInternalServerError)
+					return
+				}
+				if id == 0 {
+					http.Error(w, "Organization not found", http.StatusNotFound)
+					return
+				}
+				if orgID != 0 && orgID != id {
+					http.Error(w, "Credentials do not belong to this organization", http.StatusForbidden)
+					return
+				}
+				orgID = id
+			}
+
+			if orgID == 0 {
+				if cfg.Required || cfg.DefaultOrganization == "" || authorization != "" {
+					http.Error(w, "Organization required", http.StatusUnauthorized)
+					return
+				}
+				id, err := resolver.OrganizationBySlug(ctx, cfg.DefaultOrganization)
+				if err != nil || id == 0 {
+					logger.Error("Error resolving default organization %q: %v", cfg.DefaultOrganization, err)
+					http.Error(w, "Error resolving organization", http.StatusInternalServerError)
+					return
+				}
+				orgID = id
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, organizationKey, orgID)))
+		})
+	}
+}
+
+// ScopeDB runs the rest of the request on a dedicated database connection
+// scoped to the request's organization, so that the row-level security
+// policies hide other organizations' rows even from a query that forgets to
+// filter them. It must run after Tenant.
+func ScopeDB(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID := OrganizationFromContext(r.Context())
+		err := database.WithScope(r.Context(), strconv.Itoa(orgID), func(ctx context.Context) error {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return nil
+		})
+		if err != nil {
+			logger.Error("Error scoping database connection: %v", err)
+			http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// OrganizationFromContext returns the organization of the request, or 0
+// outside a request.
+func OrganizationFromContext(ctx context.Context) int {
+	id, _ := ctx.Value(organizationKey).(int)
+	return id
+}
+
+// OrganizationActor is the actor recorded for requests made with the API
+// token of organization orgID.
+func OrganizationActor(orgID int) string {
+	return "organization:" + strconv.Itoa(orgID)
+}
+
+// WithOrganization returns a copy of ctx scoped to the organization, for
+// background jobs that act on behalf of one.
+func WithOrganization(ctx context.Context, orgID int) context.Context {
+	return context.WithValue(ctx, organizationKey, orgID)
+}
+
+// subdomain returns the single label in front of base in host, or an empty
+// string when host is not a subdomain of base.
+func subdomain(host, base string) string {
+	if base == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	label := strings.TrimSuffix(host, "."+strings.ToLower(base))
+	if label == host || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
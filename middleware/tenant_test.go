@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"test-project/config"
+	"testing"
+)
+
+// fakeResolver knows the organizations acme (1, token acme-token), globex
+// (2, token globex-token) and default (3).
+type fakeResolver struct{}
+
+func (fakeResolver) OrganizationBySlug(ctx context.Context, slug string) (int, error) {
+	return map[string]int{"acme": 1, "globex": 2, "default": 3}[slug], nil
+}
+
+func (fakeResolver) OrganizationByToken(ctx context.Context, token string) (int, error) {
+	return map[string]int{"acme-token": 1, "globex-token": 2}[token], nil
+}
+
+func TestTenant(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		host     string
+		token    string
+		header   string
+		want     int
+		wantOrg  int
+	}{
+		{name: "token", token: "acme-token", want: http.StatusOK, wantOrg: 1},
+		{name: "token on its subdomain", host: "acme.tracker.test", token: "acme-token", want: http.StatusOK, wantOrg: 1},
+		{name: "token on another subdomain", host: "globex.tracker.test", token: "acme-token", want: http.StatusForbidden},
+		{name: "unknown token", token: "revoked", want: http.StatusUnauthorized},
+		{name: "unknown token with subdomain", host: "acme.tracker.test", token: "revoked", want: http.StatusUnauthorized},
+		{name: "subdomain without token", host: "acme.tracker.test", want: http.StatusUnauthorized},
+		{name: "token choosing an organization", token: "acme-token", header: "globex", want: http.StatusForbidden},
+		{name: "anonymous", want: http.StatusOK, wantOrg: 3},
+		{name: "anonymous when required", required: true, want: http.StatusUnauthorized},
+		{name: "admin with header", token: "admin-token", header: "globex", want: http.StatusOK, wantOrg: 2},
+		{name: "admin with subdomain", host: "globex.tracker.test", token: "admin-token", want: http.StatusOK, wantOrg: 2},
+		{name: "admin with conflicting header", host: "acme.tracker.test", token: "admin-token", header: "globex", want: http.StatusForbidden},
+		{name: "admin without organization", token: "admin-token", want: http.StatusUnauthorized},
+		{name: "admin with unknown organization", token: "admin-token", header: "initech", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.TenancyConfig{BaseDomain: "tracker.test", DefaultOrganization: "default", Required: tt.required}
+			var gotOrg int
+			handler := Actor(config.AuthConfig{AdminToken: "admin-token"})(Tenant(cfg, fakeResolver{})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotOrg = OrganizationFromContext(r.Context())
+				})))
+
+			req := httptest.NewRequest("GET", "/users", nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.header != "" {
+				req.Header.Set(OrganizationHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if gotOrg != tt.wantOrg {
+				t.Errorf("organization %d, want %d", gotOrg, tt.wantOrg)
+			}
+		})
+	}
+}
+
+func TestTenantAttributesTokenToOrganization(t *testing.T) {
+	var got string
+	handler := Actor(config.AuthConfig{AdminToken: "admin-token"})(Tenant(config.TenancyConfig{}, fakeResolver{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = ActorFromContext(r.Context())
+		})))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer globex-token")
+	req.Header.Set(ActorHeader, "alice")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if want := OrganizationActor(2); got != want {
+		t.Errorf("actor %q, want %q", got, want)
+	}
+}
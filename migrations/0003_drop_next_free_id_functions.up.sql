@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS get_next_free_user_id();
+DROP FUNCTION IF EXISTS get_next_free_task_id();
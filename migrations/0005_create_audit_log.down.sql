@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_log_user;
+DROP INDEX IF EXISTS idx_audit_log_entity;
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    entity VARCHAR(32) NOT NULL,
+    entity_id BIGINT NOT NULL,
+    user_id BIGINT,
+    action VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(64),
+    before JSONB,
+    after JSONB,
+    diff JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity, entity_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log (user_id, id);
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS timezone;
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS max_task_minutes;
+ALTER TABLE IF EXISTS tasks DROP COLUMN IF EXISTS auto_stopped;
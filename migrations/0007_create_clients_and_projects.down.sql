@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS tasks DROP COLUMN IF EXISTS project_id;
+DROP TABLE IF EXISTS project_members;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS clients;
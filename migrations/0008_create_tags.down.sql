@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS tasks DROP COLUMN IF EXISTS notes;
+DROP TABLE IF EXISTS task_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS tasks DROP COLUMN IF EXISTS billable;
+DROP TABLE IF EXISTS rates;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS rates (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    currency CHAR(3) NOT NULL,
+    effective_from TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (user_id IS NOT NULL OR project_id IS NOT NULL)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rates_scope_effective ON rates (COALESCE(user_id, 0), COALESCE(project_id, 0), effective_from);
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS billable BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS tasks DROP COLUMN IF EXISTS invoice_id;
+DROP TABLE IF EXISTS invoice_lines;
+DROP TABLE IF EXISTS invoices;
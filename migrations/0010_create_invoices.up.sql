@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS invoices (
+    id SERIAL PRIMARY KEY,
+    client_id INTEGER NOT NULL REFERENCES clients(id),
+    status VARCHAR(10) NOT NULL DEFAULT 'issued' CHECK (status IN ('issued', 'void')),
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    group_by VARCHAR(10) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    total BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    voided_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    id SERIAL PRIMARY KEY,
+    invoice_id INTEGER NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+    project_id INTEGER,
+    task_id INTEGER,
+    description VARCHAR(200) NOT NULL,
+    tasks INTEGER NOT NULL,
+    minutes INTEGER NOT NULL,
+    amount BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_invoice_lines_invoice_id ON invoice_lines (invoice_id);
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS invoice_id INTEGER REFERENCES invoices(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_tasks_invoice_id ON tasks (invoice_id);
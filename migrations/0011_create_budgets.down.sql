@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS budget_alerts;
+DROP TABLE IF EXISTS user_weekly_limits;
+DROP TABLE IF EXISTS project_budgets;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS project_budgets (
+    project_id INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    minutes INTEGER CHECK (minutes > 0),
+    amount BIGINT CHECK (amount > 0),
+    currency CHAR(3),
+    hard BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (amount IS NULL OR currency IS NOT NULL)
+);
+CREATE TABLE IF NOT EXISTS user_weekly_limits (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    minutes INTEGER NOT NULL CHECK (minutes > 0),
+    hard BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(10) NOT NULL,
+    scope_id INTEGER NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    threshold INTEGER NOT NULL,
+    period_start DATE NOT NULL,
+    budget BIGINT NOT NULL,
+    consumed BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (scope, scope_id, kind, threshold, period_start, budget)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS timesheet_comments;
+DROP TABLE IF EXISTS timesheets;
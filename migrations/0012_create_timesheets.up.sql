@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS timesheets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    week_start DATE NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('draft', 'submitted', 'approved', 'rejected')),
+    submitted_at TIMESTAMPTZ,
+    decided_at TIMESTAMPTZ,
+    decided_by VARCHAR(100),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, week_start)
+);
+CREATE INDEX IF NOT EXISTS idx_timesheets_status ON timesheets (status, submitted_at);
+CREATE TABLE IF NOT EXISTS timesheet_comments (
+    id SERIAL PRIMARY KEY,
+    timesheet_id INTEGER NOT NULL REFERENCES timesheets(id) ON DELETE CASCADE,
+    author VARCHAR(100) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_log_organization;
+ALTER TABLE IF EXISTS audit_log DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
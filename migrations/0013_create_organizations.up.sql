@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+INSERT INTO organizations (slug, name) VALUES ('default', 'Default') ON CONFLICT (slug) DO NOTHING;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS organization_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_audit_log_organization ON audit_log (organization_id, entity, entity_id);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
+ALTER TABLE IF EXISTS budget_alerts DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE IF EXISTS tags DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE IF EXISTS projects DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE IF EXISTS clients DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS organization_id;
@@ -0,0 +1,24 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_organization_passport ON users (organization_id, passport_number);
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS organization_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id);
+CREATE INDEX IF NOT EXISTS idx_clients_organization ON clients (organization_id);
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS organization_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id);
+CREATE INDEX IF NOT EXISTS idx_projects_organization ON projects (organization_id);
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS organization_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id);
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_organization_name ON tags (organization_id, name);
+ALTER TABLE budget_alerts ADD COLUMN IF NOT EXISTS organization_id INTEGER NOT NULL DEFAULT 1;
+CREATE TABLE IF NOT EXISTS teams (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id),
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (organization_id, name)
+);
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (team_id, user_id)
+);
@@ -0,0 +1,55 @@
+DROP POLICY IF EXISTS tenant_isolation ON timesheet_comments;
+ALTER TABLE IF EXISTS timesheet_comments NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS timesheet_comments DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timesheets;
+ALTER TABLE IF EXISTS timesheets NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS timesheets DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON invoice_lines;
+ALTER TABLE IF EXISTS invoice_lines NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS invoice_lines DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON invoices;
+ALTER TABLE IF EXISTS invoices NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS invoices DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON user_weekly_limits;
+ALTER TABLE IF EXISTS user_weekly_limits NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS user_weekly_limits DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON project_budgets;
+ALTER TABLE IF EXISTS project_budgets NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS project_budgets DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON rates;
+ALTER TABLE IF EXISTS rates NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS rates DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON team_members;
+ALTER TABLE IF EXISTS team_members NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS team_members DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON task_tags;
+ALTER TABLE IF EXISTS task_tags NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS task_tags DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON project_members;
+ALTER TABLE IF EXISTS project_members NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS project_members DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tasks;
+ALTER TABLE IF EXISTS tasks NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS tasks DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON audit_log;
+ALTER TABLE IF EXISTS audit_log NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS audit_log DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON budget_alerts;
+ALTER TABLE IF EXISTS budget_alerts NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS budget_alerts DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON teams;
+ALTER TABLE IF EXISTS teams NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS teams DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tags;
+ALTER TABLE IF EXISTS tags NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS tags DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON projects;
+ALTER TABLE IF EXISTS projects NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS projects DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON clients;
+ALTER TABLE IF EXISTS clients NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS clients DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON users;
+ALTER TABLE IF EXISTS users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE IF EXISTS users DISABLE ROW LEVEL SECURITY;
+DROP FUNCTION IF EXISTS app_org_visible(INTEGER);
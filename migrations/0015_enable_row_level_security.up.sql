@@ -0,0 +1,80 @@
+CREATE OR REPLACE FUNCTION app_org_visible(org INTEGER) RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+    SELECT CASE current_setting('app.current_org', true)
+        WHEN 'system' THEN TRUE
+        WHEN '' THEN FALSE
+        ELSE org = current_setting('app.current_org', true)::INTEGER
+    END
+$$;
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON users;
+CREATE POLICY tenant_isolation ON users USING (app_org_visible(organization_id));
+ALTER TABLE clients ENABLE ROW LEVEL SECURITY;
+ALTER TABLE clients FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON clients;
+CREATE POLICY tenant_isolation ON clients USING (app_org_visible(organization_id));
+ALTER TABLE projects ENABLE ROW LEVEL SECURITY;
+ALTER TABLE projects FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON projects;
+CREATE POLICY tenant_isolation ON projects USING (app_org_visible(organization_id));
+ALTER TABLE tags ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tags FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tags;
+CREATE POLICY tenant_isolation ON tags USING (app_org_visible(organization_id));
+ALTER TABLE teams ENABLE ROW LEVEL SECURITY;
+ALTER TABLE teams FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON teams;
+CREATE POLICY tenant_isolation ON teams USING (app_org_visible(organization_id));
+ALTER TABLE budget_alerts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE budget_alerts FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON budget_alerts;
+CREATE POLICY tenant_isolation ON budget_alerts USING (app_org_visible(organization_id));
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_log FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON audit_log;
+CREATE POLICY tenant_isolation ON audit_log USING (app_org_visible(organization_id));
+ALTER TABLE tasks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tasks FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tasks;
+CREATE POLICY tenant_isolation ON tasks USING (EXISTS (SELECT 1 FROM users u WHERE u.id = tasks.user_id));
+ALTER TABLE project_members ENABLE ROW LEVEL SECURITY;
+ALTER TABLE project_members FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON project_members;
+CREATE POLICY tenant_isolation ON project_members USING (EXISTS (SELECT 1 FROM projects p WHERE p.id = project_members.project_id));
+ALTER TABLE task_tags ENABLE ROW LEVEL SECURITY;
+ALTER TABLE task_tags FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON task_tags;
+CREATE POLICY tenant_isolation ON task_tags USING (EXISTS (SELECT 1 FROM tasks t WHERE t.id = task_tags.task_id));
+ALTER TABLE team_members ENABLE ROW LEVEL SECURITY;
+ALTER TABLE team_members FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON team_members;
+CREATE POLICY tenant_isolation ON team_members USING (EXISTS (SELECT 1 FROM teams t WHERE t.id = team_members.team_id));
+ALTER TABLE rates ENABLE ROW LEVEL SECURITY;
+ALTER TABLE rates FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON rates;
+CREATE POLICY tenant_isolation ON rates USING (EXISTS (SELECT 1 FROM users u WHERE u.id = rates.user_id) OR EXISTS (SELECT 1 FROM projects p WHERE p.id = rates.project_id));
+ALTER TABLE project_budgets ENABLE ROW LEVEL SECURITY;
+ALTER TABLE project_budgets FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON project_budgets;
+CREATE POLICY tenant_isolation ON project_budgets USING (EXISTS (SELECT 1 FROM projects p WHERE p.id = project_budgets.project_id));
+ALTER TABLE user_weekly_limits ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_weekly_limits FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON user_weekly_limits;
+CREATE POLICY tenant_isolation ON user_weekly_limits USING (EXISTS (SELECT 1 FROM users u WHERE u.id = user_weekly_limits.user_id));
+ALTER TABLE invoices ENABLE ROW LEVEL SECURITY;
+ALTER TABLE invoices FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON invoices;
+CREATE POLICY tenant_isolation ON invoices USING (EXISTS (SELECT 1 FROM clients c WHERE c.id = invoices.client_id));
+ALTER TABLE invoice_lines ENABLE ROW LEVEL SECURITY;
+ALTER TABLE invoice_lines FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON invoice_lines;
+CREATE POLICY tenant_isolation ON invoice_lines USING (EXISTS (SELECT 1 FROM invoices i WHERE i.id = invoice_lines.invoice_id));
+ALTER TABLE timesheets ENABLE ROW LEVEL SECURITY;
+ALTER TABLE timesheets FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timesheets;
+CREATE POLICY tenant_isolation ON timesheets USING (EXISTS (SELECT 1 FROM users u WHERE u.id = timesheets.user_id));
+ALTER TABLE timesheet_comments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE timesheet_comments FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timesheet_comments;
+CREATE POLICY tenant_isolation ON timesheet_comments USING (EXISTS (SELECT 1 FROM timesheets t WHERE t.id = timesheet_comments.timesheet_id));
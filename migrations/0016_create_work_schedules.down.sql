@@ -0,0 +1,5 @@
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS custom_working_hours;
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS holiday_calendar_id;
+DROP TABLE IF EXISTS working_hours;
+DROP TABLE IF EXISTS holidays;
+DROP TABLE IF EXISTS holiday_calendars;
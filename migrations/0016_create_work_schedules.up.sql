@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS holiday_calendars (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id),
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (organization_id, name)
+);
+CREATE TABLE IF NOT EXISTS holidays (
+    calendar_id INTEGER NOT NULL REFERENCES holiday_calendars(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    PRIMARY KEY (calendar_id, day)
+);
+CREATE TABLE IF NOT EXISTS working_hours (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 1 AND 7),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL CHECK (end_time > start_time),
+    PRIMARY KEY (user_id, weekday)
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS holiday_calendar_id INTEGER REFERENCES holiday_calendars(id) ON DELETE SET NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS custom_working_hours BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE holiday_calendars ENABLE ROW LEVEL SECURITY;
+ALTER TABLE holiday_calendars FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON holiday_calendars;
+CREATE POLICY tenant_isolation ON holiday_calendars USING (app_org_visible(organization_id));
+ALTER TABLE holidays ENABLE ROW LEVEL SECURITY;
+ALTER TABLE holidays FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON holidays;
+CREATE POLICY tenant_isolation ON holidays USING (EXISTS (SELECT 1 FROM holiday_calendars c WHERE c.id = holidays.calendar_id));
+ALTER TABLE working_hours ENABLE ROW LEVEL SECURITY;
+ALTER TABLE working_hours FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON working_hours;
+CREATE POLICY tenant_isolation ON working_hours USING (EXISTS (SELECT 1 FROM users u WHERE u.id = working_hours.user_id));
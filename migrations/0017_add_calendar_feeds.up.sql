@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS feed_token_hash CHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_feed_token ON users (feed_token_hash);
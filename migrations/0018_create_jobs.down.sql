@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS job_result_chunks;
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    kind VARCHAR(64) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+    query TEXT NOT NULL DEFAULT '',
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    payload BYTEA,
+    actor VARCHAR(255) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_by VARCHAR(128),
+    locked_until TIMESTAMPTZ,
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    progress_done BIGINT NOT NULL DEFAULT 0,
+    progress_total BIGINT,
+    error TEXT,
+    result_status INTEGER,
+    result_content_type VARCHAR(255),
+    result_disposition VARCHAR(255),
+    result_size BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_runnable ON jobs (run_at, id) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_lease ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_jobs_organization ON jobs (organization_id, id);
+CREATE TABLE IF NOT EXISTS job_result_chunks (
+    job_id BIGINT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    PRIMARY KEY (job_id, seq)
+);
+ALTER TABLE jobs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE jobs FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON jobs;
+CREATE POLICY tenant_isolation ON jobs USING (app_org_visible(organization_id));
+ALTER TABLE job_result_chunks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE job_result_chunks FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON job_result_chunks;
+CREATE POLICY tenant_isolation ON job_result_chunks USING (EXISTS (SELECT 1 FROM jobs j WHERE j.id = job_result_chunks.job_id));
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS id_high_water (
+    table_name VARCHAR(63) PRIMARY KEY,
+    last_id BIGINT NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_team_members_manager;
+ALTER TABLE IF EXISTS team_members DROP COLUMN IF EXISTS manager;
@@ -0,0 +1,2 @@
+ALTER TABLE team_members ADD COLUMN IF NOT EXISTS manager BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_team_members_manager ON team_members (user_id) WHERE manager;
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// ProjectBudget caps a project's total tracked time, its billable cost, or
+// both. When Hard is set, new timers cannot be started on an exhausted project.
+type ProjectBudget struct {
+	ProjectID        int    `json:"projectId"`
+	Minutes          *int   `json:"minutes,omitempty"`
+	Amount           *int64 `json:"amount,omitempty"`
+	Currency         string `json:"currency,omitempty"`
+	Hard             bool   `json:"hard"`
+	ConsumedMinutes  int    `json:"consumedMinutes"`
+	RemainingMinutes *int   `json:"remainingMinutes,omitempty"`
+	ConsumedAmount   int64  `json:"consumedAmount"`
+	RemainingAmount  *int64 `json:"remainingAmount,omitempty"`
+}
+
+// UserWeeklyLimit caps the time a user tracks in a week, Monday to Sunday in
+// the user's timezone.
+type UserWeeklyLimit struct {
+	UserID           int       `json:"userId"`
+	Minutes          *int      `json:"minutes,omitempty"`
+	Hard             bool      `json:"hard"`
+	WeekStart        time.Time `json:"weekStart"`
+	ConsumedMinutes  int       `json:"consumedMinutes"`
+	RemainingMinutes *int      `json:"remainingMinutes,omitempty"`
+}
+
+// BudgetAlert records that a budget crossed a percentage threshold. Each
+// threshold fires once per budget value and period.
+type BudgetAlert struct {
+	ID          int       `json:"id"`
+	Scope       string    `json:"scope"`
+	ScopeID     int       `json:"scopeId"`
+	Kind        string    `json:"kind"`
+	Threshold   int       `json:"threshold"`
+	PeriodStart time.Time `json:"periodStart"`
+	Budget      int64     `json:"budget"`
+	Consumed    int64     `json:"consumed"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// CalendarFeed is a user's secret iCalendar subscription. The token is only
+// returned when it is created; the server keeps just its hash.
+type CalendarFeed struct {
+	UserID int    `json:"userId"`
+	Token  string `json:"token"`
+	URL    string `json:"url"`
+}
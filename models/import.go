@@ -0,0 +1,19 @@
+package models
+
+// UserImport is the outcome of a bulk user import. In a dry run nothing is
+// written and Imported is 0.
+type UserImport struct {
+	DryRun   bool             `json:"dryRun"`
+	Rows     int              `json:"rows"`
+	Valid    int              `json:"valid"`
+	Imported int              `json:"imported"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// ImportRowError is why one row of an import was rejected. Row is the line
+// or row number in the uploaded file.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	InvoiceIssued = "issued"
+	InvoiceVoid   = "void"
+)
+
+// Invoice bills a client for the uninvoiced billable tasks of a period.
+// Amounts are in minor units of Currency.
+type Invoice struct {
+	ID          int           `json:"id"`
+	Number      string        `json:"number"`
+	ClientID    int           `json:"clientId"`
+	ClientName  string        `json:"clientName"`
+	Status      string        `json:"status"`
+	PeriodStart time.Time     `json:"periodStart"`
+	PeriodEnd   time.Time     `json:"periodEnd"`
+	GroupBy     string        `json:"groupBy"`
+	Currency    string        `json:"currency"`
+	Total       int64         `json:"total"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	VoidedAt    *time.Time    `json:"voidedAt,omitempty"`
+	Lines       []InvoiceLine `json:"lines,omitempty"`
+}
+
+// InvoiceLine is one project or one task of an invoice.
+type InvoiceLine struct {
+	ID          int    `json:"id"`
+	ProjectID   *int   `json:"projectId,omitempty"`
+	TaskID      *int   `json:"taskId,omitempty"`
+	Description string `json:"description"`
+	Tasks       int    `json:"tasks"`
+	Minutes     int    `json:"minutes"`
+	Amount      int64  `json:"amount"`
+}
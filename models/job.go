@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a long-running import, export or report executed in the background.
+// Query holds the parameters of the request it runs. ResultURL is set once a
+// result can be downloaded, which includes the error response of a job that
+// failed on invalid input.
+type Job struct {
+	ID              int64       `json:"id"`
+	Kind            string      `json:"kind"`
+	Status          string      `json:"status"`
+	Query           string      `json:"query,omitempty"`
+	Attempts        int         `json:"attempts"`
+	MaxAttempts     int         `json:"maxAttempts"`
+	Progress        JobProgress `json:"progress"`
+	CancelRequested bool        `json:"cancelRequested,omitempty"`
+	Error           string      `json:"error,omitempty"`
+	ResultURL       string      `json:"resultUrl,omitempty"`
+	ResultSize      *int64      `json:"resultSize,omitempty"`
+	Actor           string      `json:"actor"`
+	RunAt           time.Time   `json:"runAt"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	StartedAt       *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time  `json:"finishedAt,omitempty"`
+}
+
+// JobProgress counts the rows a job has processed. Total is omitted when it
+// is not known in advance, as for exports.
+type JobProgress struct {
+	Done  int64  `json:"done"`
+	Total *int64 `json:"total,omitempty"`
+}
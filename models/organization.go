@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Organization is a tenant. Token is only set in the response that creates or
+// rotates it; the server keeps just its hash.
+type Organization struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Team struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TeamMember is a user's membership of a team. A manager decides on the
+// timesheets of the team's other members.
+type TeamMember struct {
+	TeamID    int       `json:"teamId"`
+	UserID    int       `json:"userId"`
+	Manager   bool      `json:"manager"`
+	CreatedAt time.Time `json:"createdAt"`
+}
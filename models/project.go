@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type Client struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Project struct {
+	ID        int       `json:"id"`
+	ClientID  *int      `json:"clientId,omitempty"`
+	Name      string    `json:"name"`
+	Archived  bool      `json:"archived"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ProjectMember struct {
+	ProjectID int       `json:"projectId"`
+	UserID    int       `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Rate is an hourly rate in minor currency units. A rate applies to a user, a
+// project, or a user on a project, from EffectiveFrom until a later rate for
+// the same scope takes over.
+type Rate struct {
+	ID            int       `json:"id"`
+	UserID        *int      `json:"userId,omitempty"`
+	ProjectID     *int      `json:"projectId,omitempty"`
+	Amount        int64     `json:"amount"`
+	Currency      string    `json:"currency"`
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// TimeReportRow is one group of a time report. Only the fields of the
+// requested grouping are set.
+type TimeReportRow struct {
+	ProjectID    *int   `json:"projectId,omitempty"`
+	ProjectName  string `json:"projectName,omitempty"`
+	ClientID     *int   `json:"clientId,omitempty"`
+	ClientName   string `json:"clientName,omitempty"`
+	Tasks        int    `json:"tasks"`
+	TotalMinutes int    `json:"totalMinutes"`
+	Hours        int    `json:"hours"`
+	Minutes      int    `json:"minutes"`
+}
+
+// CostReportRow is the billable time and cost of one group in one currency.
+// Time without an applicable rate is reported with an empty Currency.
+type CostReportRow struct {
+	UserID          *int   `json:"userId,omitempty"`
+	UserName        string `json:"userName,omitempty"`
+	ProjectID       *int   `json:"projectId,omitempty"`
+	ProjectName     string `json:"projectName,omitempty"`
+	ClientID        *int   `json:"clientId,omitempty"`
+	ClientName      string `json:"clientName,omitempty"`
+	Currency        string `json:"currency"`
+	Tasks           int    `json:"tasks"`
+	TrackedMinutes  int    `json:"trackedMinutes"`
+	BillableMinutes int    `json:"billableMinutes"`
+	Amount          int64  `json:"amount"`
+}
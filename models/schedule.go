@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// WorkingDay is the working time of one weekday, 1 (Monday) to 7 (Sunday),
+// as HH:MM in the user's timezone.
+type WorkingDay struct {
+	Weekday int    `json:"weekday"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// WorkSchedule is a user's weekly working hours and holiday calendar. Users
+// without their own working hours follow the default schedule, Monday to
+// Friday 09:00 to 17:00, and Default is set.
+type WorkSchedule struct {
+	UserID            int          `json:"userId"`
+	Timezone          string       `json:"timezone"`
+	HolidayCalendarID *int         `json:"holidayCalendarId,omitempty"`
+	Default           bool         `json:"default"`
+	Days              []WorkingDay `json:"days"`
+}
+
+// HolidayCalendar is a named set of days off that users can follow.
+type HolidayCalendar struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Holidays  []Holiday `json:"holidays,omitempty"`
+}
+
+// Holiday is a day off. Date is a calendar day, YYYY-MM-DD.
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// HolidayImport is the outcome of importing an iCalendar file. Recurring
+// events are skipped, since holiday feeds list each year's dates.
+type HolidayImport struct {
+	CalendarID int `json:"calendarId"`
+	Imported   int `json:"imported"`
+	Skipped    int `json:"skipped"`
+}
+
+// AttendanceReportRow compares a user's tracked time with their working
+// hours. Overtime and undertime are summed per day, so a long Monday does not
+// cancel a short Tuesday.
+type AttendanceReportRow struct {
+	UserID           int             `json:"userId"`
+	UserName         string          `json:"userName"`
+	Timezone         string          `json:"timezone"`
+	ExpectedMinutes  int             `json:"expectedMinutes"`
+	ActualMinutes    int             `json:"actualMinutes"`
+	OvertimeMinutes  int             `json:"overtimeMinutes"`
+	UndertimeMinutes int             `json:"undertimeMinutes"`
+	Holidays         int             `json:"holidays"`
+	Days             []AttendanceDay `json:"days"`
+}
+
+// AttendanceDay is one calendar day of an attendance report, in the user's
+// timezone.
+type AttendanceDay struct {
+	Date            string `json:"date"`
+	ExpectedMinutes int    `json:"expectedMinutes"`
+	ActualMinutes   int    `json:"actualMinutes"`
+	Holiday         string `json:"holiday,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Tag struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TagSuggestion is a tag from a user's recent tasks with how often it was used.
+type TagSuggestion struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
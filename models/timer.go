@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RunningTimer is a task that has been started and not yet stopped.
+type RunningTimer struct {
+	TaskID         int       `json:"taskId"`
+	UserID         int       `json:"userId"`
+	ProjectID      *int      `json:"projectId,omitempty"`
+	Name           string    `json:"name"`
+	StartTime      time.Time `json:"startTime"`
+	ElapsedSeconds int64     `json:"elapsedSeconds"`
+}
+
+// TimerTick lists the running timers and how long each has run as of At.
+type TimerTick struct {
+	At     time.Time      `json:"at"`
+	Timers []RunningTimer `json:"timers"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+const (
+	TimesheetDraft     = "draft"
+	TimesheetSubmitted = "submitted"
+	TimesheetApproved  = "approved"
+	TimesheetRejected  = "rejected"
+)
+
+// Timesheet is a user's week of tasks, Monday to Sunday in the user's
+// timezone. Weeks that were never submitted are reported as drafts without an ID.
+type Timesheet struct {
+	ID           int                `json:"id,omitempty"`
+	UserID       int                `json:"userId"`
+	WeekStart    string             `json:"weekStart"`
+	Status       string             `json:"status"`
+	TotalMinutes int                `json:"totalMinutes"`
+	Days         []TimesheetDay     `json:"days,omitempty"`
+	Tasks        []Task             `json:"tasks,omitempty"`
+	Comments     []TimesheetComment `json:"comments,omitempty"`
+	SubmittedAt  *time.Time         `json:"submittedAt,omitempty"`
+	DecidedAt    *time.Time         `json:"decidedAt,omitempty"`
+	DecidedBy    string             `json:"decidedBy,omitempty"`
+}
+
+type TimesheetDay struct {
+	Date    string `json:"date"`
+	Minutes int    `json:"minutes"`
+}
+
+type TimesheetComment struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
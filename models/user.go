@@ -3,24 +3,34 @@ package models
 import "time"
 
 type User struct {
-	ID             int       `json:"id"`
-	PassportNumber string    `json:"passport_number"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
-	Surname        string    `json:"surname"`
-	Name           string    `json:"name"`
-	Patronymic     string    `json:"patronymic"`
-	Address        string    `json:"address"`
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organizationId"`
+	PassportNumber string     `json:"passport_number"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	Surname        string     `json:"surname"`
+	Name           string     `json:"name"`
+	Patronymic     string     `json:"patronymic"`
+	Address        string     `json:"address"`
+	Timezone       string     `json:"timezone"`
+	MaxTaskMinutes *int       `json:"maxTaskMinutes,omitempty"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
 }
 
 type Task struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"userId"`
-	Name      string    `json:"name"`
-	Hours     int       `json:"hours"`
-	Minutes   int       `json:"minutes"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	StartTime time.Time `json:"startTime"`
-	EndTime   time.Time `json:"endTime"`
+	ID          int       `json:"id"`
+	UserID      int       `json:"userId"`
+	ProjectID   *int      `json:"projectId,omitempty"`
+	Name        string    `json:"name"`
+	Hours       int       `json:"hours"`
+	Minutes     int       `json:"minutes"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	StartTime   time.Time `json:"startTime"`
+	EndTime     time.Time `json:"endTime"`
+	AutoStopped bool      `json:"autoStopped"`
+	Billable    bool      `json:"billable"`
+	InvoiceID   *int      `json:"invoiceId,omitempty"`
+	Notes       string    `json:"notes,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook receives the domain events of its organization. An empty Events
+// subscribes to every event type. Secret signs each delivery; it is only set
+// in the response that creates or rotates it.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebhookUpdate changes the fields that are set.
+type WebhookUpdate struct {
+	URL    *string   `json:"url"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
+}
+
+// WebhookEvent is the body POSTed to a webhook, and the data of an event on
+// an event stream.
+type WebhookEvent struct {
+	ID             int64           `json:"id"`
+	Type           string          `json:"type"`
+	OrganizationID int             `json:"organizationId"`
+	UserID         int             `json:"userId"`
+	Actor          string          `json:"actor"`
+	OccurredAt     time.Time       `json:"occurredAt"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to one webhook. A
+// delivery that failed every attempt is dead until it is replayed.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int        `json:"webhookId"`
+	EventID        int64      `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	ResponseStatus *int       `json:"responseStatus,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// WebhookReplay reports how many deliveries a replay queued.
+type WebhookReplay struct {
+	Replayed int64 `json:"replayed"`
+}
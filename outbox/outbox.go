@@ -0,0 +1,108 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"test-project/middleware"
+)
+
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+	EventTaskStarted = "task.started"
+	EventTaskStopped = "task.stopped"
+)
+
+// Channel is the Postgres notification channel on which the ID of each
+// published event is sent when its transaction commits. An empty payload
+// stands for several events.
+const Channel = "outbox_events"
+
+// Types lists every event type, in the order they are documented.
+var Types = []string{EventUserCreated, EventUserUpdated, EventUserDeleted, EventTaskStarted, EventTaskStopped}
+
+// Event is a domain event about a user or one of their tasks. Data is the
+// state of the entity after the change, or before it for deletions.
+type Event struct {
+	Type   string
+	UserID int
+	Data   interface{}
+}
+
+// Publish writes event to outbox_events within tx, so the event is only
+// delivered if the change it describes commits, and notifies Channel. The
+// actor, request ID and organization are taken from ctx.
+func Publish(ctx context.Context, tx *sql.Tx, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", event.Type, err)
+	}
+
+	// Background jobs carry no organization, so fall back to the user's.
+	_, err = tx.ExecContext(ctx, `
+		WITH event AS (
+			INSERT INTO outbox_events (organization_id, type, user_id, data, actor, request_id)
+			VALUES (COALESCE(NULLIF($1, 0), (SELECT organization_id FROM users WHERE id = $3)), $2, $3, $4, $5, $6)
+			RETURNING id
+		)
+		SELECT pg_notify($7, id::text) FROM event`,
+		middleware.OrganizationFromContext(ctx), event.Type, event.UserID, string(data), middleware.ActorFromContext(ctx), requestID(ctx), Channel)
+	if err != nil {
+		return fmt.Errorf("error writing %s event: %w", event.Type, err)
+	}
+	return nil
+}
+
+// PublishAll writes events like Publish, but with COPY, for bulk changes. The
+// organization must be set in ctx.
+func PublishAll(ctx context.Context, tx *sql.Tx, events []Event) error {
+	orgID := middleware.OrganizationFromContext(ctx)
+	if orgID == 0 {
+		return fmt.Errorf("error writing events: no organization")
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("outbox_events", "organization_id", "type", "user_id", "data", "actor", "request_id"))
+	if err != nil {
+		return fmt.Errorf("error starting event copy: %w", err)
+	}
+	defer stmt.Close()
+
+	actor, reqID := middleware.ActorFromContext(ctx), requestID(ctx)
+	for _, event := range events {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return fmt.Errorf("error encoding %s event: %w", event.Type, err)
+		}
+		if _, err = stmt.ExecContext(ctx, orgID, event.Type, event.UserID, string(data), actor, reqID); err != nil {
+			return fmt.Errorf("error writing %s event: %w", event.Type, err)
+		}
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("error writing events: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, "SELECT pg_notify($1, '')", Channel); err != nil {
+		return fmt.Errorf("error notifying events: %w", err)
+	}
+	return nil
+}
+
+// IsType reports whether name is a known event type.
+func IsType(name string) bool {
+	for _, t := range Types {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+func requestID(ctx context.Context) sql.NullString {
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		return sql.NullString{String: id, Valid: true}
+	}
+	return sql.NullString{}
+}
@@ -0,0 +1,89 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol type IDs.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compact encodes Thrift structs with the compact protocol, which Parquet
+// uses for its page headers and footer. Only what those need is supported.
+type compact struct {
+	buf []byte
+	// last holds the previous field ID of each open struct.
+	last []int16
+}
+
+func newCompact() *compact {
+	return &compact{last: []int16{0}}
+}
+
+func (c *compact) field(id int16, typ byte) {
+	delta := id - c.last[len(c.last)-1]
+	if delta > 0 && delta <= 15 {
+		c.buf = append(c.buf, byte(delta)<<4|typ)
+	} else {
+		c.buf = append(c.buf, typ)
+		c.varint(zigzag(int64(id)))
+	}
+	c.last[len(c.last)-1] = id
+}
+
+func (c *compact) varint(v uint64) {
+	c.buf = binary.AppendUvarint(c.buf, v)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, compactI32)
+	c.varint(zigzag(int64(v)))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, compactI64)
+	c.varint(zigzag(v))
+}
+
+func (c *compact) binary(id int16, s string) {
+	c.field(id, compactBinary)
+	c.varint(uint64(len(s)))
+	c.buf = append(c.buf, s...)
+}
+
+// beginList starts a list field of size elements. Struct elements are each
+// written between beginElement and endStruct.
+func (c *compact) beginList(id int16, elem byte, size int) {
+	c.field(id, compactList)
+	if size < 15 {
+		c.buf = append(c.buf, byte(size)<<4|elem)
+	} else {
+		c.buf = append(c.buf, 0xf0|elem)
+		c.varint(uint64(size))
+	}
+}
+
+func (c *compact) beginElement() {
+	c.last = append(c.last, 0)
+}
+
+func (c *compact) beginStruct(id int16) {
+	c.field(id, compactStruct)
+	c.beginElement()
+}
+
+func (c *compact) endStruct() {
+	c.stop()
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compact) stop() {
+	c.buf = append(c.buf, 0)
+}
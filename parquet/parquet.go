@@ -0,0 +1,346 @@
+package parquet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Type is the kind of values a column holds.
+type Type int
+
+const (
+	String Type = iota
+	Int32
+	Int64
+	Bool
+	// Timestamp is stored as microseconds since the Unix epoch, in UTC.
+	Timestamp
+)
+
+// Column describes one column of the file. Optional columns accept nil
+// values.
+type Column struct {
+	Name     string
+	Type     Type
+	Optional bool
+}
+
+// RowGroupSize is the number of rows buffered before a row group is written,
+// which bounds the memory a Writer uses.
+const RowGroupSize = 10000
+
+const magic = "PAR1"
+
+// Parquet enum values, from parquet.thrift.
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecUncompressed = 0
+	pageData          = 0
+)
+
+// Writer writes rows as an uncompressed Parquet file with one data page per
+// column chunk.
+type Writer struct {
+	w         *countingWriter
+	columns   []Column
+	chunks    []columnBuffer
+	rows      int
+	rowGroups []rowGroup
+	total     int64
+	err       error
+}
+
+type columnBuffer struct {
+	values  []byte
+	defined []bool
+	count   int // non-null values
+}
+
+type rowGroup struct {
+	rows   int
+	size   int64
+	chunks []chunkMeta
+}
+
+type chunkMeta struct {
+	offset int64
+	size   int64
+	values int
+}
+
+// NewWriter starts a Parquet file on w. Close must be called to write the
+// footer.
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	pw := &Writer{
+		w:       &countingWriter{w: bufio.NewWriter(w)},
+		columns: columns,
+		chunks:  make([]columnBuffer, len(columns)),
+	}
+	pw.write([]byte(magic))
+	return pw
+}
+
+// Write adds a row. Values must match the column types: string, int32, int64,
+// bool or time.Time, or nil for optional columns.
+func (pw *Writer) Write(row []interface{}) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("row has %d values, want %d", len(row), len(pw.columns))
+	}
+	for i, col := range pw.columns {
+		if err := pw.chunks[i].add(col, row[i]); err != nil {
+			// The row is half written, so the file cannot be continued.
+			pw.err = err
+			return err
+		}
+	}
+	pw.rows++
+	if pw.rows == RowGroupSize {
+		pw.flush()
+	}
+	return pw.err
+}
+
+// Close writes the last row group and the footer. It does not close the
+// underlying writer.
+func (pw *Writer) Close() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if pw.rows > 0 {
+		pw.flush()
+	}
+	start := pw.w.n
+	pw.write(pw.footer())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(pw.w.n-start))
+	pw.write(length[:])
+	pw.write([]byte(magic))
+	if pw.err == nil {
+		pw.err = pw.w.w.Flush()
+	}
+	return pw.err
+}
+
+func (pw *Writer) write(b []byte) {
+	if pw.err == nil {
+		_, pw.err = pw.w.Write(b)
+	}
+}
+
+// flush writes the buffered rows as a row group.
+func (pw *Writer) flush() {
+	group := rowGroup{rows: pw.rows, chunks: make([]chunkMeta, len(pw.columns))}
+	for i, col := range pw.columns {
+		buf := &pw.chunks[i]
+		var page []byte
+		if col.Optional {
+			levels := definitionLevels(buf.defined)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		page = append(page, buf.values...)
+
+		header := newCompact()
+		header.i32(1, pageData)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.beginStruct(5)
+		header.i32(1, int32(pw.rows))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.endStruct()
+		header.stop()
+
+		offset := pw.w.n
+		pw.write(header.buf)
+		pw.write(page)
+		size := pw.w.n - offset
+		group.chunks[i] = chunkMeta{offset: offset, size: size, values: pw.rows}
+		group.size += size
+		*buf = columnBuffer{values: buf.values[:0], defined: buf.defined[:0]}
+	}
+	pw.rowGroups = append(pw.rowGroups, group)
+	pw.total += int64(pw.rows)
+	pw.rows = 0
+}
+
+// footer encodes the FileMetaData.
+func (pw *Writer) footer() []byte {
+	c := newCompact()
+	c.i32(1, 1)
+
+	c.beginList(2, compactStruct, len(pw.columns)+1)
+	c.beginElement()
+	c.binary(4, "schema")
+	c.i32(5, int32(len(pw.columns)))
+	c.endStruct()
+	for _, col := range pw.columns {
+		c.beginElement()
+		c.i32(1, physicalType(col.Type))
+		if col.Optional {
+			c.i32(3, repetitionOptional)
+		} else {
+			c.i32(3, repetitionRequired)
+		}
+		c.binary(4, col.Name)
+		switch col.Type {
+		case String:
+			c.i32(6, convertedUTF8)
+		case Timestamp:
+			c.i32(6, convertedTimestampMicros)
+		}
+		c.endStruct()
+	}
+
+	c.i64(3, pw.total)
+
+	c.beginList(4, compactStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		c.beginElement()
+		c.beginList(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			col := pw.columns[i]
+			c.beginElement()
+			c.i64(2, chunk.offset)
+			c.beginStruct(3)
+			c.i32(1, physicalType(col.Type))
+			c.beginList(2, compactI32, 2)
+			c.varint(zigzag(encodingPlain))
+			c.varint(zigzag(encodingRLE))
+			c.beginList(3, compactBinary, 1)
+			c.varint(uint64(len(col.Name)))
+			c.buf = append(c.buf, col.Name...)
+			c.i32(4, codecUncompressed)
+			c.i64(5, int64(chunk.values))
+			c.i64(6, chunk.size)
+			c.i64(7, chunk.size)
+			c.i64(9, chunk.offset)
+			c.endStruct()
+			c.endStruct()
+		}
+		c.i64(2, group.size)
+		c.i64(3, int64(group.rows))
+		c.endStruct()
+	}
+
+	c.binary(6, "test-project")
+	c.stop()
+	return c.buf
+}
+
+func physicalType(t Type) int32 {
+	switch t {
+	case Int32:
+		return typeInt32
+	case Int64, Timestamp:
+		return typeInt64
+	case Bool:
+		return typeBoolean
+	default:
+		return typeByteArray
+	}
+}
+
+// add appends a PLAIN-encoded value. Nulls only record their definition level.
+func (b *columnBuffer) add(col Column, v interface{}) error {
+	if v == nil {
+		if !col.Optional {
+			return fmt.Errorf("column %s is required", col.Name)
+		}
+		b.defined = append(b.defined, false)
+		return nil
+	}
+	b.defined = append(b.defined, true)
+	switch col.Type {
+	case String:
+		s, ok := v.(string)
+		if !ok {
+			return typeError(col, v)
+		}
+		b.values = binary.LittleEndian.AppendUint32(b.values, uint32(len(s)))
+		b.values = append(b.values, s...)
+	case Int32:
+		n, ok := v.(int32)
+		if !ok {
+			return typeError(col, v)
+		}
+		b.values = binary.LittleEndian.AppendUint32(b.values, uint32(n))
+	case Int64:
+		n, ok := v.(int64)
+		if !ok {
+			return typeError(col, v)
+		}
+		b.values = binary.LittleEndian.AppendUint64(b.values, uint64(n))
+	case Timestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			return typeError(col, v)
+		}
+		b.values = binary.LittleEndian.AppendUint64(b.values, uint64(t.UnixMicro()))
+	case Bool:
+		x, ok := v.(bool)
+		if !ok {
+			return typeError(col, v)
+		}
+		if b.count%8 == 0 {
+			b.values = append(b.values, 0)
+		}
+		if x {
+			b.values[len(b.values)-1] |= 1 << (b.count % 8)
+		}
+	default:
+		return errors.New("unknown column type")
+	}
+	b.count++
+	return nil
+}
+
+func typeError(col Column, v interface{}) error {
+	return fmt.Errorf("column %s: unexpected %T", col.Name, v)
+}
+
+// definitionLevels encodes levels of bit width 1 as a single bit-packed run of
+// the RLE/bit-packing hybrid encoding.
+func definitionLevels(defined []bool) []byte {
+	groups := (len(defined) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for i, d := range defined {
+		if d {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(out, packed...)
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
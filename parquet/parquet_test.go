@@ -0,0 +1,388 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The tests read the files back with the small decoder below, which follows
+// parquet.thrift and the Parquet encoding spec independently of the writer.
+
+// thriftReader decodes Thrift compact structs into maps from field ID to
+// value: int64, string, bool, []interface{} or thriftStruct.
+type thriftReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+type thriftStruct map[int16]interface{}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = fmt.Errorf("unexpected end of data at %d", r.pos)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("bad varint at %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 8:
+		n := int(r.uvarint())
+		if r.err != nil || r.pos+n > len(r.data) {
+			r.err = fmt.Errorf("binary of %d bytes runs past the end", n)
+			return ""
+		}
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case 9, 10:
+		header := r.byte()
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, 0, size)
+		for i := 0; i < size && r.err == nil; i++ {
+			list = append(list, r.value(elem))
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	default:
+		r.err = fmt.Errorf("unsupported compact type %d at %d", typ, r.pos)
+		return nil
+	}
+}
+
+func (r *thriftReader) readStruct() thriftStruct {
+	s := make(thriftStruct)
+	var last int16
+	for r.err == nil {
+		b := r.byte()
+		if b == 0 {
+			break
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		last = id
+		s[id] = r.value(b & 0x0f)
+	}
+	return s
+}
+
+func (s thriftStruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s thriftStruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+func (s thriftStruct) child(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+// readFile decodes a file written by Writer into its footer and its rows.
+func readFile(t *testing.T, data []byte, columns []Column) (thriftStruct, [][]interface{}) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != magic || string(data[len(data)-4:]) != magic {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLen
+	r := &thriftReader{data: data[footerStart : len(data)-8]}
+	meta := r.readStruct()
+	if r.err != nil {
+		t.Fatalf("footer: %v", r.err)
+	}
+	if r.pos != footerLen {
+		t.Fatalf("footer is %d bytes, decoded %d", footerLen, r.pos)
+	}
+
+	var rows [][]interface{}
+	for g, rg := range meta.list(4) {
+		group := rg.(thriftStruct)
+		chunks := group.list(1)
+		if len(chunks) != len(columns) {
+			t.Fatalf("row group %d has %d column chunks, want %d", g, len(chunks), len(columns))
+		}
+		groupRows := int(group.int(3))
+		values := make([][]interface{}, len(columns))
+		var groupSize int64
+		for i, ch := range chunks {
+			chunkMeta := ch.(thriftStruct).child(3)
+			offset, size := chunkMeta.int(9), chunkMeta.int(7)
+			groupSize += size
+			values[i] = readPage(t, data[offset:offset+size], columns[i], groupRows)
+		}
+		if groupSize != group.int(2) {
+			t.Errorf("row group %d: total_byte_size %d, chunks add up to %d", g, group.int(2), groupSize)
+		}
+		for n := 0; n < groupRows; n++ {
+			row := make([]interface{}, len(columns))
+			for i := range columns {
+				row[i] = values[i][n]
+			}
+			rows = append(rows, row)
+		}
+	}
+	if int(meta.int(3)) != len(rows) {
+		t.Errorf("num_rows %d, read %d rows", meta.int(3), len(rows))
+	}
+	return meta, rows
+}
+
+// readPage decodes the single data page of a column chunk.
+func readPage(t *testing.T, chunk []byte, col Column, rows int) []interface{} {
+	t.Helper()
+	r := &thriftReader{data: chunk}
+	header := r.readStruct()
+	if r.err != nil {
+		t.Fatalf("column %s page header: %v", col.Name, r.err)
+	}
+	page := chunk[r.pos:]
+	if int(header.int(3)) != len(page) {
+		t.Fatalf("column %s: compressed_page_size %d, page has %d bytes", col.Name, header.int(3), len(page))
+	}
+	if n := int(header.child(5).int(1)); n != rows {
+		t.Fatalf("column %s: page has %d values, row group %d rows", col.Name, n, rows)
+	}
+
+	defined := make([]bool, rows)
+	for i := range defined {
+		defined[i] = true
+	}
+	if col.Optional {
+		n := int(binary.LittleEndian.Uint32(page))
+		levels := page[4 : 4+n]
+		page = page[4+n:]
+		i := 0
+		for len(levels) > 0 && i < rows {
+			run, k := binary.Uvarint(levels)
+			levels = levels[k:]
+			if run&1 == 1 {
+				groups := int(run >> 1)
+				for b := 0; b < groups*8 && i < rows; b++ {
+					defined[i] = levels[b/8]>>(b%8)&1 == 1
+					i++
+				}
+				levels = levels[groups:]
+			} else {
+				for c := 0; c < int(run>>1) && i < rows; c++ {
+					defined[i] = levels[0] == 1
+					i++
+				}
+				levels = levels[1:]
+			}
+		}
+	}
+
+	values := make([]interface{}, rows)
+	bit := 0
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch col.Type {
+		case String:
+			n := binary.LittleEndian.Uint32(page)
+			values[i] = string(page[4 : 4+n])
+			page = page[4+n:]
+		case Int32:
+			values[i] = int32(binary.LittleEndian.Uint32(page))
+			page = page[4:]
+		case Int64:
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case Timestamp:
+			values[i] = time.UnixMicro(int64(binary.LittleEndian.Uint64(page))).UTC()
+			page = page[8:]
+		case Bool:
+			values[i] = page[bit/8]>>(bit%8)&1 == 1
+			bit++
+		}
+	}
+	if col.Type == Bool {
+		page = page[(bit+7)/8:]
+	}
+	if len(page) != 0 {
+		t.Errorf("column %s: %d bytes left after the values", col.Name, len(page))
+	}
+	return values
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	columns := []Column{
+		{Name: "name", Type: String},
+		{Name: "minutes", Type: Int32, Optional: true},
+		{Name: "id", Type: Int64},
+		{Name: "billable", Type: Bool},
+		{Name: "endTime", Type: Timestamp, Optional: true},
+		{Name: "notes", Type: String, Optional: true},
+	}
+	at := time.Date(2024, 3, 4, 9, 30, 15, 123456000, time.UTC)
+	rows := [][]interface{}{
+		{"Design", int32(90), int64(1), true, at, "first"},
+		{"", nil, int64(-2), false, nil, nil},
+		{"Überstunden", int32(-5), int64(1 << 40), true, at.Add(time.Hour), ""},
+	}
+	// Enough rows to need a second byte of booleans and definition levels.
+	for i := 0; i < 10; i++ {
+		rows = append(rows, []interface{}{fmt.Sprint("row ", i), int32(i), int64(i), i%3 == 0, nil, strings.Repeat("x", i)})
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, columns)
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, got := readFile(t, buf.Bytes(), columns)
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("read back\n%v\nwant\n%v", got, rows)
+	}
+
+	schema := meta.list(2)
+	if len(schema) != len(columns)+1 || schema[0].(thriftStruct).int(5) != int64(len(columns)) {
+		t.Fatalf("schema %v does not list %d columns", schema, len(columns))
+	}
+	for i, col := range columns {
+		element := schema[i+1].(thriftStruct)
+		repetition := int64(repetitionRequired)
+		if col.Optional {
+			repetition = repetitionOptional
+		}
+		if element[4] != col.Name || element.int(1) != int64(physicalType(col.Type)) || element.int(3) != repetition {
+			t.Errorf("schema element %d is %v, want column %+v", i+1, element, col)
+		}
+	}
+}
+
+func TestWriterRowGroups(t *testing.T) {
+	columns := []Column{{Name: "n", Type: Int64}, {Name: "odd", Type: Bool, Optional: true}}
+	total := 2*RowGroupSize + 5
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, columns)
+	var want [][]interface{}
+	for i := 0; i < total; i++ {
+		row := []interface{}{int64(i), nil}
+		if i%7 != 0 {
+			row[1] = i%2 == 1
+		}
+		want = append(want, row)
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, got := readFile(t, buf.Bytes(), columns)
+	if groups := len(meta.list(4)); groups != 3 {
+		t.Errorf("%d row groups, want 3", groups)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("rows read back differ from the rows written")
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf, []Column{{Name: "n", Type: Int64}}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta, rows := readFile(t, buf.Bytes(), []Column{{Name: "n", Type: Int64}})
+	if len(rows) != 0 || len(meta.list(4)) != 0 {
+		t.Errorf("empty file has %d rows in %d row groups", len(rows), len(meta.list(4)))
+	}
+}
+
+func TestWriterRejectsBadRows(t *testing.T) {
+	columns := []Column{{Name: "name", Type: String}, {Name: "n", Type: Int32, Optional: true}}
+	tests := []struct {
+		name string
+		row  []interface{}
+		want string
+	}{
+		{"too few values", []interface{}{"a"}, "row has 1 values"},
+		{"null in required column", []interface{}{nil, int32(1)}, "column name is required"},
+		{"wrong type", []interface{}{"a", 1}, "column n: unexpected int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWriter(&bytes.Buffer{}, columns)
+			err := w.Write(tt.row)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// A half-written row leaves the file unusable.
+	w := NewWriter(&bytes.Buffer{}, columns)
+	w.Write([]interface{}{"a", "b"})
+	if err := w.Close(); err == nil {
+		t.Error("Close succeeded after a failed row")
+	}
+}
+
+func TestCompactFieldHeaders(t *testing.T) {
+	c := newCompact()
+	c.i32(1, -1)
+	c.i64(20, 300)
+	c.binary(21, "ab")
+	c.stop()
+	want := []byte{
+		0x15, 0x01, // field 1, i32, zigzag(-1)
+		0x06, 0x28, 0xd8, 0x04, // field 20 is more than 15 ahead: type, zigzag(20), zigzag(300)
+		0x18, 0x02, 'a', 'b', // field 21, binary
+		0x00,
+	}
+	if !bytes.Equal(c.buf, want) {
+		t.Errorf("encoded % x, want % x", c.buf, want)
+	}
+}
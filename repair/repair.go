@@ -0,0 +1,356 @@
+package repair
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"sort"
+	"test-project/audit"
+	"test-project/database"
+	"test-project/models"
+	"test-project/outbox"
+	"time"
+)
+
+const (
+	IssueOverlap          = "overlap"
+	IssueStaleOpen        = "stale_open"
+	IssueDurationMismatch = "duration_mismatch"
+
+	FixTruncate  = "truncate"
+	FixSplit     = "split"
+	FixClose     = "close"
+	FixRecompute = "recompute"
+)
+
+// Options controls detection. Tasks without an end_time that started more than
+// StaleAfter ago are reported as stale and closed at StaleAfter past their start.
+// Zero UserID or OrganizationID checks tasks of every user or organization.
+type Options struct {
+	StaleAfter     time.Duration
+	UserID         int
+	OrganizationID int
+}
+
+// Issue is a single problem found in the task data.
+type Issue struct {
+	Kind        string `json:"kind"`
+	UserID      int    `json:"userId"`
+	TaskID      int    `json:"taskId"`
+	OtherTaskID int    `json:"otherTaskId,omitempty"`
+	Detail      string `json:"detail"`
+}
+
+// Fix is a change that resolves an issue. For splits, NewTask is the second
+// half inserted after the interrupting task. TaskID is 0 when the task split
+// is itself the second half of an earlier split.
+type Fix struct {
+	Kind    string       `json:"kind"`
+	UserID  int          `json:"userId"`
+	TaskID  int          `json:"taskId"`
+	Before  models.Task  `json:"before"`
+	After   models.Task  `json:"after"`
+	NewTask *models.Task `json:"newTask,omitempty"`
+}
+
+// Report lists the issues found and the fixes planned or applied.
+type Report struct {
+	Issues    []Issue `json:"issues"`
+	Fixes     []Fix   `json:"fixes"`
+	Committed bool    `json:"committed"`
+}
+
+// Run detects issues and plans fixes. With commit set, the fixes are applied
+// in a single transaction and audited; otherwise nothing is written.
+func Run(ctx context.Context, db database.Querier, opts Options, commit bool) (Report, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Report{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tasks, err := loadTasks(ctx, tx, opts, commit)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Issues: []Issue{}, Fixes: []Fix{}}
+	now := time.Now().UTC()
+	for _, userTasks := range groupByUser(tasks) {
+		plan(userTasks, opts, now, &report)
+	}
+
+	if !commit || len(report.Fixes) == 0 {
+		return report, nil
+	}
+
+	for i := range report.Fixes {
+		if err = apply(ctx, tx, &report.Fixes[i]); err != nil {
+			return Report{}, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return Report{}, fmt.Errorf("error committing repairs: %w", err)
+	}
+	report.Committed = true
+	return report, nil
+}
+
+// plan walks one user's tasks in start order. Each task is first closed if it
+// is stale, then compared with the task that follows it.
+//
+// A split inserts the rest of the task into the walk as a new task with ID 0,
+// and the split's NewTask points at it, so later fixes to the rest change the
+// task that will be inserted. Such a task gets no fix of its own unless it is
+// split again; that fix only inserts the new rest.
+func plan(userTasks []models.Task, opts Options, now time.Time, report *Report) {
+	tasks := make([]*models.Task, len(userTasks))
+	for i := range userTasks {
+		tasks[i] = &userTasks[i]
+	}
+
+	for i := 0; i < len(tasks); i++ {
+		task := tasks[i]
+		original := *task
+
+		if task.EndTime.IsZero() && now.Sub(task.StartTime) > opts.StaleAfter {
+			report.Issues = append(report.Issues, Issue{
+				Kind: IssueStaleOpen, UserID: task.UserID, TaskID: task.ID,
+				Detail: fmt.Sprintf("running since %s", task.StartTime.Format(time.RFC3339)),
+			})
+			task.EndTime = task.StartTime.Add(opts.StaleAfter)
+			if i+1 < len(tasks) && tasks[i+1].StartTime.Before(task.EndTime) {
+				task.EndTime = tasks[i+1].StartTime
+			}
+			setDuration(task)
+			if task.ID != 0 {
+				report.Fixes = append(report.Fixes, Fix{Kind: FixClose, UserID: task.UserID, TaskID: task.ID, Before: original, After: *task})
+			}
+			original = *task
+		}
+
+		if i+1 < len(tasks) {
+			next := tasks[i+1]
+			end := task.EndTime
+			if end.IsZero() {
+				end = now
+			}
+			if end.After(next.StartTime) {
+				report.Issues = append(report.Issues, Issue{
+					Kind: IssueOverlap, UserID: task.UserID, TaskID: task.ID, OtherTaskID: next.ID,
+					Detail: fmt.Sprintf("ends %s after task %d starts", end.Sub(next.StartTime).Round(time.Second), next.ID),
+				})
+
+				fix := Fix{Kind: FixTruncate, UserID: task.UserID, TaskID: task.ID, Before: original}
+				if !next.EndTime.IsZero() && end.After(next.EndTime) {
+					fix.Kind = FixSplit
+					rest := *task
+					rest.ID = 0
+					rest.StartTime = next.EndTime
+					rest.EndTime = task.EndTime
+					if !rest.EndTime.IsZero() {
+						setDuration(&rest)
+					}
+					fix.NewTask = &rest
+					insertSorted(&tasks, i+2, &rest)
+				}
+				task.EndTime = next.StartTime
+				setDuration(task)
+				fix.After = *task
+				if task.ID != 0 || fix.NewTask != nil {
+					report.Fixes = append(report.Fixes, fix)
+				}
+				continue
+			}
+		}
+
+		if !task.EndTime.IsZero() && task.ID != 0 {
+			stored := original.Hours*60 + original.Minutes
+			actual := int(task.EndTime.Sub(task.StartTime).Minutes())
+			if stored != actual {
+				report.Issues = append(report.Issues, Issue{
+					Kind: IssueDurationMismatch, UserID: task.UserID, TaskID: task.ID,
+					Detail: fmt.Sprintf("stored %d minutes, interval is %d minutes", stored, actual),
+				})
+				setDuration(task)
+				if original.EndTime.Equal(task.EndTime) {
+					report.Fixes = append(report.Fixes, Fix{Kind: FixRecompute, UserID: task.UserID, TaskID: task.ID, Before: original, After: *task})
+				}
+			}
+		}
+	}
+}
+
+// apply writes a fix. A fix with TaskID 0 splits a task that an earlier fix
+// inserts, already truncated, so it only inserts its own NewTask.
+func apply(ctx context.Context, tx *sql.Tx, fix *Fix) error {
+	fix.After.UpdatedAt = time.Now().UTC()
+	if fix.TaskID != 0 {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE tasks
+			SET end_time = $1, hours = $2, minutes = $3, updated_at = $4
+			WHERE id = $5`,
+			fix.After.EndTime, fix.After.Hours, fix.After.Minutes, fix.After.UpdatedAt, fix.TaskID)
+		if err != nil {
+			return fmt.Errorf("error applying %s to task %d: %w", fix.Kind, fix.TaskID, err)
+		}
+		if err = audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: fix.TaskID, UserID: fix.UserID, Action: audit.ActionRepair, Before: fix.Before, After: fix.After}); err != nil {
+			return err
+		}
+		if fix.Before.EndTime.IsZero() && !fix.After.EndTime.IsZero() {
+			if err = outbox.Publish(ctx, tx, outbox.Event{Type: outbox.EventTaskStopped, UserID: fix.UserID, Data: fix.After}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if fix.NewTask == nil {
+		return nil
+	}
+	rest := fix.NewTask
+	rest.CreatedAt = fix.After.UpdatedAt
+	rest.UpdatedAt = fix.After.UpdatedAt
+	var endTime interface{}
+	if !rest.EndTime.IsZero() {
+		endTime = rest.EndTime
+	}
+	var notes interface{}
+	if rest.Notes != "" {
+		notes = rest.Notes
+	}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO tasks (user_id, project_id, name, notes, billable, hours, minutes, created_at, updated_at, start_time, end_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`,
+		rest.UserID, rest.ProjectID, rest.Name, notes, rest.Billable, rest.Hours, rest.Minutes, rest.CreatedAt, rest.UpdatedAt, rest.StartTime, endTime).Scan(&rest.ID)
+	if err != nil {
+		return fmt.Errorf("error inserting split of task %d: %w", fix.TaskID, err)
+	}
+	if len(rest.Tags) > 0 {
+		// The split task already carries these tags, so they all exist.
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO task_tags (task_id, tag_id)
+			SELECT $1, g.id FROM tags g JOIN users u ON u.organization_id = g.organization_id
+			WHERE u.id = $2 AND g.name = ANY($3)`,
+			rest.ID, rest.UserID, pq.Array(rest.Tags))
+		if err != nil {
+			return fmt.Errorf("error tagging split of task %d: %w", fix.TaskID, err)
+		}
+	}
+	return audit.Record(ctx, tx, audit.Entry{Entity: audit.EntityTask, EntityID: rest.ID, UserID: rest.UserID, Action: audit.ActionRepair, After: rest})
+}
+
+// loadTasks reads the tasks to check. Invoiced tasks and tasks in submitted or
+// approved timesheets are locked against changes and left out.
+func loadTasks(ctx context.Context, tx *sql.Tx, opts Options, lock bool) ([]models.Task, error) {
+	query := `
+		SELECT id, user_id, project_id, COALESCE(name, ''), COALESCE(hours, 0), COALESCE(minutes, 0), created_at, updated_at, start_time, end_time,
+			COALESCE(notes, ''), billable
+		FROM tasks t
+		WHERE start_time IS NOT NULL AND invoice_id IS NULL AND ($1 = 0 OR user_id = $1)
+		AND ($2 = 0 OR user_id IN (SELECT id FROM users WHERE organization_id = $2))
+		AND NOT EXISTS (
+			SELECT 1 FROM timesheets ts JOIN users u ON u.id = ts.user_id
+			WHERE ts.user_id = t.user_id AND ts.status IN ('submitted', 'approved')
+			AND ts.week_start = date_trunc('week', t.start_time AT TIME ZONE u.timezone)::date
+		)
+		ORDER BY user_id, start_time, id`
+	if lock {
+		query += " FOR UPDATE"
+	}
+	rows, err := tx.QueryContext(ctx, query, opts.UserID, opts.OrganizationID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		var (
+			task      models.Task
+			projectID sql.NullInt64
+			endTime   sql.NullTime
+		)
+		if err = rows.Scan(&task.ID, &task.UserID, &projectID, &task.Name, &task.Hours, &task.Minutes, &task.CreatedAt, &task.UpdatedAt, &task.StartTime, &endTime, &task.Notes, &task.Billable); err != nil {
+			return nil, fmt.Errorf("error scanning task: %w", err)
+		}
+		task.EndTime = endTime.Time
+		if projectID.Valid {
+			id := int(projectID.Int64)
+			task.ProjectID = &id
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return tasks, loadTags(ctx, tx, tasks)
+}
+
+// loadTags fills in the Tags of each task, so that the rest of a split task
+// keeps them.
+func loadTags(ctx context.Context, tx *sql.Tx, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(tasks))
+	ids := make([]int64, len(tasks))
+	for i, task := range tasks {
+		index[task.ID] = i
+		ids[i] = int64(task.ID)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT tt.task_id, g.name
+		FROM task_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.task_id = ANY($1)
+		ORDER BY g.name`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error loading task tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			taskID int
+			name   string
+		)
+		if err = rows.Scan(&taskID, &name); err != nil {
+			return fmt.Errorf("error scanning task tag: %w", err)
+		}
+		tasks[index[taskID]].Tags = append(tasks[index[taskID]].Tags, name)
+	}
+	return rows.Err()
+}
+
+func groupByUser(tasks []models.Task) [][]models.Task {
+	var groups [][]models.Task
+	for i := 0; i < len(tasks); {
+		j := i
+		for j < len(tasks) && tasks[j].UserID == tasks[i].UserID {
+			j++
+		}
+		groups = append(groups, tasks[i:j])
+		i = j
+	}
+	return groups
+}
+
+// insertSorted inserts task into tasks at or after from, keeping start order.
+func insertSorted(tasks *[]*models.Task, from int, task *models.Task) {
+	s := *tasks
+	idx := from + sort.Search(len(s)-from, func(k int) bool {
+		return s[from+k].StartTime.After(task.StartTime)
+	})
+	s = append(s, nil)
+	copy(s[idx+1:], s[idx:])
+	s[idx] = task
+	*tasks = s
+}
+
+func setDuration(task *models.Task) {
+	duration := task.EndTime.Sub(task.StartTime)
+	task.Hours = int(duration.Hours())
+	task.Minutes = int(duration.Minutes()) % 60
+}
@@ -0,0 +1,179 @@
+package repair
+
+import (
+	"sort"
+	"test-project/models"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2024, 7, 15, 0, 0, 0, 0, time.UTC)
+
+// at returns the time h hours into day.
+func at(h float64) time.Time {
+	return day.Add(time.Duration(h * float64(time.Hour)))
+}
+
+type span struct{ start, end float64 }
+
+func tasksFrom(spans []span) []models.Task {
+	tasks := make([]models.Task, len(spans))
+	for i, s := range spans {
+		tasks[i] = models.Task{ID: i + 1, UserID: 1, StartTime: at(s.start)}
+		if s.end != 0 {
+			tasks[i].EndTime = at(s.end)
+		}
+		setDuration(&tasks[i])
+	}
+	return tasks
+}
+
+// replay applies the fixes the way apply does: fixes with a TaskID update
+// that task, and every NewTask is inserted as planned.
+func replay(t *testing.T, tasks []models.Task, fixes []Fix) []span {
+	byID := make(map[int]models.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	var inserted []models.Task
+	for _, fix := range fixes {
+		if fix.TaskID != 0 {
+			if _, ok := byID[fix.TaskID]; !ok {
+				t.Fatalf("fix %s targets unknown task %d", fix.Kind, fix.TaskID)
+			}
+			byID[fix.TaskID] = fix.After
+		}
+		if fix.NewTask != nil {
+			inserted = append(inserted, *fix.NewTask)
+		}
+	}
+
+	var spans []span
+	for _, task := range append(inserted, valuesOf(byID)...) {
+		if task.EndTime.IsZero() {
+			t.Fatalf("task %d starting %s is still open", task.ID, task.StartTime)
+		}
+		if minutes := task.Hours*60 + task.Minutes; minutes != int(task.EndTime.Sub(task.StartTime).Minutes()) {
+			t.Errorf("task %d stores %d minutes for %s", task.ID, minutes, task.EndTime.Sub(task.StartTime))
+		}
+		spans = append(spans, span{task.StartTime.Sub(day).Hours(), task.EndTime.Sub(day).Hours()})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
+
+func valuesOf(m map[int]models.Task) []models.Task {
+	tasks := make([]models.Task, 0, len(m))
+	for _, task := range m {
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func TestPlanResolvesOverlaps(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []span
+		want  []span
+	}{
+		{
+			name:  "truncate",
+			tasks: []span{{9, 11}, {10, 12}},
+			want:  []span{{9, 10}, {10, 12}},
+		},
+		{
+			name:  "split",
+			tasks: []span{{9, 17}, {10, 11}},
+			want:  []span{{9, 10}, {10, 11}, {11, 17}},
+		},
+		{
+			name:  "chained splits",
+			tasks: []span{{9, 17}, {10, 11}, {12, 13}, {14, 15}},
+			want:  []span{{9, 10}, {10, 11}, {11, 12}, {12, 13}, {13, 14}, {14, 15}, {15, 17}},
+		},
+		{
+			name:  "chained truncates",
+			tasks: []span{{9, 12}, {10, 13}, {11, 14}},
+			want:  []span{{9, 10}, {10, 11}, {11, 14}},
+		},
+		{
+			name:  "split rest truncated",
+			tasks: []span{{9, 17}, {10, 11}, {12, 18}},
+			want:  []span{{9, 10}, {10, 11}, {11, 12}, {12, 18}},
+		},
+		{
+			name:  "split rest split and truncated",
+			tasks: []span{{9, 20}, {10, 11}, {12, 13}, {19, 21}},
+			want:  []span{{9, 10}, {10, 11}, {11, 12}, {12, 13}, {13, 19}, {19, 21}},
+		},
+		{
+			name:  "nested",
+			tasks: []span{{8, 18}, {9, 17}, {10, 11}},
+			want:  []span{{8, 9}, {9, 10}, {10, 11}, {11, 17}, {17, 18}},
+		},
+		{
+			name:  "stale then overlap",
+			tasks: []span{{1, 0}, {2, 3}},
+			want:  []span{{1, 2}, {2, 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := tasksFrom(tt.tasks)
+			var report Report
+			plan(append([]models.Task(nil), tasks...), Options{StaleAfter: 4 * time.Hour}, at(48), &report)
+
+			got := replay(t, tasks, report.Fixes)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanReportsDurationMismatch(t *testing.T) {
+	tasks := tasksFrom([]span{{9, 10}})
+	tasks[0].Minutes = 5
+
+	var report Report
+	plan(tasks, Options{StaleAfter: 4 * time.Hour}, at(48), &report)
+	if len(report.Fixes) != 1 || report.Fixes[0].Kind != FixRecompute || report.Fixes[0].After.Hours != 1 || report.Fixes[0].After.Minutes != 0 {
+		t.Fatalf("fixes = %+v, want one recompute to 1h0m", report.Fixes)
+	}
+}
+
+func TestPlanSplitKeepsTaskDetails(t *testing.T) {
+	project := 3
+	tasks := tasksFrom([]span{{9, 17}, {10, 11}, {12, 13}})
+	tasks[0].ProjectID = &project
+	tasks[0].Name = "Client work"
+	tasks[0].Notes = "On site"
+	tasks[0].Billable = true
+	tasks[0].Tags = []string{"meeting", "travel"}
+
+	var report Report
+	plan(tasks, Options{StaleAfter: 4 * time.Hour}, at(48), &report)
+
+	splits := 0
+	for _, fix := range report.Fixes {
+		if fix.NewTask == nil {
+			continue
+		}
+		splits++
+		rest := fix.NewTask
+		if rest.ProjectID == nil || *rest.ProjectID != project || rest.Name != "Client work" || rest.Notes != "On site" || !rest.Billable {
+			t.Errorf("split rest %+v lost the task's project, name, notes or billable flag", *rest)
+		}
+		if len(rest.Tags) != 2 || rest.Tags[0] != "meeting" || rest.Tags[1] != "travel" {
+			t.Errorf("split rest has tags %v, want [meeting travel]", rest.Tags)
+		}
+	}
+	if splits != 2 {
+		t.Fatalf("%d splits, want 2", splits)
+	}
+}
@@ -0,0 +1,73 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestParallelCreatesGetUniqueIDs fires hundreds of creates at once. Every one
+// must succeed with an ID of its own; gaps between IDs are fine.
+func TestParallelCreatesGetUniqueIDs(t *testing.T) {
+	requireDB(t)
+	org := createOrganization(t, "ids")
+
+	const n = 200
+	userIDs := parallelIDs(t, n, func(int) *http.Request {
+		return newRequest(t, "POST", "/users", org.Token, newUser())
+	})
+	parallelIDs(t, n, func(i int) *http.Request {
+		return newRequest(t, "POST", "/users/"+strconv.Itoa(userIDs[i])+"/tasks/start", org.Token, map[string]string{"name": "parallel"})
+	})
+}
+
+// parallelIDs builds n requests, serves them concurrently, checks that each returns 201,
+// and returns the IDs they created after checking that none repeats.
+func parallelIDs(t *testing.T, n int, request func(i int) *http.Request) []int {
+	t.Helper()
+	requests := make([]*http.Request, n)
+	for i := range requests {
+		requests[i] = request(i)
+	}
+
+	ids := make([]int, n)
+	errs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := serve(requests[i])
+			if rec.Code != http.StatusCreated {
+				errs[i] = strconv.Itoa(rec.Code) + ": " + rec.Body.String()
+				return
+			}
+			var created struct {
+				ID int `json:"id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+				errs[i] = err.Error()
+				return
+			}
+			ids[i] = created.ID
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]int, n)
+	for i, id := range ids {
+		if errs[i] != "" {
+			t.Fatalf("request %d failed: %s", i, errs[i])
+		}
+		if id <= 0 {
+			t.Fatalf("request %d returned ID %d", i, id)
+		}
+		if j, ok := seen[id]; ok {
+			t.Fatalf("requests %d and %d both got ID %d", j, i, id)
+		}
+		seen[id] = i
+	}
+	return ids
+}
@@ -0,0 +1,40 @@
+package routers
+
+import (
+	"context"
+	"errors"
+	"test-project/database"
+	"testing"
+)
+
+// TestDeleteInvoiceRemovesLines checks that removing an invoice row, which
+// the API never does but an operator may, takes its lines with it and
+// releases its tasks instead of leaving them pointing at nothing.
+func TestDeleteInvoiceRemovesLines(t *testing.T) {
+	requireDB(t)
+	data := createTenantData(t, createOrganization(t, "invoice-delete"))
+
+	var lines, tasks int
+	err := database.WithScope(context.Background(), database.SystemScope, func(ctx context.Context) error {
+		q := database.From(ctx)
+		if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM invoice_lines WHERE invoice_id = $1", data.invoice).Scan(&lines); err != nil {
+			return err
+		}
+		if lines == 0 {
+			return errors.New("the test invoice has no lines")
+		}
+		if _, err := q.ExecContext(ctx, "DELETE FROM invoices WHERE id = $1", data.invoice); err != nil {
+			return err
+		}
+		if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM invoice_lines WHERE invoice_id = $1", data.invoice).Scan(&lines); err != nil {
+			return err
+		}
+		return q.QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE invoice_id = $1", data.invoice).Scan(&tasks)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines != 0 || tasks != 0 {
+		t.Errorf("%d lines and %d tasks still reference the deleted invoice, want none", lines, tasks)
+	}
+}
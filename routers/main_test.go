@@ -0,0 +1,185 @@
+package routers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"test-project/config"
+	"test-project/database"
+	"test-project/logger"
+	"test-project/middleware"
+	"testing"
+	"time"
+)
+
+// The tests in this package drive the whole API against the Postgres database
+// named by TEST_DATABASE_URL and are skipped without one. The database is
+// migrated as at startup and every test creates its own organizations, so it
+// can be reused between runs. Connect as a role without SUPERUSER or
+// BYPASSRLS, like the service in production, so that row-level security
+// applies.
+
+const (
+	testAdminToken = "test-admin-token"
+	testBaseDomain = "tracker.test"
+)
+
+var (
+	testRouter http.Handler
+	passports  atomic.Int64
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		return m.Run()
+	}
+
+	// Creating users rewrites the seed files, so work on a copy.
+	migrations, err := copyMigrations("../migrations")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(migrations)
+
+	os.Setenv("DATABASE_URL", url)
+	cfg, err := config.Load([]string{"-profile", config.ProfileTest})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cfg.Database.MigrationsPath = migrations
+	cfg.Database.RequireRowSecurity = true
+	cfg.Auth.AdminToken = testAdminToken
+	cfg.Tenancy.BaseDomain = testBaseDomain
+	logger.Init(cfg.Log)
+
+	database.InitDB(cfg.Database)
+	defer database.Close()
+
+	testRouter = InitRouter(cfg)
+	passports.Store(time.Now().UnixNano() % 1000000)
+	return m.Run()
+}
+
+func copyMigrations(dir string) (string, error) {
+	tmp, err := os.MkdirTemp("", "migrations")
+	if err != nil {
+		return "", err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return "", err
+		}
+		if err = os.WriteFile(filepath.Join(tmp, file.Name()), data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return tmp, nil
+}
+
+// requireDB skips t when no test database is configured.
+func requireDB(t *testing.T) {
+	t.Helper()
+	if testRouter == nil {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+}
+
+// newRequest builds a request with token as its bearer token and body, if
+// not nil, encoded as JSON.
+func newRequest(t *testing.T, method, path, token string, body interface{}) *http.Request {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// adminRequest builds a request made with the admin token on behalf of org.
+func adminRequest(t *testing.T, method, path string, org testOrganization, body interface{}) *http.Request {
+	t.Helper()
+	req := newRequest(t, method, path, testAdminToken, body)
+	req.Header.Set(middleware.OrganizationHeader, org.Slug)
+	return req
+}
+
+func serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	testRouter.ServeHTTP(rec, req)
+	return rec
+}
+
+// call serves the request and decodes the response into out when it has the
+// wanted status.
+func call(t *testing.T, req *http.Request, want int, out interface{}) {
+	t.Helper()
+	rec := serve(req)
+	if rec.Code != want {
+		t.Fatalf("%s %s: status %d, want %d: %s", req.Method, req.URL, rec.Code, want, rec.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", req.Method, req.URL, err)
+		}
+	}
+}
+
+type testOrganization struct {
+	ID    int    `json:"id"`
+	Slug  string `json:"slug"`
+	Token string `json:"token"`
+}
+
+// createOrganization creates an organization with a slug unique to this run.
+func createOrganization(t *testing.T, prefix string) testOrganization {
+	t.Helper()
+	slug := prefix + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	var org testOrganization
+	call(t, newRequest(t, "POST", "/organizations", testAdminToken, map[string]string{"slug": slug, "name": slug}), http.StatusCreated, &org)
+	return org
+}
+
+// createUser creates a user in the organization the token belongs to.
+func createUser(t *testing.T, token string) int {
+	t.Helper()
+	var user struct {
+		ID int `json:"id"`
+	}
+	call(t, newRequest(t, "POST", "/users", token, newUser()), http.StatusCreated, &user)
+	return user.ID
+}
+
+func newUser() map[string]string {
+	return map[string]string{
+		"passport_number": fmt.Sprintf("1234 %06d", passports.Add(1)%1000000),
+		"surname":         "Test",
+		"name":            "User",
+	}
+}
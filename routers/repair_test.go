@@ -0,0 +1,60 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"test-project/database"
+	"testing"
+	"time"
+)
+
+// TestRepairSplitKeepsBilling repairs a billable, tagged task that another
+// task interrupts and checks that the rest inserted after the interruption is
+// still billable, tagged and annotated.
+func TestRepairSplitKeepsBilling(t *testing.T) {
+	requireDB(t)
+	org := createOrganization(t, "repair")
+	userID := createUser(t, org.Token)
+	tasks := "/users/" + strconv.Itoa(userID) + "/tasks"
+
+	start := time.Now().UTC().AddDate(0, 0, -2).Truncate(24 * time.Hour).Add(9 * time.Hour)
+	call(t, newRequest(t, "POST", tasks, org.Token, map[string]interface{}{
+		"name": "Client work", "notes": "On site", "billable": true, "tags": []string{"travel"},
+		"startTime": start, "endTime": start.Add(8 * time.Hour),
+	}), http.StatusCreated, nil)
+
+	// The API refuses overlapping entries, so the interruption is inserted directly.
+	err := database.WithScope(context.Background(), database.SystemScope, func(ctx context.Context) error {
+		_, err := database.From(ctx).ExecContext(ctx, `
+			INSERT INTO tasks (user_id, name, hours, minutes, created_at, updated_at, start_time, end_time)
+			VALUES ($1, 'Call', 1, 0, NOW(), NOW(), $2, $3)`,
+			userID, start.Add(time.Hour), start.Add(2*time.Hour))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call(t, adminRequest(t, "POST", "/admin/tasks/repair?mode=commit&userId="+strconv.Itoa(userID), org, nil), http.StatusOK, nil)
+
+	var got []struct {
+		Name      string    `json:"name"`
+		Notes     string    `json:"notes"`
+		Billable  bool      `json:"billable"`
+		Tags      []string  `json:"tags"`
+		StartTime time.Time `json:"startTime"`
+	}
+	call(t, newRequest(t, "GET", tasks, org.Token, nil), http.StatusOK, &got)
+	if len(got) != 3 {
+		t.Fatalf("%d tasks after the repair, want 3", len(got))
+	}
+	for _, task := range got {
+		if task.Name != "Client work" {
+			continue
+		}
+		if !task.Billable || task.Notes != "On site" || len(task.Tags) != 1 || task.Tags[0] != "travel" {
+			t.Errorf("part starting %s: billable %v, notes %q, tags %v", task.StartTime, task.Billable, task.Notes, task.Tags)
+		}
+	}
+}
@@ -3,29 +3,226 @@ package routers
 import (
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"test-project/config"
 	"test-project/controllers"
+	"test-project/middleware"
 )
 
-func InitRouter() *mux.Router {
+func InitRouter(cfg *config.Config) *mux.Router {
+	controllers.Init(cfg)
+
 	router := mux.NewRouter().StrictSlash(true)
+	router.Use(middleware.RequestID, middleware.Actor(cfg.Auth))
 
 	router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"),
 	))
 
-	router.HandleFunc("/users", controllers.GetUsers).Methods("GET")
+	router.HandleFunc("/healthz", controllers.Healthz).Methods("GET")
+
+	router.HandleFunc("/readyz", controllers.Readyz).Methods("GET")
+
+	router.HandleFunc("/health", controllers.HealthDetails).Methods("GET")
+
+	router.HandleFunc("/organizations", controllers.GetOrganizations).Methods("GET")
+
+	router.HandleFunc("/organizations", controllers.CreateOrganization).Methods("POST")
+
+	router.HandleFunc("/organizations/{id}", controllers.UpdateOrganization).Methods("PATCH")
+
+	router.HandleFunc("/organizations/{id}", controllers.DeleteOrganization).Methods("DELETE")
+
+	router.HandleFunc("/organizations/{id}/token", controllers.RotateOrganizationToken).Methods("POST")
+
+	// Feed tokens name their user and organization, so calendar apps need no API token.
+	router.HandleFunc("/feeds/{token:feed_[0-9a-f]+}.ics", controllers.GetCalendarFeed).Methods("GET")
+
+	// Event streams stay open for long, so they only borrow a scoped
+	// connection when they query instead of holding one for their lifetime.
+	streams := router.PathPrefix("/").Subrouter()
+	streams.Use(middleware.Tenant(cfg.Tenancy, controllers.OrganizationResolver{}))
+
+	streams.HandleFunc("/events/timers", controllers.StreamTimers).Methods("GET")
+
+	streams.HandleFunc("/users/{id}/events/timers", controllers.StreamUserTimers).Methods("GET")
+
+	// Everything below is scoped to the organization the request resolves to.
+	api := router.PathPrefix("/").Subrouter()
+	api.Use(middleware.Tenant(cfg.Tenancy, controllers.OrganizationResolver{}), middleware.ScopeDB)
+
+	api.HandleFunc("/users", controllers.GetUsers).Methods("GET")
+
+	api.HandleFunc("/users", controllers.CreateUser).Methods("POST")
+
+	api.HandleFunc("/users/import", controllers.ImportUsers).Methods("POST")
+
+	api.HandleFunc("/users/export", controllers.ExportUsers).Methods("GET")
+
+	api.HandleFunc("/users/{id}", controllers.UpdateUser).Methods("PATCH")
+
+	api.HandleFunc("/users/{id}", controllers.DeleteUser).Methods("DELETE")
+
+	api.HandleFunc("/users/{id}/restore", controllers.RestoreUser).Methods("POST")
+
+	api.HandleFunc("/users/{id}/history", controllers.GetUserHistory).Methods("GET")
+
+	api.HandleFunc("/audit", controllers.GetAuditLog).Methods("GET")
+
+	api.HandleFunc("/tasks/export", controllers.ExportTasks).Methods("GET")
+
+	api.HandleFunc("/admin/tasks/anomalies", controllers.GetTaskAnomalies).Methods("GET")
+
+	api.HandleFunc("/admin/tasks/repair", controllers.RepairTasks).Methods("POST")
+
+	api.HandleFunc("/users/{id}/tasks", controllers.GetUserTasks).Methods("GET")
+
+	api.HandleFunc("/users/{id}/tasks", controllers.CreateTaskEntry).Methods("POST")
+
+	api.HandleFunc("/users/{id}/tasks.ics", controllers.GetUserTasksCalendar).Methods("GET")
+
+	api.HandleFunc("/users/{id}/feed", controllers.CreateCalendarFeed).Methods("POST")
+
+	api.HandleFunc("/users/{id}/feed", controllers.RevokeCalendarFeed).Methods("DELETE")
+
+	api.HandleFunc("/users/{id}/tasks/{taskId:[0-9]+}", controllers.UpdateTask).Methods("PATCH")
+
+	api.HandleFunc("/users/{id}/tasks/{taskId:[0-9]+}", controllers.DeleteTask).Methods("DELETE")
+
+	api.HandleFunc("/users/{id}/tasks/start", controllers.StartTask).Methods("POST")
+
+	api.HandleFunc("/users/{id}/tasks/stop", controllers.StopTask).Methods("POST")
+
+	api.HandleFunc("/clients", controllers.GetClients).Methods("GET")
+
+	api.HandleFunc("/clients", controllers.CreateClient).Methods("POST")
+
+	api.HandleFunc("/clients/{id}", controllers.GetClient).Methods("GET")
+
+	api.HandleFunc("/clients/{id}", controllers.UpdateClient).Methods("PATCH")
+
+	api.HandleFunc("/clients/{id}", controllers.DeleteClient).Methods("DELETE")
+
+	api.HandleFunc("/projects", controllers.GetProjects).Methods("GET")
+
+	api.HandleFunc("/projects", controllers.CreateProject).Methods("POST")
+
+	api.HandleFunc("/projects/{id}", controllers.GetProject).Methods("GET")
+
+	api.HandleFunc("/projects/{id}", controllers.UpdateProject).Methods("PATCH")
+
+	api.HandleFunc("/projects/{id}", controllers.DeleteProject).Methods("DELETE")
+
+	api.HandleFunc("/projects/{id}/members", controllers.GetProjectMembers).Methods("GET")
+
+	api.HandleFunc("/projects/{id}/members", controllers.AddProjectMember).Methods("POST")
+
+	api.HandleFunc("/projects/{id}/members/{userId}", controllers.RemoveProjectMember).Methods("DELETE")
+
+	api.HandleFunc("/reports/time", controllers.GetTimeReport).Methods("GET")
+
+	api.HandleFunc("/reports/cost", controllers.GetCostReport).Methods("GET")
+
+	api.HandleFunc("/reports/attendance", controllers.GetAttendanceReport).Methods("GET")
+
+	api.HandleFunc("/users/{id}/schedule", controllers.GetWorkSchedule).Methods("GET")
+
+	api.HandleFunc("/users/{id}/schedule", controllers.SetWorkSchedule).Methods("PUT")
+
+	api.HandleFunc("/calendars", controllers.GetHolidayCalendars).Methods("GET")
+
+	api.HandleFunc("/calendars", controllers.CreateHolidayCalendar).Methods("POST")
+
+	api.HandleFunc("/calendars/{id}", controllers.GetHolidayCalendar).Methods("GET")
+
+	api.HandleFunc("/calendars/{id}", controllers.DeleteHolidayCalendar).Methods("DELETE")
+
+	api.HandleFunc("/calendars/{id}/import", controllers.ImportHolidays).Methods("POST")
+
+	api.HandleFunc("/rates", controllers.GetRates).Methods("GET")
+
+	api.HandleFunc("/rates", controllers.CreateRate).Methods("POST")
+
+	api.HandleFunc("/rates/{id}", controllers.DeleteRate).Methods("DELETE")
+
+	api.HandleFunc("/invoices", controllers.GetInvoices).Methods("GET")
+
+	api.HandleFunc("/invoices", controllers.CreateInvoice).Methods("POST")
+
+	api.HandleFunc("/invoices/{id}", controllers.GetInvoice).Methods("GET")
+
+	api.HandleFunc("/invoices/{id}/void", controllers.VoidInvoice).Methods("POST")
+
+	api.HandleFunc("/projects/{id}/budget", controllers.GetProjectBudget).Methods("GET")
+
+	api.HandleFunc("/projects/{id}/budget", controllers.SetProjectBudget).Methods("PUT")
+
+	api.HandleFunc("/users/{id}/budget", controllers.GetUserBudget).Methods("GET")
+
+	api.HandleFunc("/users/{id}/budget", controllers.SetUserBudget).Methods("PUT")
+
+	api.HandleFunc("/budget-alerts", controllers.GetBudgetAlerts).Methods("GET")
+
+	api.HandleFunc("/users/{id}/timesheets", controllers.GetUserTimesheets).Methods("GET")
+
+	api.HandleFunc("/users/{id}/timesheets/{week:[0-9]{4}-[0-9]{2}-[0-9]{2}}", controllers.GetTimesheet).Methods("GET")
+
+	api.HandleFunc("/users/{id}/timesheets/{week:[0-9]{4}-[0-9]{2}-[0-9]{2}}/submit", controllers.SubmitTimesheet).Methods("POST")
+
+	api.HandleFunc("/timesheets/inbox", controllers.GetTimesheetInbox).Methods("GET")
+
+	api.HandleFunc("/timesheets/{id:[0-9]+}/approve", controllers.ApproveTimesheet).Methods("POST")
+
+	api.HandleFunc("/timesheets/{id:[0-9]+}/reject", controllers.RejectTimesheet).Methods("POST")
+
+	api.HandleFunc("/tags", controllers.GetTags).Methods("GET")
+
+	api.HandleFunc("/tags", controllers.CreateTag).Methods("POST")
+
+	api.HandleFunc("/tags/{id}", controllers.UpdateTag).Methods("PATCH")
+
+	api.HandleFunc("/tags/{id}", controllers.DeleteTag).Methods("DELETE")
+
+	api.HandleFunc("/users/{id}/tags/suggestions", controllers.GetTagSuggestions).Methods("GET")
+
+	api.HandleFunc("/teams", controllers.GetTeams).Methods("GET")
+
+	api.HandleFunc("/teams", controllers.CreateTeam).Methods("POST")
+
+	api.HandleFunc("/teams/{id}", controllers.UpdateTeam).Methods("PATCH")
+
+	api.HandleFunc("/teams/{id}", controllers.DeleteTeam).Methods("DELETE")
+
+	api.HandleFunc("/teams/{id}/members", controllers.GetTeamMembers).Methods("GET")
+
+	api.HandleFunc("/teams/{id}/members", controllers.AddTeamMember).Methods("POST")
+
+	api.HandleFunc("/teams/{id}/members/{userId}", controllers.RemoveTeamMember).Methods("DELETE")
+
+	api.HandleFunc("/jobs", controllers.EnqueueJob).Methods("POST")
+
+	api.HandleFunc("/jobs", controllers.GetJobs).Methods("GET")
+
+	api.HandleFunc("/jobs/{id:[0-9]+}", controllers.GetJob).Methods("GET")
+
+	api.HandleFunc("/jobs/{id:[0-9]+}/cancel", controllers.CancelJob).Methods("POST")
+
+	api.HandleFunc("/jobs/{id:[0-9]+}/result", controllers.GetJobResult).Methods("GET")
+
+	api.HandleFunc("/webhooks", controllers.GetWebhooks).Methods("GET")
+
+	api.HandleFunc("/webhooks", controllers.CreateWebhook).Methods("POST")
 
-	router.HandleFunc("/users", controllers.CreateUser).Methods("POST")
+	api.HandleFunc("/webhooks/{id}", controllers.UpdateWebhook).Methods("PATCH")
 
-	router.HandleFunc("/users/{id}", controllers.UpdateUser).Methods("PATCH")
+	api.HandleFunc("/webhooks/{id}", controllers.DeleteWebhook).Methods("DELETE")
 
-	router.HandleFunc("/users/{id}", controllers.DeleteUser).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/secret", controllers.RotateWebhookSecret).Methods("POST")
 
-	router.HandleFunc("/users/{id}/tasks", controllers.GetUserTasks).Methods("GET")
+	api.HandleFunc("/webhooks/{id}/deliveries", controllers.GetWebhookDeliveries).Methods("GET")
 
-	router.HandleFunc("/users/{id}/tasks/start", controllers.StartTask).Methods("POST")
+	api.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}/replay", controllers.ReplayWebhookDelivery).Methods("POST")
 
-	router.HandleFunc("/users/{id}/tasks/stop", controllers.StopTask).Methods("POST")
+	api.HandleFunc("/webhooks/{id}/replay", controllers.ReplayWebhook).Methods("POST")
 
 	return router
 }
@@ -0,0 +1,116 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"test-project/database"
+	"testing"
+	"time"
+)
+
+// TestParallelOverlappingEntries creates the same time entry many times at
+// once. Exactly one may be stored; the others overlap it.
+func TestParallelOverlappingEntries(t *testing.T) {
+	requireDB(t)
+	org := createOrganization(t, "overlap")
+	userID := createUser(t, org.Token)
+
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Minute)
+	entry := map[string]interface{}{"name": "entry", "startTime": start, "endTime": start.Add(time.Hour)}
+	const n = 20
+	requests := make([]*http.Request, n)
+	for i := range requests {
+		requests[i] = newRequest(t, "POST", "/users/"+strconv.Itoa(userID)+"/tasks", org.Token, entry)
+	}
+
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve(requests[i]).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("request %d: status %d", i, code)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d overlapping entries were created, want 1", created)
+	}
+}
+
+// TestUpdateTaskOfDeletedUser checks that a soft-deleted user's tasks can no
+// longer be edited.
+func TestUpdateTaskOfDeletedUser(t *testing.T) {
+	requireDB(t)
+	org := createOrganization(t, "deleted")
+	userID := createUser(t, org.Token)
+	user := "/users/" + strconv.Itoa(userID)
+
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Minute)
+	var task struct {
+		ID int `json:"id"`
+	}
+	call(t, newRequest(t, "POST", user+"/tasks", org.Token, map[string]interface{}{"name": "entry", "startTime": start, "endTime": start.Add(time.Hour)}), http.StatusCreated, &task)
+	call(t, newRequest(t, "DELETE", user, org.Token, nil), http.StatusOK, nil)
+
+	call(t, newRequest(t, "PATCH", user+"/tasks/"+strconv.Itoa(task.ID), org.Token, map[string]string{"name": "renamed"}), http.StatusNotFound, nil)
+}
+
+// TestStopTask checks that stopping only ends the user's newest running task
+// and is refused once the week the task started in is submitted.
+func TestStopTask(t *testing.T) {
+	requireDB(t)
+	org := createOrganization(t, "stop")
+	userID := createUser(t, org.Token)
+	stop := "/users/" + strconv.Itoa(userID) + "/tasks/stop"
+
+	// The API keeps one task running at a time and refuses to start one in a
+	// submitted week, so both states are set up directly.
+	exec := func(t *testing.T, query string, args ...interface{}) {
+		t.Helper()
+		err := database.WithScope(context.Background(), database.SystemScope, func(ctx context.Context) error {
+			_, err := database.From(ctx).ExecContext(ctx, query, args...)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, start := range []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Hour)} {
+		exec(t, `
+			INSERT INTO tasks (user_id, name, hours, minutes, created_at, updated_at, start_time)
+			VALUES ($1, 'Running', 0, 0, NOW(), NOW(), $2)`, userID, start)
+	}
+
+	call(t, newRequest(t, "POST", stop, org.Token, nil), http.StatusOK, nil)
+	var running int
+	err := database.WithScope(context.Background(), database.SystemScope, func(ctx context.Context) error {
+		return database.From(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND end_time IS NULL AND start_time = $2", userID, now.Add(-2*time.Hour)).Scan(&running)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running != 1 {
+		t.Fatal("the older running task was stopped too")
+	}
+
+	exec(t, `
+		INSERT INTO timesheets (user_id, week_start, status, submitted_at)
+		SELECT id, date_trunc('week', $2::timestamptz AT TIME ZONE timezone)::date, 'submitted', NOW()
+		FROM users WHERE id = $1`, userID, now.Add(-2*time.Hour))
+	call(t, newRequest(t, "POST", stop, org.Token, nil), http.StatusConflict, nil)
+}
@@ -0,0 +1,206 @@
+package routers
+
+import (
+	"fmt"
+	"net/http"
+	"test-project/middleware"
+	"testing"
+)
+
+// tenantData is one of everything an organization owns.
+type tenantData struct {
+	org       testOrganization
+	user      int
+	client    int
+	project   int
+	task      int
+	invoice   int
+	timesheet int
+}
+
+// createTenantData fills org with a user, a client and its project, a task,
+// an invoiced task and a submitted timesheet.
+func createTenantData(t *testing.T, org testOrganization) tenantData {
+	t.Helper()
+	data := tenantData{org: org, user: createUser(t, org.Token)}
+
+	var created struct {
+		ID int `json:"id"`
+	}
+	call(t, newRequest(t, "POST", "/clients", org.Token, map[string]string{"name": "Client"}), http.StatusCreated, &created)
+	data.client = created.ID
+	call(t, newRequest(t, "POST", "/projects", org.Token, map[string]interface{}{"name": "Project", "clientId": data.client}), http.StatusCreated, &created)
+	data.project = created.ID
+	call(t, adminRequest(t, "POST", "/rates", org, map[string]interface{}{
+		"projectId": data.project, "amount": 6000, "currency": "EUR", "effectiveFrom": "2020-01-01T00:00:00Z",
+	}), http.StatusCreated, nil)
+
+	tasks := fmt.Sprintf("/users/%d/tasks", data.user)
+	call(t, newRequest(t, "POST", tasks, org.Token, map[string]interface{}{
+		"name": "Invoiced", "projectId": data.project, "billable": true,
+		"startTime": "2024-01-08T09:00:00Z", "endTime": "2024-01-08T10:00:00Z",
+	}), http.StatusCreated, nil)
+	call(t, adminRequest(t, "POST", "/invoices", org, map[string]interface{}{
+		"clientId": data.client, "periodStart": "2024-01-01", "periodEnd": "2024-01-31", "groupBy": "project", "currency": "EUR",
+	}), http.StatusCreated, &created)
+	data.invoice = created.ID
+
+	call(t, newRequest(t, "POST", tasks, org.Token, map[string]interface{}{
+		"name": "Open", "projectId": data.project,
+		"startTime": "2024-02-05T09:00:00Z", "endTime": "2024-02-05T10:00:00Z",
+	}), http.StatusCreated, &created)
+	data.task = created.ID
+
+	call(t, newRequest(t, "POST", fmt.Sprintf("/users/%d/timesheets/2024-01-15/submit", data.user), org.Token, nil), http.StatusOK, &created)
+	data.timesheet = created.ID
+	return data
+}
+
+// TestCrossTenantAccess has one organization go after everything another
+// owns. Each request must be refused as if the resource did not exist, and
+// the other organization's data must be left as it was.
+func TestCrossTenantAccess(t *testing.T) {
+	requireDB(t)
+	a := createTenantData(t, createOrganization(t, "tenant-a"))
+	b := createTenantData(t, createOrganization(t, "tenant-b"))
+
+	user := fmt.Sprintf("/users/%d", b.user)
+	task := fmt.Sprintf("%s/tasks/%d", user, b.task)
+	project := fmt.Sprintf("/projects/%d", b.project)
+	client := fmt.Sprintf("/clients/%d", b.client)
+	invoice := fmt.Sprintf("/invoices/%d", b.invoice)
+	timesheet := fmt.Sprintf("%s/timesheets/2024-01-15", user)
+
+	requests := []*http.Request{
+		newRequest(t, "PATCH", user, a.org.Token, newUser()),
+		newRequest(t, "POST", user+"/restore", a.org.Token, nil),
+		newRequest(t, "GET", user+"/tasks", a.org.Token, nil),
+		newRequest(t, "POST", user+"/tasks", a.org.Token, map[string]interface{}{
+			"name": "Planted", "startTime": "2024-03-04T09:00:00Z", "endTime": "2024-03-04T10:00:00Z",
+		}),
+		newRequest(t, "PATCH", task, a.org.Token, map[string]string{"name": "Renamed"}),
+		newRequest(t, "DELETE", task, a.org.Token, nil),
+		newRequest(t, "GET", project, a.org.Token, nil),
+		newRequest(t, "PATCH", project, a.org.Token, map[string]string{"name": "Renamed"}),
+		newRequest(t, "DELETE", project, a.org.Token, nil),
+		newRequest(t, "GET", client, a.org.Token, nil),
+		newRequest(t, "PATCH", client, a.org.Token, map[string]string{"name": "Renamed"}),
+		newRequest(t, "DELETE", client, a.org.Token, nil),
+		adminRequest(t, "GET", invoice, a.org, nil),
+		adminRequest(t, "POST", invoice+"/void", a.org, nil),
+		newRequest(t, "GET", timesheet, a.org.Token, nil),
+		newRequest(t, "POST", timesheet+"/submit", a.org.Token, nil),
+		adminRequest(t, "POST", fmt.Sprintf("/timesheets/%d/approve", b.timesheet), a.org, map[string]int{"managerId": a.user}),
+		adminRequest(t, "POST", fmt.Sprintf("/timesheets/%d/reject", b.timesheet), a.org, map[string]interface{}{"comment": "No", "managerId": a.user}),
+		newRequest(t, "DELETE", user, a.org.Token, nil),
+	}
+	for _, req := range requests {
+		if rec := serve(req); rec.Code != http.StatusNotFound && rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s with another organization's credentials: status %d, want 404 or 403: %s", req.Method, req.URL, rec.Code, rec.Body)
+		}
+	}
+
+	// Lists only show the caller's own organization.
+	lists := []struct {
+		req *http.Request
+		id  int
+	}{
+		{newRequest(t, "GET", "/users", a.org.Token, nil), b.user},
+		{newRequest(t, "GET", "/projects", a.org.Token, nil), b.project},
+		{newRequest(t, "GET", "/clients", a.org.Token, nil), b.client},
+		{adminRequest(t, "GET", "/invoices", a.org, nil), b.invoice},
+		{newRequest(t, "GET", fmt.Sprintf("/users/%d/timesheets", b.user), a.org.Token, nil), b.timesheet},
+	}
+	for _, list := range lists {
+		var items []struct {
+			ID int `json:"id"`
+		}
+		call(t, list.req, http.StatusOK, &items)
+		for _, item := range items {
+			if item.ID == list.id {
+				t.Errorf("%s %s lists %d of another organization", list.req.Method, list.req.URL, list.id)
+			}
+		}
+	}
+
+	// The other organization still has everything, unchanged.
+	var tasks []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	call(t, newRequest(t, "GET", user+"/tasks", b.org.Token, nil), http.StatusOK, &tasks)
+	if len(tasks) != 2 {
+		t.Fatalf("organization b has %d tasks, want 2", len(tasks))
+	}
+	for _, got := range tasks {
+		if got.Name != "Invoiced" && got.Name != "Open" {
+			t.Errorf("organization b has task %q", got.Name)
+		}
+	}
+	var proj struct {
+		Name string `json:"name"`
+	}
+	call(t, newRequest(t, "GET", project, b.org.Token, nil), http.StatusOK, &proj)
+	if proj.Name != "Project" {
+		t.Errorf("organization b's project is named %q", proj.Name)
+	}
+	call(t, newRequest(t, "GET", client, b.org.Token, nil), http.StatusOK, nil)
+	var inv struct {
+		Status string `json:"status"`
+	}
+	call(t, adminRequest(t, "GET", invoice, b.org, nil), http.StatusOK, &inv)
+	if inv.Status != "issued" {
+		t.Errorf("organization b's invoice is %s", inv.Status)
+	}
+	var sheet struct {
+		Status string `json:"status"`
+	}
+	call(t, newRequest(t, "GET", timesheet, b.org.Token, nil), http.StatusOK, &sheet)
+	if sheet.Status != "submitted" {
+		t.Errorf("organization b's timesheet is %s", sheet.Status)
+	}
+}
+
+// TestTenantCredentials checks that only a credential selects an
+// organization: a subdomain or header alone is not enough, and an unknown
+// token is not mistaken for an anonymous request.
+func TestTenantCredentials(t *testing.T) {
+	requireDB(t)
+	a := createOrganization(t, "cred-a")
+	b := createOrganization(t, "cred-b")
+	userID := createUser(t, a.Token)
+	path := fmt.Sprintf("/users/%d/tasks", userID)
+
+	tests := []struct {
+		name   string
+		host   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "own token", token: a.Token, want: http.StatusOK},
+		{name: "own token on own subdomain", host: a.Slug + "." + testBaseDomain, token: a.Token, want: http.StatusOK},
+		{name: "subdomain without token", host: a.Slug + "." + testBaseDomain, want: http.StatusUnauthorized},
+		{name: "unknown token", token: "not-a-token", want: http.StatusUnauthorized},
+		{name: "unknown token on subdomain", host: a.Slug + "." + testBaseDomain, token: "not-a-token", want: http.StatusUnauthorized},
+		{name: "other token on subdomain", host: a.Slug + "." + testBaseDomain, token: b.Token, want: http.StatusForbidden},
+		{name: "other token choosing organization", token: b.Token, header: a.Slug, want: http.StatusForbidden},
+		{name: "other token", token: b.Token, want: http.StatusNotFound},
+		{name: "anonymous", want: http.StatusNotFound},
+		{name: "admin choosing organization", token: testAdminToken, header: a.Slug, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest(t, "GET", path, tt.token, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.header != "" {
+				req.Header.Set(middleware.OrganizationHeader, tt.header)
+			}
+			if rec := serve(req); rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package routers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestTimesheetDecisionNeedsManager checks that only a manager of one of the
+// user's teams may approve or reject the user's timesheet, and that the
+// inbox can be narrowed to a manager's team.
+func TestTimesheetDecisionNeedsManager(t *testing.T) {
+	requireDB(t)
+	org := createOrganization(t, "manager")
+	report := createUser(t, org.Token)
+	manager := createUser(t, org.Token)
+	peer := createUser(t, org.Token)
+	outsider := createUser(t, org.Token)
+
+	var team struct {
+		ID int `json:"id"`
+	}
+	call(t, newRequest(t, "POST", "/teams", org.Token, map[string]string{"name": "Team"}), http.StatusCreated, &team)
+	members := fmt.Sprintf("/teams/%d/members", team.ID)
+	call(t, newRequest(t, "POST", members, org.Token, map[string]interface{}{"userId": report}), http.StatusCreated, nil)
+	call(t, newRequest(t, "POST", members, org.Token, map[string]interface{}{"userId": manager, "manager": true}), http.StatusCreated, nil)
+	call(t, newRequest(t, "POST", members, org.Token, map[string]interface{}{"userId": peer}), http.StatusCreated, nil)
+
+	var sheet struct {
+		ID     int    `json:"id"`
+		Status string `json:"status"`
+	}
+	call(t, newRequest(t, "POST", fmt.Sprintf("/users/%d/timesheets/2024-01-15/submit", report), org.Token, nil), http.StatusOK, &sheet)
+	approve := fmt.Sprintf("/timesheets/%d/approve", sheet.ID)
+
+	inbox := func(managerID int) []int {
+		var sheets []struct {
+			ID int `json:"id"`
+		}
+		call(t, adminRequest(t, "GET", fmt.Sprintf("/timesheets/inbox?managerId=%d", managerID), org, nil), http.StatusOK, &sheets)
+		var ids []int
+		for _, s := range sheets {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	if ids := inbox(manager); len(ids) != 1 || ids[0] != sheet.ID {
+		t.Errorf("manager's inbox has %v, want [%d]", ids, sheet.ID)
+	}
+	if ids := inbox(peer); len(ids) != 0 {
+		t.Errorf("peer's inbox has %v, want none", ids)
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"organization token", newRequest(t, "POST", approve, org.Token, map[string]int{"managerId": manager}), http.StatusForbidden},
+		{"no manager", adminRequest(t, "POST", approve, org, nil), http.StatusBadRequest},
+		{"team member who is not a manager", adminRequest(t, "POST", approve, org, map[string]int{"managerId": peer}), http.StatusForbidden},
+		{"user outside the team", adminRequest(t, "POST", approve, org, map[string]int{"managerId": outsider}), http.StatusForbidden},
+		{"the user", adminRequest(t, "POST", approve, org, map[string]int{"managerId": report}), http.StatusForbidden},
+		{"manager", adminRequest(t, "POST", approve, org, map[string]int{"managerId": manager}), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.req); rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
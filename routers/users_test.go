@@ -0,0 +1,51 @@
+package routers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// TestUpdateUserKeepsSettings renames a user and checks that the timezone and
+// auto-stop limit the body leaves out are kept.
+func TestUpdateUserKeepsSettings(t *testing.T) {
+	requireDB(t)
+	org := createOrganization(t, "settings")
+
+	body := newUser()
+	created := map[string]interface{}{"timezone": "Europe/Berlin", "maxTaskMinutes": 480}
+	for key, value := range body {
+		created[key] = value
+	}
+	var user struct {
+		ID int `json:"id"`
+	}
+	call(t, newRequest(t, "POST", "/users", org.Token, created), http.StatusCreated, &user)
+
+	body["name"] = "Renamed"
+	call(t, newRequest(t, "PATCH", "/users/"+strconv.Itoa(user.ID), org.Token, body), http.StatusOK, nil)
+
+	var users []struct {
+		ID             int    `json:"id"`
+		Name           string `json:"name"`
+		Timezone       string `json:"timezone"`
+		MaxTaskMinutes *int   `json:"maxTaskMinutes"`
+	}
+	call(t, newRequest(t, "GET", "/users", org.Token, nil), http.StatusOK, &users)
+	for _, got := range users {
+		if got.ID != user.ID {
+			continue
+		}
+		if got.Name != "Renamed" {
+			t.Errorf("name %q, want Renamed", got.Name)
+		}
+		if got.Timezone != "Europe/Berlin" {
+			t.Errorf("timezone %q, want Europe/Berlin", got.Timezone)
+		}
+		if got.MaxTaskMinutes == nil || *got.MaxTaskMinutes != 480 {
+			t.Errorf("maxTaskMinutes %v, want 480", got.MaxTaskMinutes)
+		}
+		return
+	}
+	t.Fatalf("user %d is not listed", user.ID)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"test-project/config"
+	"test-project/logger"
+)
+
+// Run serves handler until SIGINT or SIGTERM is received, then calls onShutdown
+// and drains in-flight requests within cfg.ShutdownTimeout.
+func Run(cfg config.ServerConfig, handler http.Handler, onShutdown func()) error {
+	srv := &http.Server{
+		Addr:              cfg.Address(),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+
+	useTLS := cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+	if useTLS {
+		reloader, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("Server listening on %s (tls=%t)", cfg.Address(), useTLS)
+		var err error
+		if useTLS {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case err, ok := <-errCh:
+		if ok {
+			return err
+		}
+		return nil
+	case sig := <-stop:
+		logger.Info("Received %s, shutting down", sig)
+	}
+
+	if onShutdown != nil {
+		onShutdown()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	logger.Info("Server stopped")
+	return nil
+}
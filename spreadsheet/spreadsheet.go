@@ -0,0 +1,240 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// maxPartSize bounds each decompressed part of an XLSX file.
+const maxPartSize = 256 << 20
+
+// Row is one non-empty row of a sheet. Line is its 1-based row number in the
+// file, for error messages.
+type Row struct {
+	Line  int
+	Cells []string
+}
+
+// Read returns the non-empty rows of a CSV file, or of the first sheet of an
+// XLSX workbook.
+func Read(format string, data []byte) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(data)
+	case FormatXLSX:
+		return readXLSX(data)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func readCSV(data []byte) ([]Row, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isEmpty(record) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, Row{Line: line, Cells: record})
+	}
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		ID string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a plain or rich text string; rich text is split into runs.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	s := t.T
+	for _, r := range t.Runs {
+		s += r.T
+	}
+	return s
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readXLSX(data []byte) ([]Row, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an XLSX file: %w", err)
+	}
+
+	var workbook xlsxWorkbook
+	if err = decodePart(archive, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	var rels xlsxRelationships
+	if err = decodePart(archive, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].ID {
+			sheetPath = rel.Target
+		}
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else if sheetPath != "" {
+		sheetPath = path.Join("xl", sheetPath)
+	} else {
+		return nil, errors.New("first sheet not found")
+	}
+
+	var shared xlsxSharedStrings
+	if findPart(archive, "xl/sharedStrings.xml") != nil {
+		if err = decodePart(archive, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var sheet xlsxSheet
+	if err = decodePart(archive, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for i, r := range sheet.Rows {
+		row := Row{Line: r.Number}
+		if row.Line == 0 {
+			row.Line = i + 1
+		}
+		for j, c := range r.Cells {
+			col := j
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			var value string
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s: invalid shared string %q", c.Ref, c.Value)
+				}
+				value = shared.Items[n].String()
+			case "inlineStr":
+				value = c.Inline.String()
+			default:
+				value = c.Value
+			}
+			for len(row.Cells) <= col {
+				row.Cells = append(row.Cells, "")
+			}
+			row.Cells[col] = value
+		}
+		if !isEmpty(row.Cells) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func findPart(archive *zip.Reader, name string) *zip.File {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func decodePart(archive *zip.Reader, name string, v interface{}) error {
+	f := findPart(archive, name)
+	if f == nil {
+		return fmt.Errorf("XLSX part %s is missing", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", name, err)
+	}
+	defer rc.Close()
+	if err = xml.NewDecoder(io.LimitReader(rc, maxPartSize)).Decode(v); err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return nil
+}
+
+// columnIndex returns the 0-based column of a cell reference such as "AB12".
+func columnIndex(ref string) (int, error) {
+	col := 0
+	for _, ch := range ref {
+		if ch >= 'A' && ch <= 'Z' {
+			col = col*26 + int(ch-'A') + 1
+			if col > 16384 {
+				break
+			}
+			continue
+		}
+		break
+	}
+	if col == 0 || col > 16384 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+func isEmpty(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
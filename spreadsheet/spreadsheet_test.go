@@ -0,0 +1,172 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	data := "\xef\xbb\xbfsurname,name\n\nDoe,\"Jane, Q.\"\n , \nRoe,Rick,extra\n"
+	rows, err := Read(FormatCSV, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{
+		{Line: 1, Cells: []string{"surname", "name"}},
+		{Line: 3, Cells: []string{"Doe", "Jane, Q."}},
+		{Line: 5, Cells: []string{"Roe", "Rick", "extra"}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %+v, want %+v", rows, want)
+	}
+}
+
+const (
+	testWorkbook = `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Users" sheetId="1" r:id="rId1"/><sheet name="Other" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`
+	testSharedStrings = `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>surname</t></si><si><t>name</t></si><si><r><t>Do</t></r><r><t>e</t></r></si>
+</sst>`
+	testSheet = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" t="inlineStr"><is><t>Jane</t></is></c><c r="D2"><v>42</v></c></row>
+<row r="4"><c r="A4" t="inlineStr"><is><t> </t></is></c></row>
+<row r="7"><c r="B7"><v>7</v></c></row>
+</sheetData>
+</worksheet>`
+)
+
+// xlsx builds a workbook from parts named by their path in the archive.
+func xlsx(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func relationships(target string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="` + target + `"/>
+</Relationships>`
+}
+
+func TestReadXLSX(t *testing.T) {
+	want := []Row{
+		{Line: 1, Cells: []string{"surname", "name"}},
+		{Line: 2, Cells: []string{"Doe", "Jane", "", "42"}},
+		{Line: 7, Cells: []string{"", "7"}},
+	}
+	for _, target := range []string{"worksheets/sheet1.xml", "/xl/worksheets/sheet1.xml"} {
+		t.Run(target, func(t *testing.T) {
+			data := xlsx(t, map[string]string{
+				"xl/workbook.xml":            testWorkbook,
+				"xl/_rels/workbook.xml.rels": relationships(target),
+				"xl/sharedStrings.xml":       testSharedStrings,
+				"xl/worksheets/sheet1.xml":   testSheet,
+				"xl/worksheets/sheet2.xml":   `<worksheet><sheetData><row r="1"><c r="A1"><v>wrong sheet</v></c></row></sheetData></worksheet>`,
+			})
+			rows, err := Read(FormatXLSX, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rows, want) {
+				t.Errorf("got %+v, want %+v", rows, want)
+			}
+		})
+	}
+}
+
+func TestReadXLSXErrors(t *testing.T) {
+	base := map[string]string{
+		"xl/workbook.xml":            testWorkbook,
+		"xl/_rels/workbook.xml.rels": relationships("worksheets/sheet1.xml"),
+		"xl/sharedStrings.xml":       testSharedStrings,
+		"xl/worksheets/sheet1.xml":   testSheet,
+	}
+	with := func(name, body string) map[string]string {
+		parts := make(map[string]string, len(base))
+		for k, v := range base {
+			parts[k] = v
+		}
+		if body == "" {
+			delete(parts, name)
+		} else {
+			parts[name] = body
+		}
+		return parts
+	}
+
+	tests := []struct {
+		name  string
+		parts map[string]string
+		want  string
+	}{
+		{"no workbook", with("xl/workbook.xml", ""), "xl/workbook.xml is missing"},
+		{"no sheets", with("xl/workbook.xml", "<workbook><sheets/></workbook>"), "no sheets"},
+		{"no sheet relationship", with("xl/_rels/workbook.xml.rels", "<Relationships/>"), "first sheet not found"},
+		{"missing sheet", with("xl/worksheets/sheet1.xml", ""), "sheet1.xml is missing"},
+		{"shared string out of range", with("xl/worksheets/sheet1.xml", `<worksheet><sheetData><row r="1"><c r="A1" t="s"><v>9</v></c></row></sheetData></worksheet>`), "invalid shared string"},
+		{"bad cell reference", with("xl/worksheets/sheet1.xml", `<worksheet><sheetData><row r="1"><c r="1A"><v>1</v></c></row></sheetData></worksheet>`), "invalid cell reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(FormatXLSX, xlsx(t, tt.parts))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Read(FormatXLSX, []byte("surname,name\n")); err == nil {
+		t.Error("a CSV file was read as XLSX")
+	}
+	if _, err := Read("ods", nil); err == nil {
+		t.Error("an unsupported format was accepted")
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    int
+		wantErr bool
+	}{
+		{ref: "A1", want: 0},
+		{ref: "Z9", want: 25},
+		{ref: "AA10", want: 26},
+		{ref: "AB12", want: 27},
+		{ref: "XFD1", want: 16383},
+		{ref: "XFE1", wantErr: true},
+		{ref: "ZZZZZZ1", wantErr: true},
+		{ref: "12", wantErr: true},
+		{ref: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := columnIndex(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("columnIndex(%q) = %d, %v; want %d, error %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}